@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+)
+
+// healthcheckTimeout is how long the server has to respond to the healthcheck
+const healthcheckTimeout = 2 * time.Second
+
+// healthcheck runs the healthcheck subcommand, which the HEALTHCHECK of the Docker image uses to
+// check that the server still serves requests. The port and TLS settings are read the same way the
+// server reads them, so the check keeps working when they are changed. It exits with 1 unless
+// /healthz responds with 200. Any configuration flags go after the subcommand.
+func healthcheck(args []string) {
+	config, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheme := "http"
+	client := &http.Client{Timeout: healthcheckTimeout}
+	if len(config.Server.TLSCert) > 0 {
+		// the certificate is issued for the name the server is reached by, not localhost
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	url := fmt.Sprintf("%s://localhost:%d/healthz", scheme, config.Server.Port)
+	res, err := client.Get(url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("%s responded with %d", url, res.StatusCode)
+	}
+}
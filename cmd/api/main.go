@@ -1,61 +1,108 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/cmd/api/router"
 	"github.com/elopez00/scale-backend/pkg/application"
-	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/config"
 	"github.com/elopez00/scale-backend/pkg/server"
-	"github.com/joho/godotenv"
+
+	"github.com/rs/cors"
 )
 
 func main() {
-	// gets environment variables
-	environment, err := godotenv.Read()
-	if err != nil {
-		// if for whatever reason godotenv fails, try to load from the system environment
-		// and create a map with its values
-		environment = make(map[string]string)
-		for _, item := range os.Environ() {
-			splits := strings.Split(item, "=")
-			key := strings.Trim(splits[0], " ")
-			val := strings.Trim(splits[1], " ")
-			environment[key] = val
-		}
-		
-		// if there were no elements then either return the error again
-		if len(environment) == 0 {
-			log.Fatal("Failed go get environment file:", err)
+	// the migrate and rekey subcommands manage the database instead of starting the server, and
+	// the healthcheck subcommand checks the server that is already running
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrate(os.Args[2:])
+			return
+		case "rekey":
+			rekey(os.Args[2:])
+			return
+		case "healthcheck":
+			healthcheck(os.Args[2:])
+			return
 		}
 	}
 
+	// gets the configuration from the flags, environment, and config files
+	config, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// gets application
-	app, err := application.Get(environment)
+	app, err := application.Get(config)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// defers the close of database
-	defer func(DB *database.DB) {
-		err := DB.Close()
+	// the data of the api is kept in the database
+	app.Stores = models.NewSQLStores(app.DB, app.Keyring)
+
+	// brings the database schema up to date before serving requests
+	if app.Config.Database.Migrate {
+		applied, err := app.DB.Migrate(context.Background())
 		if err != nil {
-			log.Println("Failed to close database instance", err)
+			log.Fatal("Failed to migrate database: ", err)
 		}
-	} (app.DB)
 
-	// creates the server
-	port := app.Config.GetServer()["port"]
+		for _, migration := range applied {
+			app.Log.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+	}
+
+	// creates the server, which stops the worker and then closes the database once every request
+	// was served
+	port := app.Config.Server.Port
+	serverConfig := app.Config.Server
 	srv := server.
 		Get().
-		WithAddr(port).
-		WithHandler(router.Get(app))
+		WithAddr(strconv.Itoa(port)).
+		WithHandler(middleware.Logging(router.Get(app), app)).
+		WithCORS(cors.Options{
+			AllowedOrigins:   app.Config.CORS.AllowedOrigins,
+			AllowedMethods:   app.Config.CORS.AllowedMethods,
+			AllowedHeaders:   app.Config.CORS.AllowedHeaders,
+			ExposedHeaders:   []string{models.RequestIdHeader},
+			AllowCredentials: app.Config.CORS.AllowCredentials,
+			MaxAge:           int(app.Config.CORS.MaxAge / time.Second),
+		}).
+		WithTimeouts(serverConfig.ReadTimeout, serverConfig.WriteTimeout, serverConfig.IdleTimeout).
+		WithShutdownTimeout(serverConfig.ShutdownTimeout).
+		WithLogger(app.Log).
+		OnShutdown(func(ctx context.Context) error {
+			return app.Worker.Stop(ctx)
+		}).
+		OnShutdown(func(ctx context.Context) error {
+			return app.DB.Close()
+		})
+
+	if len(serverConfig.TLSCert) > 0 {
+		srv.WithTLS(serverConfig.TLSCert, serverConfig.TLSKey)
+	}
+
+	// the server is shut down gracefully when the container is stopped or interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// starts the server on given port
-	log.Println("Starting server at port", port)
-	if err := srv.Start(); err != nil {
-		log.Fatal(err)
+	app.Log.Info("Starting server", "port", port)
+	if err := srv.Run(ctx); err != nil {
+		app.Log.Error("Server failed", "error", err)
+		os.Exit(1)
 	}
+
+	app.Log.Info("Server stopped")
 }
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// requestLogKey is the key the log of a request is stored with in its context
+type requestLogKey struct{}
+
+// requestLog records what is logged about a request once it was served, and the status it was
+// responded with
+type requestLog struct {
+	http.ResponseWriter
+	status	int
+	userId	string
+}
+
+// WriteHeader records the status before writing it
+func (l *requestLog) WriteHeader(status int) {
+	if l.status == 0 {
+		l.status = status
+	}
+	l.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the implicit 200 (OK) status of responses that did not write one
+func (l *requestLog) Write(body []byte) (int, error) {
+	if l.status == 0 {
+		l.status = http.StatusOK
+	}
+	return l.ResponseWriter.Write(body)
+}
+
+// Logging is a function that takes in the router of the api and returns a handler that gives
+// every request an id, which is the X-Request-Id header sent by the client if it is valid, and
+// responds with it in the same header. The request is served with a logger that writes the id
+// with every entry, and once it is served the method, route, status, latency, and user of the
+// request are logged.
+func Logging(router *httprouter.Router, app *application.App) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := models.RequestId(r)
+		log := app.Log.With("requestId", id)
+
+		ctx := context.WithValue(r.Context(), models.Key("requestId"), id)
+		ctx = logger.NewContext(ctx, log)
+
+		record := &requestLog{ResponseWriter: w}
+		ctx = context.WithValue(ctx, requestLogKey{}, record)
+
+		w.Header().Set(models.RequestIdHeader, id)
+		router.ServeHTTP(record, r.WithContext(ctx))
+
+		if record.status == 0 {
+			record.status = http.StatusOK
+		}
+
+		write := log.Info
+		if record.status >= http.StatusInternalServerError {
+			write = log.Error
+		}
+
+		write("Served request",
+			"method", r.Method,
+			"route", route(router, r),
+			"status", record.status,
+			"latencyMs", float64(time.Since(start).Microseconds()) / 1000,
+			"userId", record.userId,
+		)
+	})
+}
+
+// route returns the route that matched the request, with the names of its parameters instead
+// of their values so that requests to the same route are logged the same way. Requests that
+// matched no route are logged with their path.
+func route(router *httprouter.Router, r *http.Request) string {
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return r.URL.Path
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	for _, param := range params {
+		for i, segment := range segments {
+			if segment == param.Value {
+				segments[i] = ":" + param.Key
+				break
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// setLoggedUser records the user the request was authenticated as, so that it is logged once
+// the request was served, and returns a context whose logger writes the user with every entry
+func setLoggedUser(ctx context.Context, app *application.App, userId string) context.Context {
+	if record, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		record.userId = userId
+	}
+
+	return logger.NewContext(ctx, app.Logger(ctx).With("userId", userId))
+}
@@ -0,0 +1,111 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// serveLogged serves the request with the logging middleware around a router whose only route
+// needs authentication, and returns the response along with the entries that were logged
+func serveLogged(t *testing.T, req *http.Request) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	app := test.GetMemoryApp()
+
+	var logs bytes.Buffer
+	app.Log = logger.New(&logs, logger.Info)
+
+	router := httprouter.New()
+	router.GET("/v0/token/:itemId", middleware.Authenticate(sdk.AuthCheck(), app))
+
+	res := httptest.NewRecorder()
+	middleware.Logging(router, app).ServeHTTP(res, req)
+
+	entries := make([]map[string]interface{}, 0)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var entry map[string]interface{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatal("The logs are not JSON:", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return res, entries
+}
+
+func TestLoggingAuthenticated(t *testing.T) {
+	app := test.GetMemoryApp()
+	token, _ := sdk.GenerateJWT(app, "testvalue", "testsession")
+
+	req, _ := http.NewRequest(http.MethodGet, "/v0/token/itemid", nil)
+	req.AddCookie(&http.Cookie{Name: "AuthToken", Value: token})
+	req.Header.Set(models.RequestIdHeader, "client-request-1")
+
+	res, entries := serveLogged(t, req)
+	test.Response(t, res, http.StatusOK)
+
+	if id := res.Header().Get(models.RequestIdHeader); id != "client-request-1" {
+		t.Error("The request id of the client was not propagated:", id)
+	}
+
+	if len(entries) != 1 {
+		t.Fatal("Expected a single entry, got", entries)
+	}
+
+	entry := entries[0]
+	expected := map[string]interface{}{
+		"level":     "info",
+		"requestId": "client-request-1",
+		"method":    http.MethodGet,
+		"route":     "/v0/token/:itemId",
+		"status":    float64(http.StatusOK),
+		"userId":    "testvalue",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %v to be %v, got %v", key, value, entry[key])
+		}
+	}
+
+	if _, ok := entry["latencyMs"].(float64); !ok {
+		t.Error("The latency was not logged:", entry)
+	}
+}
+
+func TestLoggingUnauthorized(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/v0/token/itemid", nil)
+	req.Header.Set(models.RequestIdHeader, "not a valid id")
+
+	res, entries := serveLogged(t, req)
+
+	// the generated id is the one in the header, the error, and every entry
+	id := res.Header().Get(models.RequestIdHeader)
+	if len(id) == 0 || id == "not a valid id" {
+		t.Fatal("A new request id should have been generated, got", id)
+	}
+
+	if apiError := test.Error(t, res, models.CodeUnauthorized); apiError.RequestId != id {
+		t.Error("The error has another request id:", apiError.RequestId)
+	}
+
+	for _, entry := range entries {
+		if entry["requestId"] != id {
+			t.Error("An entry was logged without the request id:", entry)
+		}
+	}
+
+	last := entries[len(entries)-1]
+	if last["status"] != float64(http.StatusUnauthorized) || last["userId"] != "" {
+		t.Error("Unexpected request entry:", last)
+	}
+}
@@ -3,60 +3,114 @@ package middleware
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/pkg/application"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/julienschmidt/httprouter"
 )
 
 // Authenticate is a function that takes in a handler and an application and returns another
-// handler that tests the validity of authentication tokens found in auth cookie. If
-// the token is expired or invalid for any reason the user will not be authenticated
-// and will not be able to call api. Otherwise, the function will serve the res, req,
-// parameters to the inputted handler and execute it.
+// handler that tests the validity of the access token of the request, which is the bearer token
+// of the Authorization header or otherwise the one found in the auth cookie. If the token is
+// expired or invalid for any reason the user will not be authenticated and will not be able to
+// call api. Otherwise, the function will serve the res, req, parameters to the inputted handler
+// and execute it.
 func Authenticate(next httprouter.Handle, app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		// checks if token is valid
-		id, err := CookieIsValid(r, app, "AuthToken")
+		id, session, err := RequestIsAuthenticated(r, app)
 		if err != nil || len(id) == 0 {
 			msg := "Unauthorized User"
-			models.CreateError(w, http.StatusUnauthorized, msg, err)
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeUnauthorized, msg, err)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), models.Key("user"), id)
+		ctx = context.WithValue(ctx, models.Key("session"), session)
+		ctx = setLoggedUser(ctx, app, id)
 		r = r.WithContext(ctx)
 
 		next(w, r, p)
 	}
 }
 
-// CookieIsValid tests to see if cookie is still valid
-func CookieIsValid(r *http.Request, app *application.App, name string) (string, error) {
-	key := app.Config.GetServer()["key"]
+// RequireVerifiedEmail is a function that takes in a handler that is only served to users who
+// verified their email when PLAID_REQUIRE_VERIFIED_EMAIL is set, and returns a handler that
+// responds with the http status 403 (Forbidden) to everyone else. It has to be wrapped by
+// Authenticate, since it checks the user the request was authenticated as.
+func RequireVerifiedEmail(next httprouter.Handle, app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !app.Config.Plaid.RequireVerified {
+			next(w, r, p)
+			return
+		}
+
+		userId, _ := r.Context().Value(models.Key("user")).(string)
+		user, err := app.Users.Get(userId)
+		if err != nil {
+			msg := "Failed to get user"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if !user.Verified {
+			msg := "Email must be verified first"
+			models.CreateError(w, r, http.StatusForbidden, models.CodeEmailNotVerified, msg, nil)
+			return
+		}
+
+		next(w, r, p)
+	}
+}
+
+// RequestIsAuthenticated tests the access token of the request, which is the bearer token of the
+// Authorization header if there is one, or the token found in the AuthToken cookie otherwise. If
+// the token is valid, the user id and session id found in it are returned.
+func RequestIsAuthenticated(r *http.Request, app *application.App) (string, string, error) {
+	if header := r.Header.Get("Authorization"); len(header) > 0 {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || len(parts[1]) == 0 {
+			return "", "", errors.New("authorization header is not a bearer token")
+		}
+
+		return TokenIsValid(parts[1], app)
+	}
+
+	return CookieIsValid(r, app, "AuthToken")
+}
+
+// CookieIsValid tests to see if the access token found in the cookie is still valid. If the
+// cookie is valid, the user id and session id found in the token are returned.
+func CookieIsValid(r *http.Request, app *application.App, name string) (string, string, error) {
 	cookie, err := r.Cookie(name)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-		return []byte(key), nil
-	})
+	return TokenIsValid(cookie.Value, app)
+}
+
+// TokenIsValid tests to see if the access token is still valid. On top of checking the signature,
+// claims, and expiration of the token, the session the token was issued for must not have been
+// revoked. If the token is valid, the user id and session id found in it are returned.
+func TokenIsValid(value string, app *application.App) (string, string, error) {
+	claims, err := app.Signing.Verify(value)
+	if err != nil {
+		return "", "", err
+	}
 
+	// tokens are only valid as long as their session is
+	active, err := app.Sessions.IsActive(claims.Id, claims.Subject)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	if !token.Valid {
-		err = errors.New("token invalid")
-		return "", err
+	if !active {
+		return "", "", errors.New("session revoked")
 	}
 
-	claims, _ := token.Claims.(jwt.MapClaims)
-	issuer := fmt.Sprint(claims["iss"])
-	return issuer, nil
+	return claims.Subject, claims.Id, nil
 }
@@ -3,6 +3,7 @@ package middleware_test
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/elopez00/scale-backend/cmd/api/middleware"
@@ -35,6 +36,8 @@ func TestValidAuthentication(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	if res := test.GetWithCookie("/v0", middleware.Authenticate(sdk.AuthCheck(), app), app, "AuthToken"); res.Code != http.StatusOK {
 		t.Errorf("Wrong http status. Expected %v, got: %v", http.StatusOK, res.Code)
 	} else {
@@ -49,4 +52,21 @@ func TestValidAuthentication(t *testing.T) {
 			t.Errorf("This response was supposed to work, expected greeting, got: %v", response.Message)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestInvalidAuthorizationHeader(t *testing.T) {
+	app := test.GetMemoryApp()
+	token, _ := sdk.GenerateJWT(app, "testvalue", "testsession")
+
+	// the token has to be given as a bearer token
+	for _, header := range []string{"Basic " + token, token, "Bearer "} {
+		req, _ := http.NewRequest(http.MethodGet, "/v0", nil)
+		req.Header.Set("Authorization", header)
+
+		res := httptest.NewRecorder()
+		middleware.Authenticate(sdk.AuthCheck(), app)(res, req, nil)
+		if res.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be unauthorized, got %v", header, res.Code)
+		}
+	}
+}
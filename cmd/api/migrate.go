@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+	"github.com/elopez00/scale-backend/pkg/application/database"
+)
+
+// migrate runs the migrate subcommand, which is used as:
+//
+//	main migrate up             applies every pending migration
+//	main migrate down [steps]   reverts the last migration, or the given number of them
+//	main migrate status         lists every migration and when it was applied
+//
+// Any configuration flags go after the action (and steps).
+func migrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: migrate up | down [steps] | status")
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			steps, args = n, args[1:]
+		}
+	}
+
+	config, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Get(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		applied, err := db.Migrate(ctx)
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "down":
+		reverted, err := db.Rollback(ctx, steps)
+		for _, migration := range reverted {
+			log.Printf("Reverted migration %d_%s", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "status":
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, migration := range status {
+			applied := "pending"
+			if migration.AppliedAt > 0 {
+				applied = time.Unix(migration.AppliedAt, 0).UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(os.Stdout, "%04d_%-24s %s\n", migration.Version, migration.Name, applied)
+		}
+
+	default:
+		log.Fatalf("Unknown migrate action %q, expected up, down, or status", action)
+	}
+}
@@ -271,11 +271,11 @@ func TestAddAllLiabilities(t *testing.T) {
 		balance.AddBalance("Bank 1", account, &liabilities)
 	}
 
-	if len(liabilities.Credit) != 0 && len(liabilities.Mortgage) != 0 && len(liabilities.Credit) != 0 {
+	if len(liabilities.Credit) != 0 || len(liabilities.Mortgage) != 0 || len(liabilities.Student) != 0 {
 		t.Fatal("Liabilities werent removed")
 	}
 
-	if len(balance.Loan) != 2 && len(balance.Credit) != 2 {
+	if len(balance.Loan) != 2 || len(balance.Credit) != 2 {
 		t.Fatal("Not all balances and liabilities were added")
 	}
 }
\ No newline at end of file
@@ -1,61 +1,37 @@
 package models
 
 import (
-	"github.com/elopez00/scale-backend/pkg/application"
-)
-
-// WhiteListItem item for white listed companies of a specific category
-type WhiteListItem struct {
-	Category string `json:"category"` // id of category
-	Name     string `json:"name"`     // name of company being listed under this category
-	Id       string `json:"id"`       // item id
-}
-
-// Category within budget
-type Category struct {
-	Name      string          `json:"name"`                // name of category
-	Budget    float64         `json:"budget"`              // amount of money budgeted towards this category
-	Id        string          `json:"id"`                  // category id
-	WhiteList []WhiteListItem `json:"whitelist,omitempty"` // whitelist corresponding to category
-	Color 	  string		  `json:"color"`
-}
+	"database/sql"
+	"strings"
 
-// UpdateObject contains both category updates and whitelist updates. Neither one nor the
-// other are required.
-type UpdateObject struct {
-	Categories []Category      `json:"categories,omitempty"`
-	WhiteList  []WhiteListItem `json:"whitelist,omitempty"`
-}
+	"github.com/elopez00/scale-backend/pkg/application/database"
 
-// UpdateRequest a struct that describes what will be updated in a budget
-type UpdateRequest struct {
-	Update UpdateObject `json:"change,omitempty"`
-	Remove UpdateObject `json:"remove,omitempty"`
-}
+	"github.com/plaid/plaid-go/plaid"
+)
 
-// Budget is a combination of categories
-type Budget struct {
-	Categories []Category    `json:"categories,omitempty"`
-	Request    UpdateRequest `json:"request,omitempty"`
+// SQLBudgetStore stores budgets in the categories and whitelist tables
+type SQLBudgetStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
 }
 
-// GetBudget will get the budget of the user from the database given
+// Get will get the budget of the user from the database given
 // the user id and will return it as a Budget model. If the execution of
 // this function fails at any given point, it will return the error.
-func GetBudget(app *application.App, userId string) (Budget, error) {
+func (s *SQLBudgetStore) Get(userId string) (Budget, error) {
 	var budget Budget                          // output budget
 	catMap := make(map[string][]WhiteListItem) // map containing all whitelist items pertaining to a category
 
 	// get categories from database
 	queryCategories := "SELECT id, name, budget, categoryId FROM categories WHERE categories.id = ?"
-	categories, err := app.DB.Client.Query(queryCategories, userId)
+	categories, err := s.DB.Query(s.Dialect.Rebind(queryCategories), userId)
 	if err != nil {
 		return Budget{}, err
 	}
 
 	// get whitelist items from database
 	queryWhiteList := "SELECT id, name, category, itemId FROM whitelist WHERE whitelist.id = ?"
-	whitelist, err := app.DB.Client.Query(queryWhiteList, userId)
+	whitelist, err := s.DB.Query(s.Dialect.Rebind(queryWhiteList), userId)
 	if err != nil {
 		return Budget{}, err
 	}
@@ -87,22 +63,60 @@ func GetBudget(app *application.App, userId string) (Budget, error) {
 	return budget, nil
 }
 
+// AddSpending will go through every transaction and add its amount to the category of the budget
+// whose whitelist contains the transaction's merchant. A transaction will only be counted once,
+// towards the first category that matches it, and transactions that do not match any
+// category are ignored. Once all the transactions are counted, the remaining amount of
+// every category is calculated from its budget.
+func AddSpending(b *Budget, transactions []plaid.Transaction) {
+	for _, transaction := range transactions {
+		if i := findCategory(b, transaction); i >= 0 {
+			b.Categories[i].Spent += transaction.Amount
+		}
+	}
+
+	for i := range b.Categories {
+		b.Categories[i].Remaining = b.Categories[i].Budget - b.Categories[i].Spent
+	}
+}
+
+// findCategory returns the index of the first category that has a whitelist item matching the
+// merchant of the transaction. Names are compared without case, and the whitelisted name only
+// needs to be contained in the merchant name. If no category matches, -1 is returned.
+func findCategory(b *Budget, transaction plaid.Transaction) int {
+	merchant := transaction.MerchantName
+	if len(merchant) == 0 {
+		merchant = transaction.Name
+	}
+	merchant = strings.ToLower(merchant)
+
+	for i, category := range b.Categories {
+		for _, item := range category.WhiteList {
+			if len(item.Name) > 0 && strings.Contains(merchant, strings.ToLower(item.Name)) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
 // Update handles all updates to current budget whether it be adding, removing,
 // or changing. This function will only perform at most 4 queries at a time. If there is a
 // failure inserting, deleting, or updating any of the rows it will be returned as an error.
-func (b *Budget) Update(app *application.App, userId string) error {
+func (s *SQLBudgetStore) Update(userId string, b *Budget) error {
 	// add any categories that need to be added
-	if err := UpdateCategories(app, userId, b.Request.Update.Categories); err != nil {
+	if err := s.UpdateCategories(userId, b.Request.Update.Categories); err != nil {
 		return err
 	}
 
 	// add any whitelist elements that need to be added
-	if err := UpdateWhiteList(app, userId, b.Request.Update.WhiteList); err != nil {
+	if err := s.UpdateWhiteList(userId, b.Request.Update.WhiteList); err != nil {
 		return err
 	}
 
 	// delete any elements that need to be deleted
-	if err := Delete(app, userId, *b); err != nil {
+	if err := s.Delete(userId, *b); err != nil {
 		return err
 	}
 
@@ -112,16 +126,14 @@ func (b *Budget) Update(app *application.App, userId string) error {
 // UpdateWhiteList all the white list items and inserts them to the database. If the function fails
 // due to the database connection or query execution, an error will be returned that reflects
 // this
-func UpdateWhiteList(app *application.App, userId string, whitelist []WhiteListItem) error {
+func (s *SQLBudgetStore) UpdateWhiteList(userId string, whitelist []WhiteListItem) error {
 	// there might not be items that needs to be whitelisted, if this is the case return nil
 	if len(whitelist) == 0 {
 		return nil
 	}
 
 	query := "INSERT INTO whitelist(id, category, name, itemId) VALUES "
-	queryEnd :=
-		" AS updated ON DUPLICATE KEY UPDATE id=updated.id, category=updated.category," +
-			" name=updated.name, itemId=updated.itemId;"
+	queryEnd := s.Dialect.Upsert([]string{"id", "itemId"}, []string{"id", "category", "name", "itemId"})
 
 	var values []interface{}
 
@@ -132,7 +144,7 @@ func UpdateWhiteList(app *application.App, userId string, whitelist []WhiteListI
 
 	// prepare statement
 	query = query[0:len(query)-1] + queryEnd
-	stmt, err := app.DB.Client.Prepare(query)
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
 	if err != nil {
 		return err
 	}
@@ -147,15 +159,13 @@ func UpdateWhiteList(app *application.App, userId string, whitelist []WhiteListI
 
 // UpdateCategories all the category items and inserts them to the database. If the function fails due
 // to the database connection or query execution, an error will be returned that reflects this
-func UpdateCategories(app *application.App, userId string, categories []Category) error {
+func (s *SQLBudgetStore) UpdateCategories(userId string, categories []Category) error {
 	if len(categories) == 0 {
 		return nil
 	}
 
 	query := "INSERT INTO categories(id, name, budget, categoryId, color) VALUES "
-	queryEnd :=
-		" AS updated ON DUPLICATE KEY UPDATE id=updated.id, name=updated.name," +
-		" budget=updated.budget, categoryId=updated.categoryId, color=updated.color;"
+	queryEnd := s.Dialect.Upsert([]string{"id", "categoryId"}, []string{"id", "name", "budget", "categoryId", "color"})
 
 	var values []interface{}
 
@@ -166,7 +176,7 @@ func UpdateCategories(app *application.App, userId string, categories []Category
 
 	// prepare statement
 	query = query[0:len(query)-1] + queryEnd // trim last comma
-	stmt, err := app.DB.Client.Prepare(query)
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
 	if err != nil {
 		return err
 	}
@@ -183,33 +193,21 @@ func UpdateCategories(app *application.App, userId string, categories []Category
 // in that category are also marked for deletion, they will be ignored and all the
 // rows will be deleted in a single query. This function will at most perform 2 queries.
 // If there is an error with the execution, it will be reflected in the return value.
-func Delete(app *application.App, userId string, b Budget) error {
+func (s *SQLBudgetStore) Delete(userId string, b Budget) error {
 	deleted := make(map[string]bool) // create a map to keep track of deleted categories
 
 	if len(b.Request.Remove.Categories) != 0 {
 		values := []interface{}{userId} // initialize values with userid
-		query :=
-			"DELETE categories, whitelist " +
-			"FROM categories LEFT JOIN whitelist " +
-			"ON categories.categoryId = whitelist.category " +
-			"WHERE categories.id = ? AND categories.categoryId IN ("
+		placeholders := ""
 
 		// loop through all categories
 		for _, category := range b.Request.Remove.Categories {
-			query += "?,"
+			placeholders += "?,"
 			values = append(values, category.Id)
 			deleted[category.Id] = true // adding category to deleted map
 		}
 
-		// prepare query
-		query = query[0:len(query)-1] + ");"
-		stmt, err := app.DB.Client.Prepare(query)
-		if err != nil {
-			return err
-		}
-
-		// execute query
-		if _, err := stmt.Exec(values...); err != nil {
+		if err := s.deleteCategories(placeholders[0:len(placeholders)-1], values); err != nil {
 			return err
 		}
 	}
@@ -232,7 +230,7 @@ func Delete(app *application.App, userId string, b Budget) error {
 		if len(values) > 1 {
 			// prepare query
 			query = query[0:len(query)-1] + ");"
-			stmt, err := app.DB.Client.Prepare(query)
+			stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
 			if err != nil {
 				return err
 			}
@@ -246,3 +244,48 @@ func Delete(app *application.App, userId string, b Budget) error {
 
 	return nil
 }
+
+// deleteCategories deletes the categories of the user along with their whitelist items. The values
+// are the id of the user followed by the ids of the categories, which fill the placeholders.
+// MySQL deletes from both tables in a single query, every other database needs a query per table,
+// which are run in a transaction so that whitelist items are never left without their category.
+func (s *SQLBudgetStore) deleteCategories(placeholders string, values []interface{}) error {
+	if s.Dialect != database.Postgres && s.Dialect != database.SQLite {
+		query :=
+			"DELETE categories, whitelist " +
+			"FROM categories LEFT JOIN whitelist " +
+			"ON categories.categoryId = whitelist.category " +
+			"WHERE categories.id = ? AND categories.categoryId IN (" + placeholders + ");"
+
+		// prepare query
+		stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
+		if err != nil {
+			return err
+		}
+
+		// execute query
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM whitelist WHERE id = ? AND category IN (" + placeholders + ");"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), values...); err != nil {
+		return err
+	}
+
+	query = "DELETE FROM categories WHERE id = ? AND categoryId IN (" + placeholders + ");"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), values...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
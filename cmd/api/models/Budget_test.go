@@ -4,9 +4,11 @@ import (
 	"testing"
 
 	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application/database"
 	"github.com/elopez00/scale-backend/pkg/test"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/plaid/plaid-go/plaid"
 )
 
 var testBudget = models.Budget {
@@ -72,7 +74,7 @@ func TestUpdateWhiteList(t *testing.T) {
 		).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := budget.Update(app, user.Id)
+	err := app.Budgets.Update(user.Id, &budget)
 	test.ModelMethod(t, err, "insert")
 	test.MockExpectations(t, app)
 }
@@ -106,7 +108,7 @@ func TestUpdateCategory(t *testing.T) {
 		).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := budget.Update(app, user.Id)
+	err := app.Budgets.Update(user.Id, &budget)
 	test.ModelMethod(t, err, "insert")
 	test.MockExpectations(t, app)
 }
@@ -147,7 +149,7 @@ func TestUpdateBudget(t *testing.T) {
 		).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := testBudgetUpdate.Update(app, user.Id)
+	err := app.Budgets.Update(user.Id, &testBudgetUpdate)
 	test.ModelMethod(t, err, "insert")
 	test.MockExpectations(t, app)
 }
@@ -160,11 +162,11 @@ func TestDeleteCategoryAndListItems(t *testing.T) {
 		Request: models.UpdateRequest {  
 			Remove: models.UpdateObject {
 				Categories: []models.Category {
-					{ "Shopping", 400, "cid123", []models.WhiteListItem {}, "#ff5757" },
+					{ Name: "Shopping", Budget: 400, Id: "cid123", WhiteList: []models.WhiteListItem {}, Color: "#ff5757" },
 				},
 				WhiteList: []models.WhiteListItem {
-					{ "cid123", "Calvin Klein", "something" },
-					{ "cid123", "Ralph Lauren", "domething" },
+					{ Category: "cid123", Name: "Calvin Klein", Id: "something" },
+					{ Category: "cid123", Name: "Ralph Lauren", Id: "domething" },
 				},
 			},
 		},
@@ -182,7 +184,36 @@ func TestDeleteCategoryAndListItems(t *testing.T) {
 		WithArgs(user.Id, budget.Request.Remove.Categories[0].Id).
 		WillReturnResult(sqlmock.NewResult(0, 3))
 	
-	err := models.Delete(app, user.Id, budget)
+	err := (&models.SQLBudgetStore{DB: app.DB.Client}).Delete(user.Id, budget)
+	test.ModelMethod(t, err, "delete")
+	test.MockExpectations(t, app)
+}
+
+func TestDeleteCategoryPostgres(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	budget := models.Budget {
+		Request: models.UpdateRequest {
+			Remove: models.UpdateObject {
+				Categories: []models.Category{{ Id: "cid123" }, { Id: "cid456" }},
+			},
+		},
+	}
+
+	// postgres can't delete from both tables at once, so they are deleted in a transaction
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.
+		ExpectExec(`DELETE FROM whitelist WHERE id \= \$1 AND category IN \(\$2,\$3\);`).
+		WithArgs(user.Id, "cid123", "cid456").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	app.DB.Mock.
+		ExpectExec(`DELETE FROM categories WHERE id \= \$1 AND categoryId IN \(\$2,\$3\);`).
+		WithArgs(user.Id, "cid123", "cid456").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	app.DB.Mock.ExpectCommit()
+
+	err := (&models.SQLBudgetStore{DB: app.DB.Client, Dialect: database.Postgres}).Delete(user.Id, budget)
 	test.ModelMethod(t, err, "delete")
 	test.MockExpectations(t, app)
 }
@@ -195,8 +226,8 @@ func TestDeleteWhiteListItem(t *testing.T) {
 		Request: models.UpdateRequest {
 			Remove: models.UpdateObject {
 				WhiteList: []models.WhiteListItem {
-					{ "cid123", "Calvin Klein", "something" },
-					{ "cid123", "Ralph Lauren", "domething" },
+					{ Category: "cid123", Name: "Calvin Klein", Id: "something" },
+					{ Category: "cid123", Name: "Ralph Lauren", Id: "domething" },
 				},
 			},
 		},
@@ -213,7 +244,7 @@ func TestDeleteWhiteListItem(t *testing.T) {
 		).
 		WillReturnResult(sqlmock.NewResult(0, 2))
 	
-	err := models.Delete(app, user.Id, budget)
+	err := (&models.SQLBudgetStore{DB: app.DB.Client}).Delete(user.Id, budget)
 	test.ModelMethod(t, err, "delete")
 	test.MockExpectations(t, app)
 }
@@ -226,12 +257,12 @@ func TestDeleteWhiteListAndCategories(t *testing.T) {
 		Request: models.UpdateRequest {
 			Remove: models.UpdateObject {
 				Categories: []models.Category {
-					{ "Shopping", 400, "cid123", []models.WhiteListItem {}, "#ff5757" },
+					{ Name: "Shopping", Budget: 400, Id: "cid123", WhiteList: []models.WhiteListItem {}, Color: "#ff5757" },
 				},
 				WhiteList: []models.WhiteListItem {
-					{ "cid123", "Calvin Klein", "something" },
-					{ "cid123", "Ralph Lauren", "domething" },
-					{ "cid456", "Calvin Klein", "comething" },
+					{ Category: "cid123", Name: "Calvin Klein", Id: "something" },
+					{ Category: "cid123", Name: "Ralph Lauren", Id: "domething" },
+					{ Category: "cid456", Name: "Calvin Klein", Id: "comething" },
 				},
 			},
 		},
@@ -255,7 +286,7 @@ func TestDeleteWhiteListAndCategories(t *testing.T) {
 		WithArgs(user.Id, budget.Request.Remove.WhiteList[2].Id).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err := models.Delete(app, user.Id, budget)
+	err := (&models.SQLBudgetStore{DB: app.DB.Client}).Delete(user.Id, budget)
 	test.ModelMethod(t, err, "delete")
 	test.MockExpectations(t, app)
 }
@@ -290,7 +321,7 @@ func TestGetBudget(t *testing.T) {
 		ExpectQuery(query2).
 		WillReturnRows(rows2)
 		
-	budget, err := models.GetBudget(app, user.Id)
+	budget, err := app.Budgets.Get(user.Id)
 	test.ModelMethod(t, err, "select")
 	test.MockExpectations(t, app)
 
@@ -303,6 +334,35 @@ func TestGetBudget(t *testing.T) {
 	}
 }
 
+func TestAddSpending(t *testing.T) {
+	budget := models.Budget {
+		Categories: []models.Category {
+			{ Name: "shopping", Budget: 200, Id: "shopping", WhiteList: testBudget.Categories[0].WhiteList },
+			{ Name: "groceries", Budget: 250, Id: "groceries", WhiteList: testBudget.Categories[1].WhiteList },
+		},
+	}
+
+	transactions := []plaid.Transaction {
+		{ Name: "AMAZON MKTPLACE PMTS", Amount: 50.25 },
+		{ Name: "BEST BUY 00123", MerchantName: "Best Buy", Amount: 100 },
+		{ Name: "ALDI 4456", Amount: 30 },
+		{ Name: "Amazon", Amount: -10 },
+		{ Name: "Uber 063015 SF**POOL**", Amount: 5.4 },
+	}
+
+	models.AddSpending(&budget, transactions)
+
+	if budget.Categories[0].Spent != 140.25 || budget.Categories[0].Remaining != 59.75 {
+		t.Fatalf("Shopping spending was calculated incorrectly, got: %v spent, %v remaining",
+			budget.Categories[0].Spent, budget.Categories[0].Remaining)
+	}
+
+	if budget.Categories[1].Spent != 30 || budget.Categories[1].Remaining != 220 {
+		t.Fatalf("Groceries spending was calculated incorrectly, got: %v spent, %v remaining",
+			budget.Categories[1].Spent, budget.Categories[1].Remaining)
+	}
+}
+
 // * Test Failure
 
 func TestUpdateFailure(t *testing.T) {
@@ -329,7 +389,7 @@ func TestUpdateFailure(t *testing.T) {
 		ExpectExec().
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := testBudget.Update(app, user.Id)
+	err := app.Budgets.Update(user.Id, &testBudget)
 	if err != nil {
 		return
 	}
@@ -345,11 +405,11 @@ func TestDeleteFailure(t *testing.T) {
 		Request: models.UpdateRequest {  
 			Remove: models.UpdateObject {
 				Categories: []models.Category {
-					{ "Shopping", 400, "cid123", []models.WhiteListItem {}, "#ff5757" },
+					{ Name: "Shopping", Budget: 400, Id: "cid123", WhiteList: []models.WhiteListItem {}, Color: "#ff5757" },
 				},
 				WhiteList: []models.WhiteListItem {
-					{ "cid123", "Calvin Klein", "something" },
-					{ "cid123", "Ralph Lauren", "nothing" },
+					{ Category: "cid123", Name: "Calvin Klein", Id: "something" },
+					{ Category: "cid123", Name: "Ralph Lauren", Id: "nothing" },
 				},
 			},
 		},
@@ -367,7 +427,7 @@ func TestDeleteFailure(t *testing.T) {
 		WithArgs("not the right id", budget.Request.Remove.Categories[0].Id).
 		WillReturnResult(sqlmock.NewResult(0, 3))
 
-	err := models.Delete(app, user.Id, budget)
+	err := (&models.SQLBudgetStore{DB: app.DB.Client}).Delete(user.Id, budget)
 	if err != nil {
 		return
 	}
@@ -405,7 +465,7 @@ func TestGetBudgetFailure(t *testing.T) {
 		ExpectQuery(query2).
 		WillReturnRows(rows2)
 		
-	_, err := models.GetBudget(app, "sup")
+	_, err := app.Budgets.Get("sup")
 	test.ModelMethodFailure(t, err)
 	test.MockFailure(t, app)
 }
\ No newline at end of file
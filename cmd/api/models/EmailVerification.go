@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+)
+
+// SQLEmailVerificationStore stores email verifications in the email_verifications table
+type SQLEmailVerificationStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Create inserts the email verification. Any problem with the query or database connection will
+// be reflected in the returned error.
+func (m *SQLEmailVerificationStore) Create(verification *EmailVerification) error {
+	query := "INSERT INTO email_verifications(tokenHash, userId, created, expires, used) VALUES(?,?,?,?,?)"
+	if _, err := m.DB.Exec(
+		m.Dialect.Rebind(query),
+		verification.TokenHash,
+		verification.UserId,
+		verification.Created,
+		verification.Expires,
+		verification.Used,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Consume uses the verification token with the given hash and returns the id of its user. Every
+// other token of the user is used along with it. If the token can't be used, or another request
+// used a token of the user first, ErrInvalidVerificationToken is returned.
+func (m *SQLEmailVerificationStore) Consume(tokenHash string) (string, error) {
+	var verification EmailVerification
+	query := "SELECT userId, expires, used FROM email_verifications WHERE tokenHash = ?"
+	err := m.DB.QueryRow(m.Dialect.Rebind(query), tokenHash).Scan(&verification.UserId, &verification.Expires, &verification.Used)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidVerificationToken
+	} else if err != nil {
+		return "", err
+	}
+
+	if verification.Used || verification.Expires <= time.Now().Unix() {
+		return "", ErrInvalidVerificationToken
+	}
+
+	// the token is only used if no other request used it in the meantime
+	query = "UPDATE email_verifications SET used = TRUE WHERE userId = ? AND used = FALSE"
+	res, err := m.DB.Exec(m.Dialect.Rebind(query), verification.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return "", err
+	} else if affected == 0 {
+		return "", ErrInvalidVerificationToken
+	}
+
+	return verification.UserId, nil
+}
+
+// CountSince returns how many verification emails were sent to the user since the given unix
+// time, which is used to throttle resending them
+func (m *SQLEmailVerificationStore) CountSince(userId string, since int64) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM email_verifications WHERE userId = ? AND created >= ?"
+	if err := m.DB.QueryRow(m.Dialect.Rebind(query), userId, since).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
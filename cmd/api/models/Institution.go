@@ -0,0 +1,27 @@
+package models
+
+// Institution describes a bank the user linked, along with the health of its connection. It is
+// what the client sees of a Token, so it must never contain the access token itself.
+type Institution struct {
+	ItemId         string `json:"itemId"`             // id of the item, used to update or unlink it
+	Name           string `json:"name"`               // name of the institution
+	Logo           string `json:"logo,omitempty"`     // base64 encoded png of the institution's logo
+	Color          string `json:"color,omitempty"`    // primary color of the institution
+	LastSync       int64  `json:"lastSync,omitempty"` // unix time of the last successful sync
+	Status         string `json:"status,omitempty"`   // plaid code describing why the item needs attention
+	UpdateRequired bool   `json:"updateRequired"`     // whether the user has to log in again through link
+}
+
+// NewInstitution creates the institution describing the token
+func NewInstitution(token *Token) Institution {
+	return Institution{
+		ItemId:   token.Id,
+		Name:     token.Institution,
+		LastSync: token.LastSync,
+		Status:   token.Status,
+		UpdateRequired:
+			token.Status == "ITEM_LOGIN_REQUIRED" ||
+			token.Status == "PENDING_EXPIRATION" ||
+			token.Status == "USER_PERMISSION_REVOKED",
+	}
+}
@@ -0,0 +1,850 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// memory holds the data of every memory store. The stores share it so that they can depend on
+// each other's data the same way the tables do (e.g. deleting an item deletes its transactions).
+type memory struct {
+	mutex         sync.Mutex
+	users         map[string]User              // users by email
+	tokens        map[string]memoryToken       // tokens by item id
+	categories    map[string][]Category        // categories by user id, in the order they were added
+	whitelist     map[string][]WhiteListItem   // whitelist items by user id, in the order they were added
+	sessions      map[string]Session           // sessions by id
+	transactions  map[string]memoryTransaction // transactions by id
+	resets        map[string]PasswordReset     // password resets by token hash
+	verifications map[string]EmailVerification // email verifications by token hash
+	twoFactor     map[string]TwoFactor         // TOTP secrets by user id
+	recoveryCodes map[string]map[string]bool   // whether each recovery code was used, by user id and code hash
+	attempts      map[string][]int64           // times the codes were tried at, by user id
+	challenges    map[string]LoginChallenge    // login challenges by token hash
+}
+
+// memoryToken is a token along with the user that owns it
+type memoryToken struct {
+	userId string
+	token  Token
+}
+
+// memoryTransaction is a transaction along with the user and item it belongs to
+type memoryTransaction struct {
+	userId      string
+	itemId      string
+	transaction plaid.Transaction
+}
+
+// NewMemoryStores returns stores that keep every piece of data in memory. They behave like the
+// SQL stores and are meant for tests and local development, everything is lost on restart.
+func NewMemoryStores() Stores {
+	m := &memory{
+		users:         make(map[string]User),
+		tokens:        make(map[string]memoryToken),
+		categories:    make(map[string][]Category),
+		whitelist:     make(map[string][]WhiteListItem),
+		sessions:      make(map[string]Session),
+		transactions:  make(map[string]memoryTransaction),
+		resets:        make(map[string]PasswordReset),
+		verifications: make(map[string]EmailVerification),
+		twoFactor:     make(map[string]TwoFactor),
+		recoveryCodes: make(map[string]map[string]bool),
+		attempts:      make(map[string][]int64),
+		challenges:    make(map[string]LoginChallenge),
+	}
+
+	return Stores{
+		Users:         &memoryUserStore{m},
+		Tokens:        &memoryTokenStore{m},
+		Budgets:       &memoryBudgetStore{m},
+		Sessions:      &memorySessionStore{m},
+		Transactions:  &memoryTransactionStore{m},
+		Resets:        &memoryPasswordResetStore{m},
+		Verifications: &memoryEmailVerificationStore{m},
+		TwoFactor:     &memoryTwoFactorStore{m},
+		Challenges:    &memoryLoginChallengeStore{m},
+	}
+}
+
+// * Users
+
+type memoryUserStore struct {
+	*memory
+}
+
+func (m *memoryUserStore) Create(user *User) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.users[user.Email]; ok {
+		return errors.New("a user with the email already exists")
+	}
+
+	// users are always created unverified, like in the userinfo table
+	stored := *user
+	stored.Verified = false
+	m.users[user.Email] = stored
+	return nil
+}
+
+func (m *memoryUserStore) Exists(email string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, ok := m.users[email]
+	return ok
+}
+
+func (m *memoryUserStore) GetCredentials(email string) (User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+
+	return User{Email: user.Email, Password: user.Password, Id: user.Id}, nil
+}
+
+func (m *memoryUserStore) SetPassword(userId, password string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for email, user := range m.users {
+		if user.Id == userId {
+			user.Password = password
+			m.users[email] = user
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (m *memoryUserStore) Get(userId string) (User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, user := range m.users {
+		if user.Id == userId {
+			user.Password = ""
+			return user, nil
+		}
+	}
+
+	return User{}, sql.ErrNoRows
+}
+
+func (m *memoryUserStore) SetVerified(userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for email, user := range m.users {
+		if user.Id == userId {
+			user.Verified = true
+			m.users[email] = user
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+// * Tokens
+
+type memoryTokenStore struct {
+	*memory
+}
+
+func (m *memoryTokenStore) Add(userId string, token *Token) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.tokens[token.Id]; ok {
+		return errors.New("the item is already linked")
+	}
+
+	m.tokens[token.Id] = memoryToken{userId: userId, token: *token}
+	return nil
+}
+
+func (m *memoryTokenStore) Update(userId string, token *Token) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.tokens[token.Id]; ok && stored.userId == userId {
+		stored.token.Value = token.Value
+		m.tokens[token.Id] = stored
+	}
+
+	return nil
+}
+
+func (m *memoryTokenStore) List(userId string) ([]*Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tokens := make([]*Token, 0)
+	for _, stored := range m.tokens {
+		if stored.userId == userId {
+			token := stored.token
+			tokens = append(tokens, &token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Id < tokens[j].Id })
+	return tokens, nil
+}
+
+func (m *memoryTokenStore) Get(userId string, token *Token) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.tokens[token.Id]
+	if !ok || stored.userId != userId {
+		return sql.ErrNoRows
+	}
+
+	*token = stored.token
+	return nil
+}
+
+func (m *memoryTokenStore) GetByItem(token *Token) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.tokens[token.Id]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	*token = stored.token
+	return stored.userId, nil
+}
+
+func (m *memoryTokenStore) Delete(userId string, token *Token) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, stored := range m.transactions {
+		if stored.itemId == token.Id && stored.userId == userId {
+			delete(m.transactions, id)
+		}
+	}
+
+	if stored, ok := m.tokens[token.Id]; ok && stored.userId == userId {
+		delete(m.tokens, token.Id)
+	}
+
+	return nil
+}
+
+func (m *memoryTokenStore) SetStatus(itemId, status string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.tokens[itemId]; ok {
+		stored.token.Status = status
+		m.tokens[itemId] = stored
+	}
+
+	return nil
+}
+
+func (m *memoryTokenStore) SetCursor(itemId, cursor string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.tokens[itemId]; ok {
+		stored.token.Cursor = cursor
+		stored.token.LastSync = time.Now().Unix()
+		m.tokens[itemId] = stored
+	}
+
+	return nil
+}
+
+// * Budgets
+
+type memoryBudgetStore struct {
+	*memory
+}
+
+func (m *memoryBudgetStore) Get(userId string) (Budget, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var budget Budget
+	for _, category := range m.categories[userId] {
+		category.WhiteList = nil
+		for _, item := range m.whitelist[userId] {
+			if item.Category == category.Id {
+				category.WhiteList = append(category.WhiteList, item)
+			}
+		}
+
+		budget.Categories = append(budget.Categories, category)
+	}
+
+	return budget, nil
+}
+
+func (m *memoryBudgetStore) Update(userId string, budget *Budget) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// add or replace categories and whitelist items by id
+	for _, category := range budget.Request.Update.Categories {
+		category.WhiteList = nil
+		m.categories[userId] = upsertCategory(m.categories[userId], category)
+	}
+
+	for _, item := range budget.Request.Update.WhiteList {
+		m.whitelist[userId] = upsertWhiteListItem(m.whitelist[userId], item)
+	}
+
+	// deleting a category deletes every whitelist item in it
+	deleted := make(map[string]bool)
+	for _, category := range budget.Request.Remove.Categories {
+		deleted[category.Id] = true
+	}
+
+	removed := make(map[string]bool)
+	for _, item := range budget.Request.Remove.WhiteList {
+		removed[item.Id] = true
+	}
+
+	categories := make([]Category, 0)
+	for _, category := range m.categories[userId] {
+		if !deleted[category.Id] {
+			categories = append(categories, category)
+		}
+	}
+	m.categories[userId] = categories
+
+	whitelist := make([]WhiteListItem, 0)
+	for _, item := range m.whitelist[userId] {
+		if !deleted[item.Category] && !removed[item.Id] {
+			whitelist = append(whitelist, item)
+		}
+	}
+	m.whitelist[userId] = whitelist
+
+	return nil
+}
+
+// upsertCategory replaces the category with the same id, or adds it if there is none
+func upsertCategory(categories []Category, category Category) []Category {
+	for i := range categories {
+		if categories[i].Id == category.Id {
+			categories[i] = category
+			return categories
+		}
+	}
+
+	return append(categories, category)
+}
+
+// upsertWhiteListItem replaces the item with the same id, or adds it if there is none
+func upsertWhiteListItem(whitelist []WhiteListItem, item WhiteListItem) []WhiteListItem {
+	for i := range whitelist {
+		if whitelist[i].Id == item.Id {
+			whitelist[i] = item
+			return whitelist
+		}
+	}
+
+	return append(whitelist, item)
+}
+
+// * Sessions
+
+type memorySessionStore struct {
+	*memory
+}
+
+func (m *memorySessionStore) Create(session *Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.sessions[session.Id]; ok {
+		return errors.New("the session already exists")
+	}
+
+	m.sessions[session.Id] = *session
+	return nil
+}
+
+func (m *memorySessionStore) Get(session *Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.sessions[session.Id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	*session = stored
+	return nil
+}
+
+func (m *memorySessionStore) Rotate(session *Session, refresh string, expires int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.sessions[session.Id]
+	if !ok || stored.Revoked || stored.Refresh != session.Refresh {
+		return ErrSessionRotated
+	}
+
+	stored.Refresh, stored.Expires = refresh, expires
+	m.sessions[session.Id] = stored
+
+	session.Refresh, session.Expires = refresh, expires
+	return nil
+}
+
+func (m *memorySessionStore) Revoke(session *Session) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.sessions[session.Id]; ok && stored.UserId == session.UserId {
+		stored.Revoked = true
+		m.sessions[session.Id] = stored
+	}
+
+	session.Revoked = true
+	return nil
+}
+
+func (m *memorySessionStore) RevokeAll(userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, stored := range m.sessions {
+		if stored.UserId == userId {
+			stored.Revoked = true
+			m.sessions[id] = stored
+		}
+	}
+
+	return nil
+}
+
+func (m *memorySessionStore) IsActive(id, userId string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.sessions[id]
+	if !ok || stored.UserId != userId {
+		return false, sql.ErrNoRows
+	}
+
+	return !stored.Revoked && stored.Expires > time.Now().Unix(), nil
+}
+
+// * Password resets
+
+type memoryPasswordResetStore struct {
+	*memory
+}
+
+func (m *memoryPasswordResetStore) Create(reset *PasswordReset) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.resets[reset.TokenHash]; ok {
+		return errors.New("the reset token already exists")
+	}
+
+	m.resets[reset.TokenHash] = *reset
+	return nil
+}
+
+func (m *memoryPasswordResetStore) Consume(tokenHash string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	reset, ok := m.resets[tokenHash]
+	if !ok || reset.Used || reset.Expires <= time.Now().Unix() {
+		return "", ErrInvalidResetToken
+	}
+
+	for hash, stored := range m.resets {
+		if stored.UserId == reset.UserId {
+			stored.Used = true
+			m.resets[hash] = stored
+		}
+	}
+
+	return reset.UserId, nil
+}
+
+func (m *memoryPasswordResetStore) CreateLimited(reset *PasswordReset, limits ...ResetLimit) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, limit := range limits {
+		since := reset.Created - int64(limit.Window/time.Second)
+		count := 0
+		for _, stored := range m.resets {
+			if stored.UserId == reset.UserId && stored.Created >= since {
+				count++
+			}
+		}
+
+		if count >= limit.Count {
+			return ErrTooManyResets
+		}
+	}
+
+	if _, ok := m.resets[reset.TokenHash]; ok {
+		return errors.New("the reset token already exists")
+	}
+
+	m.resets[reset.TokenHash] = *reset
+	return nil
+}
+
+// * Email verifications
+
+type memoryEmailVerificationStore struct {
+	*memory
+}
+
+func (m *memoryEmailVerificationStore) Create(verification *EmailVerification) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.verifications[verification.TokenHash]; ok {
+		return errors.New("the verification token already exists")
+	}
+
+	m.verifications[verification.TokenHash] = *verification
+	return nil
+}
+
+func (m *memoryEmailVerificationStore) Consume(tokenHash string) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	verification, ok := m.verifications[tokenHash]
+	if !ok || verification.Used || verification.Expires <= time.Now().Unix() {
+		return "", ErrInvalidVerificationToken
+	}
+
+	for hash, stored := range m.verifications {
+		if stored.UserId == verification.UserId {
+			stored.Used = true
+			m.verifications[hash] = stored
+		}
+	}
+
+	return verification.UserId, nil
+}
+
+func (m *memoryEmailVerificationStore) CountSince(userId string, since int64) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	count := 0
+	for _, stored := range m.verifications {
+		if stored.UserId == userId && stored.Created >= since {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// * Two factor authentication
+
+type memoryTwoFactorStore struct {
+	*memory
+}
+
+func (m *memoryTwoFactorStore) Get(userId string) (TwoFactor, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	twoFactor, ok := m.twoFactor[userId]
+	if !ok {
+		return TwoFactor{}, sql.ErrNoRows
+	}
+
+	return twoFactor, nil
+}
+
+func (m *memoryTwoFactorStore) Enroll(twoFactor *TwoFactor) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.twoFactor[twoFactor.UserId]; ok && stored.Enabled {
+		return errors.New("two factor authentication is already enabled")
+	}
+
+	m.twoFactor[twoFactor.UserId] = TwoFactor{UserId: twoFactor.UserId, Secret: twoFactor.Secret}
+	return nil
+}
+
+func (m *memoryTwoFactorStore) Enable(userId string, step int64, codeHashes []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.twoFactor[userId]
+	if !ok || stored.Enabled {
+		return sql.ErrNoRows
+	}
+
+	stored.Enabled = true
+	stored.LastStep = step
+	m.twoFactor[userId] = stored
+	m.replaceRecoveryCodes(userId, codeHashes)
+	return nil
+}
+
+func (m *memoryTwoFactorStore) UseStep(userId string, step int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.twoFactor[userId]
+	if !ok || !stored.Enabled || stored.LastStep >= step {
+		return ErrCodeUsed
+	}
+
+	stored.LastStep = step
+	m.twoFactor[userId] = stored
+	return nil
+}
+
+func (m *memoryTwoFactorStore) UseRecoveryCode(userId, codeHash string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	used, ok := m.recoveryCodes[userId][codeHash]
+	if !ok || used {
+		return ErrInvalidRecoveryCode
+	}
+
+	m.recoveryCodes[userId][codeHash] = true
+	return nil
+}
+
+func (m *memoryTwoFactorStore) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.replaceRecoveryCodes(userId, codeHashes)
+	return nil
+}
+
+func (m *memoryTwoFactorStore) Disable(userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.twoFactor, userId)
+	delete(m.recoveryCodes, userId)
+	return nil
+}
+
+func (m *memoryTwoFactorStore) AddAttempt(userId string, at int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.attempts[userId] = append(m.attempts[userId], at)
+	return nil
+}
+
+func (m *memoryTwoFactorStore) CountAttempts(userId string, since int64) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	count := 0
+	for _, at := range m.attempts[userId] {
+		if at >= since {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *memoryTwoFactorStore) ClearAttempts(userId string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.attempts, userId)
+	return nil
+}
+
+// replaceRecoveryCodes replaces the recovery codes of the user, the mutex must be held
+func (m *memoryTwoFactorStore) replaceRecoveryCodes(userId string, codeHashes []string) {
+	codes := make(map[string]bool)
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+
+	m.recoveryCodes[userId] = codes
+}
+
+type memoryLoginChallengeStore struct {
+	*memory
+}
+
+func (m *memoryLoginChallengeStore) Create(challenge *LoginChallenge) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.challenges[challenge.TokenHash]; ok {
+		return errors.New("the challenge token already exists")
+	}
+
+	m.challenges[challenge.TokenHash] = *challenge
+	return nil
+}
+
+func (m *memoryLoginChallengeStore) Attempt(tokenHash string, maxAttempts int) (string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	challenge, ok := m.challenges[tokenHash]
+	if !ok || challenge.Attempts >= maxAttempts || challenge.Expires <= time.Now().Unix() {
+		return "", ErrInvalidChallenge
+	}
+
+	challenge.Attempts++
+	m.challenges[tokenHash] = challenge
+	return challenge.UserId, nil
+}
+
+func (m *memoryLoginChallengeStore) Complete(tokenHash string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.challenges[tokenHash]; !ok {
+		return ErrInvalidChallenge
+	}
+
+	delete(m.challenges, tokenHash)
+	return nil
+}
+
+// * Transactions
+
+type memoryTransactionStore struct {
+	*memory
+}
+
+func (m *memoryTransactionStore) Save(userId, itemId string, transactions []plaid.Transaction) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, transaction := range transactions {
+		m.transactions[transaction.ID] = memoryTransaction{userId, itemId, transaction}
+	}
+
+	return nil
+}
+
+func (m *memoryTransactionStore) Remove(itemId string, ids []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, id := range ids {
+		if stored, ok := m.transactions[id]; ok && stored.itemId == itemId {
+			delete(m.transactions, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryTransactionStore) Ids(itemId, startDate, endDate string) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ids := make([]string, 0)
+	for id, stored := range m.transactions {
+		date := stored.transaction.Date
+		if stored.itemId == itemId && date >= startDate && date <= endDate {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *memoryTransactionStore) List(userId, startDate, endDate string) ([]plaid.Transaction, error) {
+	page, err := m.Find(userId, TransactionFilter{StartDate: startDate, EndDate: endDate})
+	return page.Transactions, err
+}
+
+// Find filters the transactions the same way the SQL store does. A limit below 1 returns every
+// matching transaction.
+func (m *memoryTransactionStore) Find(userId string, filter TransactionFilter) (TransactionPage, error) {
+	var cursorDate, cursorId string
+	if len(filter.Cursor) > 0 {
+		var err error
+		if cursorDate, cursorId, err = DecodeTransactionCursor(filter.Cursor); err != nil {
+			return TransactionPage{}, err
+		}
+	}
+
+	accounts := make(map[string]bool)
+	for _, id := range filter.AccountIds {
+		accounts[id] = true
+	}
+
+	m.mutex.Lock()
+	transactions := make([]plaid.Transaction, 0)
+	for _, stored := range m.transactions {
+		transaction := stored.transaction
+		switch {
+		case stored.userId != userId:
+		case transaction.Date < filter.StartDate || transaction.Date > filter.EndDate:
+		case len(accounts) > 0 && !accounts[transaction.AccountID]:
+		case len(filter.Category) > 0 && !hasCategory(transaction, filter.Category):
+		case filter.MinAmount != nil && transaction.Amount < *filter.MinAmount:
+		case filter.MaxAmount != nil && transaction.Amount > *filter.MaxAmount:
+		case len(cursorDate) > 0 && !(transaction.Date < cursorDate || (transaction.Date == cursorDate && transaction.ID > cursorId)):
+		default:
+			transactions = append(transactions, transaction)
+		}
+	}
+	m.mutex.Unlock()
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if transactions[i].Date != transactions[j].Date {
+			return transactions[i].Date > transactions[j].Date
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	page := TransactionPage{Transactions: transactions}
+	if filter.Limit > 0 && len(transactions) > filter.Limit {
+		page.Transactions = transactions[:filter.Limit]
+		last := page.Transactions[len(page.Transactions)-1]
+		page.Next = EncodeTransactionCursor(last.Date, last.ID)
+	}
+
+	return page, nil
+}
+
+// hasCategory checks whether the category is at any level of the transaction's hierarchy
+func hasCategory(transaction plaid.Transaction, category string) bool {
+	for _, c := range transaction.Category {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package models_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+)
+
+func TestMemorySessions(t *testing.T) {
+	stores := models.NewMemoryStores()
+	session := models.Session{Id: "session", UserId: user.Id, Refresh: "hash", Expires: time.Now().Add(time.Hour).Unix()}
+	if err := stores.Sessions.Create(&session); err != nil {
+		t.Fatal("Failed to create the session:", err)
+	}
+
+	// a refresh token can only be rotated by whoever read the current one
+	stale := session
+	if err := stores.Sessions.Rotate(&session, "newhash", session.Expires); err != nil {
+		t.Fatal("Failed to rotate the session:", err)
+	}
+
+	if err := stores.Sessions.Rotate(&stale, "otherhash", stale.Expires); err != models.ErrSessionRotated {
+		t.Error("A rotated refresh token should not be rotated again, got:", err)
+	}
+
+	if active, err := stores.Sessions.IsActive(session.Id, user.Id); err != nil || !active {
+		t.Error("The session should be active:", err)
+	}
+
+	stores.Sessions.RevokeAll(user.Id)
+	if active, _ := stores.Sessions.IsActive(session.Id, user.Id); active {
+		t.Error("The session should have been revoked")
+	}
+
+	if err := stores.Sessions.Get(&models.Session{Id: "unknown"}); err != sql.ErrNoRows {
+		t.Error("Unknown sessions should not be found, got:", err)
+	}
+}
+
+func TestMemoryTokens(t *testing.T) {
+	stores := models.NewMemoryStores()
+	stores.Tokens.Add(user.Id, &token)
+
+	// items are only visible to the user that linked them
+	if err := stores.Tokens.Get("otheruser", &models.Token{Id: token.Id}); err != sql.ErrNoRows {
+		t.Error("Another user should not get the item, got:", err)
+	}
+
+	stores.Tokens.SetStatus(token.Id, "ITEM_LOGIN_REQUIRED")
+	stored := models.Token{Id: token.Id}
+	userId, err := stores.Tokens.GetByItem(&stored)
+	if err != nil || userId != user.Id || stored.Value != token.Value || stored.Status != "ITEM_LOGIN_REQUIRED" {
+		t.Error("Unexpected item:", userId, stored, err)
+	}
+
+	stores.Tokens.Delete(user.Id, &token)
+	if tokens, _ := stores.Tokens.List(user.Id); len(tokens) != 0 {
+		t.Error("The item was not deleted")
+	}
+}
+
+func TestMemoryTransactions(t *testing.T) {
+	stores := models.NewMemoryStores()
+	stores.Transactions.Save(user.Id, token.Id, testTransactions)
+
+	transactions, err := stores.Transactions.List(user.Id, "2017-01-01", "2017-01-31")
+	if err != nil || len(transactions) != 2 || transactions[0].ID != testTransactions[0].ID {
+		t.Fatal("Unexpected transactions:", transactions, err)
+	}
+
+	page, _ := stores.Transactions.Find(user.Id, models.TransactionFilter{
+		StartDate: "2017-01-01",
+		EndDate:   "2017-01-31",
+		Category:  "Restaurants",
+		Limit:     10,
+	})
+	if len(page.Transactions) != 1 || page.Transactions[0].ID != testTransactions[1].ID {
+		t.Error("The transactions were not filtered by category:", page.Transactions)
+	}
+
+	if _, err := stores.Transactions.Find(user.Id, models.TransactionFilter{Limit: 1, Cursor: "not a cursor"}); err != models.ErrInvalidCursor {
+		t.Error("An invalid cursor should fail, got:", err)
+	}
+
+	stores.Transactions.Remove(token.Id, []string{testTransactions[0].ID})
+	if ids, _ := stores.Transactions.Ids(token.Id, "2017-01-01", "2017-01-31"); len(ids) != 1 {
+		t.Error("The transaction was not removed:", ids)
+	}
+}
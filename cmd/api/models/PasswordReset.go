@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+)
+
+// SQLPasswordResetStore stores password resets in the password_resets table
+type SQLPasswordResetStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Create inserts the password reset. Any problem with the query or database connection will be
+// reflected in the returned error.
+func (m *SQLPasswordResetStore) Create(reset *PasswordReset) error {
+	query := "INSERT INTO password_resets(tokenHash, userId, created, expires, used) VALUES(?,?,?,?,?)"
+	if _, err := m.DB.Exec(m.Dialect.Rebind(query), reset.TokenHash, reset.UserId, reset.Created, reset.Expires, reset.Used); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Consume uses the reset token with the given hash and returns the id of its user. Every other
+// token of the user is used along with it, so only one reset can happen per request. If the
+// token can't be used, or another request used a token of the user first, ErrInvalidResetToken
+// is returned.
+func (m *SQLPasswordResetStore) Consume(tokenHash string) (string, error) {
+	var reset PasswordReset
+	query := "SELECT userId, expires, used FROM password_resets WHERE tokenHash = ?"
+	err := m.DB.QueryRow(m.Dialect.Rebind(query), tokenHash).Scan(&reset.UserId, &reset.Expires, &reset.Used)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidResetToken
+	} else if err != nil {
+		return "", err
+	}
+
+	if reset.Used || reset.Expires <= time.Now().Unix() {
+		return "", ErrInvalidResetToken
+	}
+
+	// the token is only used if no other request used it in the meantime
+	query = "UPDATE password_resets SET used = TRUE WHERE userId = ? AND used = FALSE"
+	res, err := m.DB.Exec(m.Dialect.Rebind(query), reset.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return "", err
+	} else if affected == 0 {
+		return "", ErrInvalidResetToken
+	}
+
+	return reset.UserId, nil
+}
+
+// CreateLimited inserts the password reset unless it would go over one of the limits of the user,
+// in which case ErrTooManyResets is returned. The resets of the user are counted and the new one is
+// inserted in one transaction that holds the row of the user, so concurrent requests of the same
+// user wait for each other instead of both passing the limits. SQLite has no row locks, but only
+// one transaction can write at a time, so the second request fails to insert instead.
+func (m *SQLPasswordResetStore) CreateLimited(reset *PasswordReset, limits ...ResetLimit) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	if m.Dialect != database.SQLite {
+		var id string
+		query := "SELECT id FROM userinfo WHERE id = ? FOR UPDATE"
+		if err := tx.QueryRow(m.Dialect.Rebind(query), reset.UserId).Scan(&id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, limit := range limits {
+		var count int
+		since := reset.Created - int64(limit.Window/time.Second)
+		query := "SELECT COUNT(*) FROM password_resets WHERE userId = ? AND created >= ?"
+		if err := tx.QueryRow(m.Dialect.Rebind(query), reset.UserId, since).Scan(&count); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if count >= limit.Count {
+			tx.Rollback()
+			return ErrTooManyResets
+		}
+	}
+
+	query := "INSERT INTO password_resets(tokenHash, userId, created, expires, used) VALUES(?,?,?,?,?)"
+	if _, err := tx.Exec(m.Dialect.Rebind(query), reset.TokenHash, reset.UserId, reset.Created, reset.Expires, reset.Used); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,63 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCreateLimitedReset(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	now := time.Now().Unix()
+	reset := models.PasswordReset{TokenHash: "hash", UserId: user.Id, Created: now, Expires: now + 3600}
+
+	// the row of the user is held while the resets are counted, so concurrent requests wait
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.
+		ExpectQuery(`SELECT id FROM userinfo WHERE id \= \? FOR UPDATE`).
+		WithArgs(user.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(user.Id))
+	app.DB.Mock.
+		ExpectQuery(`SELECT COUNT\(\*\) FROM password_resets WHERE userId \= \? AND created >\= \?`).
+		WithArgs(user.Id, now-60).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	app.DB.Mock.
+		ExpectExec(`INSERT INTO password_resets\(tokenHash, userId, created, expires, used\) VALUES\(\?,\?,\?,\?,\?\)`).
+		WithArgs("hash", user.Id, now, now+3600, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	app.DB.Mock.ExpectCommit()
+
+	err := app.Resets.CreateLimited(&reset, models.ResetLimit{Window: time.Minute, Count: 1})
+	test.ModelMethod(t, err, "insert")
+	test.MockExpectations(t, app)
+}
+
+func TestCreateLimitedResetThrottled(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	now := time.Now().Unix()
+	reset := models.PasswordReset{TokenHash: "hash", UserId: user.Id, Created: now, Expires: now + 3600}
+
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.
+		ExpectQuery(`SELECT id FROM userinfo WHERE id \= \? FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(user.Id))
+	app.DB.Mock.
+		ExpectQuery(`SELECT COUNT\(\*\) FROM password_resets WHERE userId \= \? AND created >\= \?`).
+		WithArgs(user.Id, now-60).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	app.DB.Mock.ExpectRollback()
+
+	err := app.Resets.CreateLimited(&reset, models.ResetLimit{Window: time.Minute, Count: 1})
+	if err != models.ErrTooManyResets {
+		t.Fatal("Expected the reset to be limited, got", err)
+	}
+	test.MockExpectations(t, app)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// plaidErrorStatus maps the plaid error types that are not the api's fault to the http status
+// they are responded with, every other plaid error is a bad gateway
+var plaidErrorStatus = map[string]int {
+	"RATE_LIMIT_EXCEEDED":	http.StatusTooManyRequests,
+	"INSTITUTION_ERROR":	http.StatusServiceUnavailable,
+}
+
+// AsPlaidError returns the plaid error that err is or wraps, if any
+func AsPlaidError(err error) (plaid.Error, bool) {
+	var plaidError plaid.Error
+	ok := errors.As(err, &plaidError)
+	return plaidError, ok
+}
+
+// PlaidErrorCode returns the code of the plaid error that err is or wraps, or an empty string if
+// err did not come from plaid
+func PlaidErrorCode(err error) string {
+	plaidError, _ := AsPlaidError(err)
+	return plaidError.ErrorCode
+}
+
+// NewPlaidError creates the api error describing why a plaid call made for the item failed, along
+// with the http status it should be responded with. The item id can be empty if the call was not
+// made for an item.
+func NewPlaidError(err error, itemId string) (int, *APIError) {
+	plaidError, ok := AsPlaidError(err)
+
+	// plaid could not be reached or did not respond with an error of its own
+	if !ok || len(plaidError.ErrorCode) == 0 {
+		return http.StatusBadGateway, &APIError{Code: CodePlaidUnavailable, ItemId: itemId}
+	}
+
+	status, ok := plaidErrorStatus[plaidError.ErrorType]
+	if !ok {
+		status = http.StatusBadGateway
+	}
+
+	return status, &APIError{
+		Code:           plaidError.ErrorCode,
+		Type:           plaidError.ErrorType,
+		Display:        plaidError.DisplayMessage,
+		ItemId:         itemId,
+		PlaidRequestId: plaidError.RequestID,
+	}
+}
+
+// CreatePlaidError creates an error JSON response for a failed plaid call made for the item, with
+// the plaid error code so that clients can tell, for example, when the user has to log in to
+// their bank again. The error is logged to the system.
+func CreatePlaidError(w http.ResponseWriter, r *http.Request, message string, err error, itemId string) {
+	status, apiError := NewPlaidError(err, itemId)
+	writeError(w, r, status, message, apiError, err)
+}
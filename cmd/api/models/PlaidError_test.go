@@ -0,0 +1,43 @@
+package models_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+func TestNewPlaidError(t *testing.T) {
+	loginRequired := plaid.Error{ErrorType: "ITEM_ERROR", ErrorCode: "ITEM_LOGIN_REQUIRED", DisplayMessage: "Log in again"}
+	loginRequired.RequestID = "request"
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"item error", loginRequired, http.StatusBadGateway, "ITEM_LOGIN_REQUIRED"},
+		{"wrapped error", fmt.Errorf("sync failed: %w", loginRequired), http.StatusBadGateway, "ITEM_LOGIN_REQUIRED"},
+		{"rate limit", plaid.Error{ErrorType: "RATE_LIMIT_EXCEEDED", ErrorCode: "ACCOUNTS_LIMIT"}, http.StatusTooManyRequests, "ACCOUNTS_LIMIT"},
+		{"institution down", plaid.Error{ErrorType: "INSTITUTION_ERROR", ErrorCode: "INSTITUTION_DOWN"}, http.StatusServiceUnavailable, "INSTITUTION_DOWN"},
+		{"not from plaid", errors.New("connection refused"), http.StatusBadGateway, models.CodePlaidUnavailable},
+	}
+
+	for _, test := range tests {
+		status, apiError := models.NewPlaidError(test.err, "item")
+		if status != test.status || apiError.Code != test.code || apiError.ItemId != "item" {
+			t.Errorf("%s: unexpected error %d %+v", test.name, status, apiError)
+		}
+	}
+
+	// everything plaid said about the error is kept
+	_, apiError := models.NewPlaidError(loginRequired, "")
+	if apiError.Type != "ITEM_ERROR" || apiError.Display != "Log in again" || apiError.PlaidRequestId != "request" {
+		t.Error("Unexpected error:", apiError)
+	}
+}
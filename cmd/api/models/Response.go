@@ -1,9 +1,13 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"log"
 	"net/http"
+	"regexp"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
 )
 
 // Response for use of json responses
@@ -11,70 +15,181 @@ type Response struct {
 	Status  int         `json:"status"`
 	Message string      `json:"message"`
 	Result  interface{} `json:"result,omitempty"`
+	Error   *APIError   `json:"error,omitempty"`
+	Errors  []*APIError `json:"errors,omitempty"` // failures that did not stop the result from being responded
+}
+
+// APIError describes why a request failed with a stable code, so clients can react to errors
+// without parsing the message
+type APIError struct {
+	Code           string       `json:"code"`                     // machine-readable error code (e.g. USER_EXISTS)
+	Type           string       `json:"type,omitempty"`           // category of plaid errors
+	Display        string       `json:"display,omitempty"`        // message that can be shown to the user, if any
+	ItemId         string       `json:"itemId,omitempty"`         // item the error happened for, if any
+	Details        []FieldError `json:"details,omitempty"`        // invalid fields of the request, if any
+	RequestId      string       `json:"requestId"`                // id of the request that failed
+	PlaidRequestId string       `json:"plaidRequestId,omitempty"` // id of the plaid request that failed, if any
+}
+
+// FieldError describes why a field of the request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error describes the field error as a sentence starting with the field name
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Error codes returned by the api. Errors that come from plaid use the plaid error code instead.
+const (
+	CodeInvalidBody         = "INVALID_BODY"
+	CodeInvalidQuery        = "INVALID_QUERY"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeUserExists          = "USER_EXISTS"
+	CodeUserNotFound        = "USER_NOT_FOUND"
+	CodeInvalidCredentials  = "INVALID_CREDENTIALS"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeNotSignedIn         = "NOT_SIGNED_IN"
+	CodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	CodeRefreshTokenReused  = "REFRESH_TOKEN_REUSED"
+	CodeSessionExpired      = "SESSION_EXPIRED"
+	CodeSessionFailed       = "SESSION_FAILED"
+	CodeInvalidResetToken   = "INVALID_RESET_TOKEN"
+	CodeInvalidVerification = "INVALID_VERIFICATION_TOKEN"
+	CodeAlreadyVerified     = "ALREADY_VERIFIED"
+	CodeEmailNotVerified    = "EMAIL_NOT_VERIFIED"
+	CodeTooManyRequests     = "TOO_MANY_REQUESTS"
+	CodeMailFailed          = "MAIL_FAILED"
+	CodeTwoFactorEnabled    = "TWO_FACTOR_ENABLED"
+	CodeTwoFactorNotEnabled = "TWO_FACTOR_NOT_ENABLED"
+	CodeInvalidTwoFactor    = "INVALID_TWO_FACTOR_CODE"
+	CodeInvalidChallenge    = "INVALID_CHALLENGE"
+	CodeItemNotFound        = "ITEM_NOT_FOUND"
+	CodeInvalidWebhook      = "INVALID_WEBHOOK"
+	CodeDatabaseError       = "DATABASE_ERROR"
+	CodePlaidUnavailable    = "PLAID_UNAVAILABLE"
+)
+
+// RequestIdHeader is the header the id of a request is read from and responded with
+const RequestIdHeader = "X-Request-Id"
+
+// validRequestId matches the request ids clients are allowed to choose
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestId returns the id of the request. Requests that went through the logging middleware
+// already have their id in their context, otherwise it is the one the client sent in the
+// X-Request-Id header if it is valid, or a new random id.
+func RequestId(r *http.Request) string {
+	if id, ok := r.Context().Value(Key("requestId")).(string); ok {
+		return id
+	}
+
+	if id := r.Header.Get(RequestIdHeader); validRequestId.MatchString(id) {
+		return id
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
 }
 
 // CreateResponse unction that creates and writes a JSON response that was successfully executed. This
 // function will always return the http status 200 (OK), and has the option to return a
 // result which can be any datatype
 func CreateResponse(w http.ResponseWriter, message string, result interface{}) {
+	CreateResponseWithStatus(w, http.StatusOK, message, result)
+}
+
+// CreateResponseWithStatus creates and writes a JSON response with a result and a custom http
+// status, for responses that describe a failure in their result rather than with an error code
+func CreateResponseWithStatus(w http.ResponseWriter, status int, message string, result interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 
 	encoder := json.NewEncoder(w)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	res := Response{
-		Status:  http.StatusOK,
+		Status:  status,
 		Message: message,
 		Result:  result,
 	}
 
 	err := encoder.Encode(res)
 	if err != nil {
-		log.Println("Failed to encode response")
+		logger.Default.Error("Failed to encode response", "error", err)
 		return
 	}
 }
 
-// CreateError this function is used to create an error JSON response with custom http statuses.
-// In addition to the status, this function also takes in an error that will be logged
-// to the system. This error can be nil
-func CreateError(w http.ResponseWriter, status int, message string, system error) {
-	if system != nil {
-		log.Println(system.Error())
+// CreatePartialResponse creates and writes a JSON response with a result that could only be
+// partly refreshed, along with the errors that describe what failed, such as the items whose
+// transactions could not be synced. The http status is 200 (OK), and the errors are left out when
+// there are none.
+func CreatePartialResponse(w http.ResponseWriter, r *http.Request, message string, result interface{}, errors []*APIError) {
+	requestId := RequestId(r)
+	for _, apiError := range errors {
+		apiError.RequestId = requestId
 	}
-	encoder := json.NewEncoder(w)
 
 	res := Response{
-		Status:  status,
+		Status:  http.StatusOK,
 		Message: message,
+		Result:  result,
+		Errors:  errors,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+	w.Header().Set(RequestIdHeader, requestId)
+	w.WriteHeader(http.StatusOK)
 
-	if err := encoder.Encode(res); err != nil {
-		log.Println("failed to encode response")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Default.Error("Failed to encode response", "error", err)
 		return
 	}
 }
 
-func CreateErrorWithResult(w http.ResponseWriter, status int, message string, system error, result interface{}) {
+// CreateError this function is used to create an error JSON response with custom http statuses
+// and the error code clients can react to. In addition to the status, this function also takes
+// in an error that will be logged to the system along with the request id. This error can be nil
+func CreateError(w http.ResponseWriter, r *http.Request, status int, code string, message string, system error) {
+	writeError(w, r, status, message, &APIError{Code: code}, system)
+}
+
+// CreateValidationError creates an error JSON response for a request with invalid fields, which
+// describes why each field is invalid. The http status will always be 400 (Bad Request).
+func CreateValidationError(w http.ResponseWriter, r *http.Request, code string, message string, details []FieldError) {
+	writeError(w, r, http.StatusBadRequest, message, &APIError{Code: code, Details: details}, nil)
+}
+
+// writeError logs the system error and writes the api error as a JSON response with the id of
+// the request, which is responded in the X-Request-Id header as well
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string, apiError *APIError, system error) {
+	apiError.RequestId = RequestId(r)
+	log := logger.FromContext(r.Context(), logger.Default).With("requestId", apiError.RequestId)
 	if system != nil {
-		log.Println(system.Error())
+		// failures of the api are errors, while failures caused by the client are only warnings
+		write := log.Warn
+		if status >= http.StatusInternalServerError {
+			write = log.Error
+		}
+		write(message, "status", status, "code", apiError.Code, "error", system)
 	}
 	encoder := json.NewEncoder(w)
 
 	res := Response{
 		Status:  status,
 		Message: message,
-		Result: result,
+		Error:   apiError,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(RequestIdHeader, apiError.RequestId)
 	w.WriteHeader(status)
 
 	if err := encoder.Encode(res); err != nil {
-		log.Println("failed to encode response")
+		log.Error("Failed to encode response", "error", err)
 		return
 	}
 }
@@ -0,0 +1,36 @@
+package models_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+)
+
+func TestCreateErrorRequestId(t *testing.T) {
+	// the request id the client sent is used
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(models.RequestIdHeader, "client-request-1")
+
+	res := httptest.NewRecorder()
+	models.CreateError(res, req, http.StatusBadGateway, models.CodeDatabaseError, "Failed", errors.New("failed"))
+
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+	if response.Error == nil || response.Error.Code != models.CodeDatabaseError || response.Error.RequestId != "client-request-1" {
+		t.Fatal("Unexpected error:", response.Error)
+	}
+
+	if res.Header().Get(models.RequestIdHeader) != "client-request-1" {
+		t.Error("The request id was not responded")
+	}
+
+	// ids that could be used to forge log lines are replaced
+	req.Header.Set(models.RequestIdHeader, "forged\nline")
+	if id := models.RequestId(req); len(id) != 32 {
+		t.Error("Unexpected request id:", id)
+	}
+}
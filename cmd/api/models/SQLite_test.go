@@ -0,0 +1,303 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// These tests run the SQL stores against a real SQLite database, which covers the queries that
+// are written differently for each database.
+
+func TestSQLiteBudget(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	update := models.Budget{
+		Request: models.UpdateRequest{
+			Update: models.UpdateObject{
+				Categories: []models.Category{
+					{Id: "shopping", Name: "Shopping", Budget: 200},
+					{Id: "rent", Name: "Rent", Budget: 800},
+				},
+				WhiteList: []models.WhiteListItem{
+					{Id: "amazon", Category: "shopping", Name: "Amazon"},
+					{Id: "rise", Category: "rent", Name: "The Rise"},
+				},
+			},
+		},
+	}
+
+	if err := app.Budgets.Update(user.Id, &update); err != nil {
+		t.Fatal("Failed to create the budget:", err)
+	}
+
+	// existing rows are replaced instead of failing
+	update.Request.Update.Categories[0].Budget = 300
+	if err := app.Budgets.Update(user.Id, &update); err != nil {
+		t.Fatal("Failed to update the budget:", err)
+	}
+
+	// deleting a category deletes its whitelist too
+	remove := models.Budget{
+		Request: models.UpdateRequest{
+			Remove: models.UpdateObject{Categories: []models.Category{{Id: "rent"}}},
+		},
+	}
+
+	if err := app.Budgets.Update(user.Id, &remove); err != nil {
+		t.Fatal("Failed to delete the category:", err)
+	}
+
+	budget, err := app.Budgets.Get(user.Id)
+	test.ModelMethod(t, err, "select")
+
+	categories := budget.Categories
+	if len(categories) != 1 || categories[0].Budget != 300 || len(categories[0].WhiteList) != 1 {
+		t.Fatal("Unexpected budget:", categories)
+	}
+}
+
+func TestSQLiteTransactions(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	if err := app.Transactions.Save(user.Id, token.Id, testTransactions); err != nil {
+		t.Fatal("Failed to save the transactions:", err)
+	}
+
+	// saving a modified transaction replaces it
+	posted := testTransactions[1]
+	posted.Pending = false
+	if err := app.Transactions.Save(user.Id, token.Id, []plaid.Transaction{posted}); err != nil {
+		t.Fatal("Failed to replace the transaction:", err)
+	}
+
+	page, err := app.Transactions.Find(user.Id, models.TransactionFilter{
+		StartDate: "2017-01-01",
+		EndDate:   "2017-01-31",
+		Category:  "Restaurants",
+		Limit:     10,
+	})
+	test.ModelMethod(t, err, "select")
+
+	if len(page.Transactions) != 1 || page.Transactions[0].ID != posted.ID || page.Transactions[0].Pending {
+		t.Fatal("Unexpected transactions:", page.Transactions)
+	}
+
+	// wildcards in the category are matched literally
+	page, _ = app.Transactions.Find(user.Id, models.TransactionFilter{
+		StartDate: "2017-01-01",
+		EndDate:   "2017-01-31",
+		Category:  "Restaurant_",
+		Limit:     10,
+	})
+	if len(page.Transactions) != 0 {
+		t.Fatal("The category should have been escaped:", page.Transactions)
+	}
+}
+
+func TestSQLiteTokensAndSessions(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	if err := app.Tokens.Add(user.Id, &token); err != nil {
+		t.Fatal("Failed to add the token:", err)
+	}
+
+	stored := models.Token{Id: token.Id}
+	test.ModelMethod(t, app.Tokens.Get(user.Id, &stored), "select")
+	if stored.Value != token.Value {
+		t.Fatal("The token was not decrypted:", stored.Value)
+	}
+
+	app.Transactions.Save(user.Id, token.Id, testTransactions)
+	test.ModelMethod(t, app.Tokens.Delete(user.Id, &token), "delete")
+	if ids, _ := app.Transactions.Ids(token.Id, "2017-01-01", "2017-01-31"); len(ids) != 0 {
+		t.Error("The transactions of the item were not deleted:", ids)
+	}
+
+	session := models.Session{Id: "session", UserId: user.Id, Refresh: "hash", Expires: time.Now().Add(time.Hour).Unix()}
+	test.ModelMethod(t, app.Sessions.Create(&session), "insert")
+	test.ModelMethod(t, app.Sessions.Rotate(&session, "newhash", session.Expires), "update")
+	test.ModelMethod(t, app.Sessions.RevokeAll(user.Id), "update")
+
+	if active, err := app.Sessions.IsActive(session.Id, user.Id); err != nil || active {
+		t.Error("The session should have been revoked:", err)
+	}
+}
+
+func TestSQLitePasswordResets(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	testUser := user
+	test.ModelMethod(t, app.Users.Create(&testUser), "insert")
+
+	now := time.Now()
+	expires := now.Add(time.Hour).Unix()
+	for _, reset := range []models.PasswordReset{
+		{TokenHash: "first", UserId: user.Id, Created: now.Unix(), Expires: expires},
+		{TokenHash: "second", UserId: user.Id, Created: now.Add(-time.Hour).Unix(), Expires: expires},
+		{TokenHash: "expired", UserId: user.Id, Expires: now.Add(-time.Minute).Unix()},
+	} {
+		test.ModelMethod(t, app.Resets.Create(&reset), "insert")
+	}
+
+	// only the first reset is within the minute, and only it and the new one within the hour
+	limits := []models.ResetLimit{{Window: time.Minute, Count: 1}, {Window: time.Hour, Count: 2}}
+	limited := models.PasswordReset{TokenHash: "limited", UserId: user.Id, Created: now.Unix(), Expires: expires}
+	if err := app.Resets.CreateLimited(&limited, limits...); err != models.ErrTooManyResets {
+		t.Fatal("Expected the reset within the minute to be limited, got", err)
+	}
+
+	limited.Created = now.Add(2 * time.Minute).Unix()
+	test.ModelMethod(t, app.Resets.CreateLimited(&limited, limits...), "insert")
+
+	limited.TokenHash, limited.Created = "hourly", now.Add(4*time.Minute).Unix()
+	if err := app.Resets.CreateLimited(&limited, limits...); err != models.ErrTooManyResets {
+		t.Fatal("Expected the third reset within the hour to be limited, got", err)
+	}
+
+	if _, err := app.Resets.Consume("expired"); err != models.ErrInvalidResetToken {
+		t.Fatal("Expired tokens should not be usable, got", err)
+	}
+
+	userId, err := app.Resets.Consume("first")
+	if err != nil || userId != user.Id {
+		t.Fatal("Failed to use the reset token:", userId, err)
+	}
+
+	// using a token uses every other token of the user
+	for _, hash := range []string{"first", "second", "unknown"} {
+		if _, err := app.Resets.Consume(hash); err != models.ErrInvalidResetToken {
+			t.Errorf("Token %q should not be usable, got %v", hash, err)
+		}
+	}
+
+	test.ModelMethod(t, app.Users.SetPassword(user.Id, "newhash"), "update")
+	if credentials, _ := app.Users.GetCredentials(user.Email); credentials.Password != "newhash" {
+		t.Error("The password was not replaced:", credentials.Password)
+	}
+}
+
+func TestSQLiteEmailVerifications(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	testUser := user
+	testUser.Verified = true
+	test.ModelMethod(t, app.Users.Create(&testUser), "insert")
+
+	// users are created unverified whatever they claim
+	stored, err := app.Users.Get(user.Id)
+	test.ModelMethod(t, err, "select")
+	if stored.Verified || stored.Email != user.Email || len(stored.Password) > 0 {
+		t.Fatal("Unexpected user:", stored)
+	}
+
+	now := time.Now()
+	for _, verification := range []models.EmailVerification{
+		{TokenHash: "old", UserId: user.Id, Created: now.Add(-2 * time.Hour).Unix(), Expires: now.Unix()},
+		{TokenHash: "new", UserId: user.Id, Created: now.Unix(), Expires: now.Add(time.Hour).Unix()},
+	} {
+		test.ModelMethod(t, app.Verifications.Create(&verification), "insert")
+	}
+
+	if count, err := app.Verifications.CountSince(user.Id, now.Add(-time.Hour).Unix()); err != nil || count != 1 {
+		t.Fatal("Expected one verification within the hour, got", count, err)
+	}
+
+	if _, err := app.Verifications.Consume("old"); err != models.ErrInvalidVerificationToken {
+		t.Fatal("Expired tokens should not be usable, got", err)
+	}
+
+	userId, err := app.Verifications.Consume("new")
+	if err != nil || userId != user.Id {
+		t.Fatal("Failed to use the verification token:", userId, err)
+	}
+
+	test.ModelMethod(t, app.Users.SetVerified(user.Id), "update")
+	if stored, _ := app.Users.Get(user.Id); !stored.Verified {
+		t.Error("The user was not verified")
+	}
+}
+
+func TestSQLiteTwoFactor(t *testing.T) {
+	app, closeDB := test.GetSQLiteApp()
+	defer closeDB()
+
+	test.ModelMethod(t, app.TwoFactor.Enroll(&models.TwoFactor{UserId: user.Id, Secret: "first"}), "insert")
+
+	// enrolling again replaces a secret that was not enabled
+	test.ModelMethod(t, app.TwoFactor.Enroll(&models.TwoFactor{UserId: user.Id, Secret: "JBSWY3DPEHPK3PXP"}), "insert")
+
+	// secrets are encrypted at rest
+	var stored string
+	app.DB.Client.QueryRow("SELECT secret FROM two_factor WHERE userId = ?", user.Id).Scan(&stored)
+	if len(stored) == 0 || strings.Contains(stored, "JBSWY3DPEHPK3PXP") {
+		t.Fatal("The secret was not encrypted:", stored)
+	}
+
+	test.ModelMethod(t, app.TwoFactor.Enable(user.Id, 100, []string{"code1", "code2"}), "update")
+	twoFactor, err := app.TwoFactor.Get(user.Id)
+	test.ModelMethod(t, err, "select")
+	if twoFactor.Secret != "JBSWY3DPEHPK3PXP" || !twoFactor.Enabled || twoFactor.LastStep != 100 {
+		t.Fatal("Unexpected two factor:", twoFactor)
+	}
+
+	// an enabled secret can't be replaced by enrolling
+	if err := app.TwoFactor.Enroll(&models.TwoFactor{UserId: user.Id, Secret: "other"}); err == nil {
+		t.Error("An enabled secret should not be replaced")
+	}
+
+	// steps can only be used once, and in order
+	if err := app.TwoFactor.UseStep(user.Id, 100); err != models.ErrCodeUsed {
+		t.Error("A used step should not be usable, got", err)
+	}
+	test.ModelMethod(t, app.TwoFactor.UseStep(user.Id, 101), "update")
+
+	test.ModelMethod(t, app.TwoFactor.UseRecoveryCode(user.Id, "code1"), "update")
+	if err := app.TwoFactor.UseRecoveryCode(user.Id, "code1"); err != models.ErrInvalidRecoveryCode {
+		t.Error("A used recovery code should not be usable, got", err)
+	}
+
+	test.ModelMethod(t, app.TwoFactor.Disable(user.Id), "delete")
+	if err := app.TwoFactor.UseRecoveryCode(user.Id, "code2"); err != models.ErrInvalidRecoveryCode {
+		t.Error("The recovery codes should have been deleted, got", err)
+	}
+
+	challenge := models.LoginChallenge{TokenHash: "challenge", UserId: user.Id, Expires: time.Now().Add(time.Minute).Unix()}
+	test.ModelMethod(t, app.Challenges.Create(&challenge), "insert")
+	for i := 0; i < 2; i++ {
+		if userId, err := app.Challenges.Attempt("challenge", 2); err != nil || userId != user.Id {
+			t.Fatal("Failed to attempt the challenge:", userId, err)
+		}
+	}
+
+	if _, err := app.Challenges.Attempt("challenge", 2); err != models.ErrInvalidChallenge {
+		t.Error("The challenge should have no attempts left, got", err)
+	}
+
+	test.ModelMethod(t, app.Challenges.Complete("challenge"), "delete")
+	if err := app.Challenges.Complete("challenge"); err != models.ErrInvalidChallenge {
+		t.Error("The challenge should only be completed once, got", err)
+	}
+
+	now := time.Now().Unix()
+	test.ModelMethod(t, app.TwoFactor.AddAttempt(user.Id, now-3600), "insert")
+	test.ModelMethod(t, app.TwoFactor.AddAttempt(user.Id, now), "insert")
+	if count, err := app.TwoFactor.CountAttempts(user.Id, now-60); err != nil || count != 1 {
+		t.Error("Expected 1 recent attempt, got", count, err)
+	}
+
+	test.ModelMethod(t, app.TwoFactor.ClearAttempts(user.Id), "delete")
+	if count, err := app.TwoFactor.CountAttempts(user.Id, 0); err != nil || count != 0 {
+		t.Error("Expected the attempts to be cleared, got", count, err)
+	}
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+)
+
+// TokenPair is the access and refresh token of a session, responded in the body to clients that
+// can't keep cookies, such as native apps. The access token is sent back in the Authorization
+// header as a bearer token.
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"` // always Bearer
+	ExpiresIn    int64  `json:"expiresIn"` // seconds until the access token expires
+}
+
+// SQLSessionStore stores sessions in the sessions table
+type SQLSessionStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Create inserts the session into the sessions table. Any problem with the query or database
+// connection will be reflected in the returned error.
+func (m *SQLSessionStore) Create(s *Session) error {
+	query := "INSERT INTO sessions(id, userId, refreshToken, expires, revoked) VALUES(?,?,?,?,?)"
+	stmt, err := m.DB.Prepare(m.Dialect.Rebind(query))
+	if err != nil {
+		return err
+	}
+
+	if _, err := stmt.Exec(s.Id, s.UserId, s.Refresh, s.Expires, s.Revoked); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get fills the session with the row that has the same id as the given session. If the
+// session does not exist the error will be sql.ErrNoRows.
+func (m *SQLSessionStore) Get(s *Session) error {
+	query := "SELECT userId, refreshToken, expires, revoked FROM sessions WHERE id = ?"
+	row := m.DB.QueryRow(m.Dialect.Rebind(query), s.Id)
+
+	if err := row.Scan(&s.UserId, &s.Refresh, &s.Expires, &s.Revoked); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate replaces the refresh token hash of the session and extends its expiration. The update
+// only happens if the stored hash is still the one the session was read with, so two requests
+// using the same refresh token can't both rotate it. If that happens ErrSessionRotated is returned.
+func (m *SQLSessionStore) Rotate(s *Session, refresh string, expires int64) error {
+	query :=
+		"UPDATE sessions SET refreshToken = ?, expires = ? " +
+		"WHERE id = ? AND refreshToken = ? AND revoked = FALSE"
+	res, err := m.DB.Exec(m.Dialect.Rebind(query), refresh, expires, s.Id, s.Refresh)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrSessionRotated
+	}
+
+	s.Refresh = refresh
+	s.Expires = expires
+	return nil
+}
+
+// Revoke marks the session as logged out so none of its tokens can be used anymore
+func (m *SQLSessionStore) Revoke(s *Session) error {
+	query := "UPDATE sessions SET revoked = TRUE WHERE id = ? AND userId = ?"
+	if _, err := m.DB.Exec(m.Dialect.Rebind(query), s.Id, s.UserId); err != nil {
+		return err
+	}
+
+	s.Revoked = true
+	return nil
+}
+
+// RevokeAll logs the user out of every device by revoking all of their sessions
+func (m *SQLSessionStore) RevokeAll(userId string) error {
+	query := "UPDATE sessions SET revoked = TRUE WHERE userId = ?"
+	if _, err := m.DB.Exec(m.Dialect.Rebind(query), userId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsActive checks that the session exists for the given user and that it has not
+// been revoked or expired. Any problem with the query will be returned as an error.
+func (m *SQLSessionStore) IsActive(id, userId string) (bool, error) {
+	var session Session
+	query := "SELECT revoked, expires FROM sessions WHERE id = ? AND userId = ?"
+	if err := m.DB.QueryRow(m.Dialect.Rebind(query), id, userId).Scan(&session.Revoked, &session.Expires); err != nil {
+		return false, err
+	}
+
+	return !session.Revoked && session.Expires > time.Now().Unix(), nil
+}
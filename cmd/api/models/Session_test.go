@@ -0,0 +1,93 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var session = models.Session{
+	Id:      "randomsession",
+	UserId:  user.Id,
+	Refresh: "hashedrefresh",
+	Expires: time.Now().Add(time.Hour).Unix(),
+}
+
+func TestSessionCreate(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `INSERT INTO sessions\(id, userId, refreshToken, expires, revoked\) VALUES\(\?,\?,\?,\?,\?\)`
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(session.Id, session.UserId, session.Refresh, session.Expires, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := app.Sessions.Create(&session)
+	test.ModelMethod(t, err, "insert")
+	test.MockExpectations(t, app)
+}
+
+func TestSessionRotate(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	expires := time.Now().Add(2 * time.Hour).Unix()
+	query := `UPDATE sessions SET refreshToken \= \?, expires \= \? WHERE id \= \? AND refreshToken \= \? AND revoked \= FALSE`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("newhash", expires, session.Id, session.Refresh).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tempSession := session
+	err := app.Sessions.Rotate(&tempSession, "newhash", expires)
+	test.ModelMethod(t, err, "insert")
+	test.MockExpectations(t, app)
+
+	if tempSession.Refresh != "newhash" || tempSession.Expires != expires {
+		t.Fatal("The session was rotated but its values were not updated")
+	}
+}
+
+func TestSessionRotateConflict(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `UPDATE sessions SET refreshToken \= \?, expires \= \? WHERE id \= \? AND refreshToken \= \? AND revoked \= FALSE`
+	app.DB.Mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tempSession := session
+	if err := app.Sessions.Rotate(&tempSession, "newhash", 0); err != models.ErrSessionRotated {
+		t.Fatal("Expected the rotation to conflict, got:", err)
+	}
+}
+
+func TestSessionIsActive(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `SELECT revoked, expires FROM sessions WHERE id \= \? AND userId \= \?`
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(session.Id, user.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "expires"}).AddRow(false, session.Expires))
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(session.Id, user.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "expires"}).AddRow(false, time.Now().Unix()-1))
+
+	if active, err := app.Sessions.IsActive(session.Id, user.Id); err != nil || !active {
+		t.Fatal("The session should be active:", err)
+	}
+
+	if active, err := app.Sessions.IsActive(session.Id, user.Id); err != nil || active {
+		t.Fatal("The session should have expired:", err)
+	}
+
+	test.MockExpectations(t, app)
+}
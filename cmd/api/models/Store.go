@@ -0,0 +1,67 @@
+package models
+
+import (
+	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
+	"github.com/elopez00/scale-backend/pkg/application/store"
+)
+
+// The stores and the data they keep are defined in the store package, so that the application can
+// hold the stores without depending on the api. They are aliased here so that handlers use them
+// along with the rest of the models.
+type (
+	Stores                 = store.Stores
+	UserStore              = store.UserStore
+	TokenStore             = store.TokenStore
+	BudgetStore            = store.BudgetStore
+	SessionStore           = store.SessionStore
+	PasswordResetStore     = store.PasswordResetStore
+	EmailVerificationStore = store.EmailVerificationStore
+	TwoFactorStore         = store.TwoFactorStore
+	LoginChallengeStore    = store.LoginChallengeStore
+	TransactionStore       = store.TransactionStore
+
+	User              = store.User
+	Token             = store.Token
+	Session           = store.Session
+	Budget            = store.Budget
+	Category          = store.Category
+	WhiteListItem     = store.WhiteListItem
+	UpdateObject      = store.UpdateObject
+	UpdateRequest     = store.UpdateRequest
+	PasswordReset     = store.PasswordReset
+	ResetLimit        = store.ResetLimit
+	EmailVerification = store.EmailVerification
+	TwoFactor         = store.TwoFactor
+	LoginChallenge    = store.LoginChallenge
+	TransactionFilter = store.TransactionFilter
+	TransactionPage   = store.TransactionPage
+)
+
+// Errors returned by the stores
+var (
+	ErrSessionRotated           = store.ErrSessionRotated
+	ErrInvalidResetToken        = store.ErrInvalidResetToken
+	ErrTooManyResets            = store.ErrTooManyResets
+	ErrInvalidVerificationToken = store.ErrInvalidVerificationToken
+	ErrCodeUsed                 = store.ErrCodeUsed
+	ErrInvalidRecoveryCode      = store.ErrInvalidRecoveryCode
+	ErrInvalidChallenge         = store.ErrInvalidChallenge
+	ErrInvalidCursor            = store.ErrInvalidCursor
+)
+
+// NewSQLStores returns the stores backed by the database, whose queries are written for its
+// dialect. The keyring is used to encrypt the access tokens of plaid items before they are stored.
+func NewSQLStores(db *database.DB, keyring *encryption.Keyring) Stores {
+	return Stores{
+		Users:         &SQLUserStore{DB: db.Client, Dialect: db.Dialect},
+		Tokens:        &SQLTokenStore{DB: db.Client, Dialect: db.Dialect, Keyring: keyring},
+		Budgets:       &SQLBudgetStore{DB: db.Client, Dialect: db.Dialect},
+		Sessions:      &SQLSessionStore{DB: db.Client, Dialect: db.Dialect},
+		Transactions:  &SQLTransactionStore{DB: db.Client, Dialect: db.Dialect},
+		Resets:        &SQLPasswordResetStore{DB: db.Client, Dialect: db.Dialect},
+		Verifications: &SQLEmailVerificationStore{DB: db.Client, Dialect: db.Dialect},
+		TwoFactor:     &SQLTwoFactorStore{DB: db.Client, Dialect: db.Dialect, Keyring: keyring},
+		Challenges:    &SQLLoginChallengeStore{DB: db.Client, Dialect: db.Dialect},
+	}
+}
@@ -1,30 +1,40 @@
 package models
 
 import (
-	"github.com/elopez00/scale-backend/pkg/application"
+	"database/sql"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
 )
 
 // TODO use prepare statement
 
-// Token for use of plaid public token retrieval
-type Token struct {
-	Value string `json:"value"`
-	Id    string `json:"id"`
-	Institution  string `json:"name"`
+// SQLTokenStore stores tokens in the plaidtokens table, encrypted with the keyring
+type SQLTokenStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+	Keyring *encryption.Keyring
 }
 
 // Add method adds the permanent plaid token and stores into the plaid tokens table with the
 // same id as the user. This function accepts two strings. The first one being the
 // string describing the permanent token, and the second being a string that describes
-// the item ID. Any problem given by this request will be reflected by the returned error.
-func (t *Token) Add(app *application.App, userId string) error {
-	query := "INSERT INTO plaidtokens(id, token, itemID, institution) VALUES(?,?,?,?)"
-	stmt, err := app.DB.Client.Prepare(query)
+// the item ID. The token is encrypted before it is stored, along with the id of the key used
+// to encrypt it. Any problem given by this request will be reflected by the returned error.
+func (s *SQLTokenStore) Add(userId string, t *Token) error {
+	encrypted, keyId, err := s.encrypt(t)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO plaidtokens(id, token, tokenKeyId, itemID, institution, institutionId) VALUES(?,?,?,?,?,?)"
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
 	if err != nil {
 		return err
 	}
 
-	_, err = stmt.Exec(userId, t.Value, t.Id, t.Institution)
+	_, err = stmt.Exec(userId, encrypted, keyId, t.Id, t.Institution, t.InstitutionId)
 	if err != nil {
 		return err
 	}
@@ -32,9 +42,15 @@ func (t *Token) Add(app *application.App, userId string) error {
 	return nil
 }
 
-func (t *Token) Update(app *application.App, userId string) error {
-	query := "UPDATE plaidtokens SET token = ? WHERE itemId = ? AND id = ?"
-	_, err := app.DB.Client.Exec(query, t.Value, t.Id, userId)
+// Update replaces the stored token of the item, encrypting it with the active key
+func (s *SQLTokenStore) Update(userId string, t *Token) error {
+	encrypted, keyId, err := s.encrypt(t)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE plaidtokens SET token = ?, tokenKeyId = ? WHERE itemId = ? AND id = ?"
+	_, err = s.DB.Exec(s.Dialect.Rebind(query), encrypted, keyId, t.Id, userId)
 	if err != nil {
 		return err
 	}
@@ -42,17 +58,21 @@ func (t *Token) Update(app *application.App, userId string) error {
 	return nil
 }
 
-// GetTokens returns every token associated to the user in the form of a slice of Token pointers.
-// Any problem with the query or database operation will be reflected as an error and the slice
-// will be returned as nil.
-func GetTokens(app *application.App, userId string) ([]*Token, error) {
-	query := "SELECT id, token, itemID, institution FROM plaidtokens WHERE id = ?"
+// List returns every token associated to the user in the form of a slice of Token pointers.
+// The tokens are decrypted, so their values can be used with plaid directly. Any problem with the
+// query, database operation, or decryption will be reflected as an error and the slice will be
+// returned as nil.
+func (s *SQLTokenStore) List(userId string) ([]*Token, error) {
+	query :=
+		"SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync " +
+		"FROM plaidtokens WHERE id = ?"
 
 	// get rows from query
-	rows, err := app.DB.Client.Query(query, userId)
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), userId)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	// create slice of token pointers
 	tokens := make([]*Token, 0)
@@ -61,7 +81,23 @@ func GetTokens(app *application.App, userId string) ([]*Token, error) {
 	// loop over all the rows and create a token for each
 	for rows.Next() {
 		token := new(Token)
-		if err := rows.Scan(&placeholder, &token.Value, &token.Id, &token.Institution); err != nil {
+		var keyId string
+		err := rows.Scan(
+			&placeholder,
+			&token.Value,
+			&keyId,
+			&token.Id,
+			&token.Institution,
+			&token.InstitutionId,
+			&token.Status,
+			&token.Cursor,
+			&token.LastSync,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.decrypt(token, keyId); err != nil {
 			return nil, err
 		}
 
@@ -69,22 +105,172 @@ func GetTokens(app *application.App, userId string) ([]*Token, error) {
 		tokens = append(tokens, token)
 	}
 
-	return tokens, nil
+	return tokens, rows.Err()
 }
 
-// Get will get a token from the database and return it given the user's ID and the
+// Get will get a token from the database and fill it given the user's ID and the
 // token id
-func (t *Token) Get(app *application.App, userId string) error {
+func (s *SQLTokenStore) Get(userId string, t *Token) error {
 	// get row
-	query := "SELECT id, token, itemID, institution FROM plaidtokens WHERE id = ? AND itemID = ?"
-	row := app.DB.Client.QueryRow(query, userId, t.Id)
+	query := "SELECT id, token, tokenKeyId, itemID, institution FROM plaidtokens WHERE id = ? AND itemID = ?"
+	row := s.DB.QueryRow(s.Dialect.Rebind(query), userId, t.Id)
 
 	// make token
 	var placeholder string // don't know how to avoid this
+	var keyId string
+
+	if err := row.Scan(&placeholder, &t.Value, &keyId, &t.Id, &t.Institution); err != nil {
+		return err
+	}
+
+	return s.decrypt(t, keyId)
+}
+
+// Delete removes the token of the user from the plaidtokens table along with every transaction
+// that was stored for the item. Both deletions happen in a single database transaction so that
+// no data of the item is left behind if either of them fails.
+func (s *SQLTokenStore) Delete(userId string, t *Token) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	// delete the cached data of the item
+	query := "DELETE FROM transactions WHERE itemID = ? AND userId = ?"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), t.Id, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query = "DELETE FROM plaidtokens WHERE itemID = ? AND id = ?"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), t.Id, userId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByItem will get a token from the database given only its item id, which is what plaid
+// identifies items with in webhooks. The id of the user that owns the item is returned.
+func (s *SQLTokenStore) GetByItem(t *Token) (string, error) {
+	query :=
+		"SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync " +
+		"FROM plaidtokens WHERE itemID = ?"
+	row := s.DB.QueryRow(s.Dialect.Rebind(query), t.Id)
+
+	var userId, keyId string
+	err := row.Scan(&userId, &t.Value, &keyId, &t.Id, &t.Institution, &t.InstitutionId, &t.Status, &t.Cursor, &t.LastSync)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.decrypt(t, keyId); err != nil {
+		return "", err
+	}
+
+	return userId, nil
+}
+
+// SetStatus records the state of the item with the given id. An empty status means the item
+// is working correctly, otherwise the status is the plaid error code or webhook code describing
+// why the item needs attention (e.g. ITEM_LOGIN_REQUIRED or PENDING_EXPIRATION).
+func (s *SQLTokenStore) SetStatus(itemId, status string) error {
+	query := "UPDATE plaidtokens SET status = ? WHERE itemID = ?"
+	if _, err := s.DB.Exec(s.Dialect.Rebind(query), status, itemId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetCursor records the date up to which the transactions of the item were synced, along with
+// the time the sync happened
+func (s *SQLTokenStore) SetCursor(itemId, cursor string) error {
+	query := "UPDATE plaidtokens SET syncCursor = ?, lastSync = ? WHERE itemID = ?"
+	if _, err := s.DB.Exec(s.Dialect.Rebind(query), cursor, time.Now().Unix(), itemId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reencrypt encrypts every stored token that is not encrypted with the active key (including
+// tokens stored before encryption was added) with the active key. This is used after rotating the
+// encryption key, so that the old key can be removed from the configuration. Each token is only
+// replaced if it was not changed since it was read. The number of re-encrypted tokens is returned.
+func (s *SQLTokenStore) Reencrypt() (int, error) {
+	query := "SELECT token, tokenKeyId, itemID FROM plaidtokens WHERE tokenKeyId <> ?"
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), s.Keyring.KeyId)
+	if err != nil {
+		return 0, err
+	}
+
+	// read every outdated token before updating them
+	type storedToken struct {
+		token Token
+		keyId string
+		value string
+	}
+	stored := make([]storedToken, 0)
+	for rows.Next() {
+		var token storedToken
+		if err := rows.Scan(&token.value, &token.keyId, &token.token.Id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		stored = append(stored, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	query = "UPDATE plaidtokens SET token = ?, tokenKeyId = ? WHERE itemID = ? AND token = ? AND tokenKeyId = ?"
+	for _, token := range stored {
+		token.token.Value = token.value
+		if err := s.decrypt(&token.token, token.keyId); err != nil {
+			return count, err
+		}
+
+		encrypted, keyId, err := s.encrypt(&token.token)
+		if err != nil {
+			return count, err
+		}
+
+		res, err := s.DB.Exec(s.Dialect.Rebind(query), encrypted, keyId, token.token.Id, token.value, token.keyId)
+		if err != nil {
+			return count, err
+		}
 
-	if err := row.Scan(&placeholder, &t.Value, &t.Id, &t.Institution); err != nil {
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// encrypt returns the encrypted value of the token and the id of the key that encrypted it. The
+// item id is used as the context of the encryption, so the value can't be used for another item.
+func (s *SQLTokenStore) encrypt(t *Token) (string, string, error) {
+	return s.Keyring.Encrypt(t.Value, t.Id)
+}
+
+// decrypt replaces the stored value of the token with the decrypted access token. Tokens that were
+// stored before encryption was added have no key id, so their value is already the access token.
+func (s *SQLTokenStore) decrypt(t *Token, keyId string) error {
+	if len(keyId) == 0 {
+		return nil
+	}
+
+	value, err := s.Keyring.Decrypt(t.Value, keyId, t.Id)
+	if err != nil {
 		return err
 	}
 
+	t.Value = value
 	return nil
-}
\ No newline at end of file
+}
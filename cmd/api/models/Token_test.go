@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
 	"github.com/elopez00/scale-backend/pkg/test"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -13,20 +14,21 @@ var token = models.Token{
 	Value: "randomaccess",
 	Id:    "randomid",
 	Institution:  "Bank of Bank",
+	InstitutionId: "ins_109508",
 }
 
 func TestTokenAdd(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	query := `INSERT INTO plaidtokens\(id, token, itemID, institution\) VALUES\(\?,\?,\?,\?\)`
+	query := `INSERT INTO plaidtokens\(id, token, tokenKeyId, itemID, institution, institutionId\) VALUES\(\?,\?,\?,\?,\?,\?\)`
 	app.DB.Mock.
 		ExpectPrepare(query).
 		ExpectExec().
-		WithArgs(user.Id, token.Value, token.Id, token.Institution).
+		WithArgs(user.Id, test.EncryptedToken(app, token.Id, token.Value), "test", token.Id, token.Institution, token.InstitutionId).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := token.Add(app, user.Id)
+	err := app.Tokens.Add(user.Id, &token)
 	test.ModelMethod(t, err, "insert")
 	test.MockExpectations(t, app)
 }
@@ -35,14 +37,14 @@ func TestGetTokens(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	rows := sqlmock.NewRows([]string{"id", "token", "itemID", "institution"}).
-		AddRow(user.Id, "token1", "id1", "institution1").
-		AddRow(user.Id, "token2", "id2", "institution2")
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"}).
+		AddRow(user.Id, test.EncryptToken(app, "id1", "token1"), "test", "id1", "institution1", "ins_1", "", "", 0).
+		AddRow(user.Id, "token2", "", "id2", "institution2", "ins_2", "ITEM_LOGIN_REQUIRED", "2021-05-01", 1619827200)
 
-	query := `SELECT id, token, itemID, institution FROM plaidtokens WHERE id \= ?`
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= ?`
 	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
 
-	tokens, err := models.GetTokens(app, user.Id)
+	tokens, err := app.Tokens.List(user.Id)
 	test.ModelMethod(t, err, "select")
 	test.MockExpectations(t, app)
 
@@ -50,25 +52,72 @@ func TestGetTokens(t *testing.T) {
 		t.Error("The function did not return the tokens")
 		return
 	}
+
+	// the first token is decrypted and the second was stored before encryption was added
+	if tokens[0].Value != "token1" || tokens[1].Value != "token2" {
+		t.Error("The function did not decrypt the tokens:", tokens[0].Value, tokens[1].Value)
+	}
+
+	if tokens[1].Status != "ITEM_LOGIN_REQUIRED" || tokens[1].Cursor != "2021-05-01" {
+		t.Error("The function did not return the sync state of the tokens")
+	}
+}
+
+func TestGetTokensDecryptFailure(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the key the token was encrypted with was removed, and the rows still have to be closed
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"}).
+		AddRow(user.Id, "encrypted", "old", "id1", "institution1", "ins_1", "", "", 0).
+		AddRow(user.Id, "token2", "", "id2", "institution2", "ins_2", "", "", 0)
+
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= ?`
+	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows).RowsWillBeClosed()
+
+	if _, err := app.Tokens.List(user.Id); err != encryption.ErrUnknownKey {
+		t.Error("Expected the unknown key to be reported, got", err)
+	}
+	test.MockExpectations(t, app)
+}
+
+func TestGetTokenByItem(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	row := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"}).
+		AddRow(user.Id, test.EncryptToken(app, token.Id, "token1"), "test", token.Id, "institution1", "ins_1", "", "", 0)
+
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE itemID \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(token.Id).WillReturnRows(row)
+
+	tempToken := models.Token{Id: token.Id}
+	userId, err := app.Tokens.GetByItem(&tempToken)
+	test.ModelMethod(t, err, "select")
+	test.MockExpectations(t, app)
+
+	if userId != user.Id || tempToken.Value != "token1" {
+		t.Error("The function did not return the token of the item")
+	}
 }
 
 func TestGetToken(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	row := sqlmock.NewRows([]string{"id", "token", "itemID", "institution"}).
-		AddRow(user.Id, "token1", "id1", "institution1")
+	row := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution"}).
+		AddRow(user.Id, test.EncryptToken(app, token.Id, "token1"), "test", token.Id, "institution1")
 
-	query := `SELECT id, token, itemID, institution FROM plaidtokens WHERE id \= \? AND itemID \= \?`
+	query := `SELECT id, token, tokenKeyId, itemID, institution FROM plaidtokens WHERE id \= \? AND itemID \= \?`
 	app.DB.Mock.ExpectQuery(query).WillReturnRows(row)
 
 	tempToken := token
-	err := tempToken.Get(app, user.Id)
+	err := app.Tokens.Get(user.Id, &tempToken)
 
 	test.ModelMethod(t, err, "select")
 	test.MockExpectations(t, app)
 
-	if len(tempToken.Value) == 0 {
+	if tempToken.Value != "token1" {
 		t.Error("The function did not return the specified token")
 		return
 	}
@@ -78,12 +127,119 @@ func TestUpdateToken(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	query := `UPDATE plaidtokens SET token \= \? WHERE itemId \= \? AND id \= \?`
-	app.DB.Mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
+	query := `UPDATE plaidtokens SET token \= \?, tokenKeyId \= \? WHERE itemId \= \? AND id \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs(test.EncryptedToken(app, token.Id, token.Value), "test", token.Id, user.Id).
+		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	tempToken := token
-	err := tempToken.Update(app, user.Id)
+	err := app.Tokens.Update(user.Id, &tempToken)
 
 	test.ModelMethod(t, err, "update")
 	test.MockExpectations(t, app)
-}
\ No newline at end of file
+}
+
+func TestReencryptTokens(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// one token is stored in plaintext and the other with a key that was rotated out
+	old, _ := encryption.New("old", map[string][]byte{"old": []byte("0123456789abcdef")})
+	encrypted, _, _ := old.Encrypt("token2", "id2")
+	app.Keyring, _ = encryption.New("test", map[string][]byte{
+		"test": []byte("0123456789abcdef0123456789abcdef"),
+		"old":  []byte("0123456789abcdef"),
+	})
+
+	rows := sqlmock.NewRows([]string{"token", "tokenKeyId", "itemID"}).
+		AddRow("token1", "", "id1").
+		AddRow(encrypted, "old", "id2")
+	app.DB.Mock.
+		ExpectQuery(`SELECT token, tokenKeyId, itemID FROM plaidtokens WHERE tokenKeyId <> \?`).
+		WithArgs("test").
+		WillReturnRows(rows)
+
+	query := `UPDATE plaidtokens SET token \= \?, tokenKeyId \= \? WHERE itemID \= \? AND token \= \? AND tokenKeyId \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs(test.EncryptedToken(app, "id1", "token1"), "test", "id1", "token1", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs(test.EncryptedToken(app, "id2", "token2"), "test", "id2", encrypted, "old").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	count, err := (&models.SQLTokenStore{DB: app.DB.Client, Keyring: app.Keyring}).Reencrypt()
+	test.ModelMethod(t, err, "update")
+	test.MockExpectations(t, app)
+
+	if count != 2 {
+		t.Error("Expected 2 tokens to be re-encrypted, got:", count)
+	}
+}
+
+func TestGetTokenWrongItem(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// a token encrypted for another item can't be decrypted
+	row := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution"}).
+		AddRow(user.Id, test.EncryptToken(app, "otheritem", "token1"), "test", token.Id, "institution1")
+
+	query := `SELECT id, token, tokenKeyId, itemID, institution FROM plaidtokens WHERE id \= \? AND itemID \= \?`
+	app.DB.Mock.ExpectQuery(query).WillReturnRows(row)
+
+	tempToken := token
+	test.ModelMethodFailure(t, app.Tokens.Get(user.Id, &tempToken))
+}
+
+func TestSetItemStatus(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `UPDATE plaidtokens SET status \= \? WHERE itemID \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("ITEM_LOGIN_REQUIRED", token.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := app.Tokens.SetStatus(token.Id, "ITEM_LOGIN_REQUIRED")
+	test.ModelMethod(t, err, "update")
+	test.MockExpectations(t, app)
+}
+
+func TestTokenDelete(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.
+		ExpectExec(`DELETE FROM transactions WHERE itemID \= \? AND userId \= \?`).
+		WithArgs(token.Id, user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+	app.DB.Mock.
+		ExpectExec(`DELETE FROM plaidtokens WHERE itemID \= \? AND id \= \?`).
+		WithArgs(token.Id, user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	app.DB.Mock.ExpectCommit()
+
+	err := app.Tokens.Delete(user.Id, &token)
+	test.ModelMethod(t, err, "delete")
+	test.MockExpectations(t, app)
+}
+
+func TestTokenDeleteFailure(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.
+		ExpectExec(`DELETE FROM transactions WHERE itemID \= \? AND userId \= \?`).
+		WillReturnError(sqlmock.ErrCancelled)
+	app.DB.Mock.ExpectRollback()
+
+	err := app.Tokens.Delete(user.Id, &token)
+	test.ModelMethodFailure(t, err)
+	test.MockExpectations(t, app)
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// transactionBatchSize is the most transactions that will be inserted in a single query
+const transactionBatchSize = 500
+
+// SQLTransactionStore stores transactions in the transactions table
+type SQLTransactionStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Save stores the transactions of the item in the transactions table. Transactions
+// that were already stored are replaced, which is how modified transactions (e.g. pending ones
+// that posted) are updated. The full transaction is kept in the data column so that it can be
+// returned exactly as plaid sent it. Any problem with the queries will be returned as an error.
+func (s *SQLTransactionStore) Save(userId, itemId string, transactions []plaid.Transaction) error {
+	for start := 0; start < len(transactions); start += transactionBatchSize {
+		end := start + transactionBatchSize
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+
+		if err := s.saveBatch(userId, itemId, transactions[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveBatch inserts or replaces a single batch of transactions
+func (s *SQLTransactionStore) saveBatch(userId, itemId string, transactions []plaid.Transaction) error {
+	query :=
+		"INSERT INTO transactions" +
+		"(id, userId, itemID, accountId, amount, date, name, merchantName, category, pending, data) VALUES "
+	queryEnd := s.Dialect.Upsert(
+		[]string{"id"},
+		[]string{"accountId", "amount", "date", "name", "merchantName", "category", "pending", "data"},
+	)
+
+	var values []interface{}
+
+	for _, transaction := range transactions {
+		data, err := json.Marshal(transaction)
+		if err != nil {
+			return err
+		}
+
+		query += " (?,?,?,?,?,?,?,?,?,?,?),"
+		values = append(
+			values,
+			transaction.ID,
+			userId,
+			itemId,
+			transaction.AccountID,
+			transaction.Amount,
+			transaction.Date,
+			transaction.Name,
+			transaction.MerchantName,
+			strings.Join(transaction.Category, ","),
+			transaction.Pending,
+			string(data),
+		)
+	}
+
+	// prepare statement
+	query = query[0:len(query)-1] + queryEnd // trim last comma
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
+	if err != nil {
+		return err
+	}
+
+	// execute query
+	if _, err := stmt.Exec(values...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Remove deletes the transactions of the item with the given ids
+func (s *SQLTransactionStore) Remove(itemId string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	values := []interface{}{itemId}
+	query := "DELETE FROM transactions WHERE itemID = ? AND id IN ("
+
+	for _, id := range ids {
+		query += "?,"
+		values = append(values, id)
+	}
+
+	// prepare query
+	query = query[0:len(query)-1] + ");"
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
+	if err != nil {
+		return err
+	}
+
+	// execute query
+	if _, err := stmt.Exec(values...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Ids returns the ids of the transactions stored for the item between the start
+// and end dates (inclusive). This is used to find transactions plaid no longer returns.
+func (s *SQLTransactionStore) Ids(itemId, startDate, endDate string) ([]string, error) {
+	query := "SELECT id FROM transactions WHERE itemID = ? AND date BETWEEN ? AND ?"
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), itemId, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// List returns every transaction stored for the user between the start and end
+// dates (inclusive), with the most recent transactions first. Any problem with the query will
+// be returned as an error.
+func (s *SQLTransactionStore) List(userId, startDate, endDate string) ([]plaid.Transaction, error) {
+	query :=
+		"SELECT data FROM transactions WHERE userId = ? AND date BETWEEN ? AND ? " +
+		"ORDER BY date DESC, id"
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), userId, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]plaid.Transaction, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var transaction plaid.Transaction
+		if err := json.Unmarshal([]byte(data), &transaction); err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, rows.Err()
+}
+
+// Find returns a page of the user's stored transactions that match the filter.
+// Transactions are sorted by date with the most recent first, and by id when they happen on
+// the same date, so that the order is stable between pages. The cursor of the filter points
+// to the last transaction of the previous page, and only transactions after it are returned.
+func (s *SQLTransactionStore) Find(userId string, filter TransactionFilter) (TransactionPage, error) {
+	query := "SELECT data, date, id FROM transactions WHERE userId = ? AND date BETWEEN ? AND ?"
+	values := []interface{}{userId, filter.StartDate, filter.EndDate}
+
+	if len(filter.AccountIds) > 0 {
+		query += " AND accountId IN ("
+		for _, id := range filter.AccountIds {
+			query += "?,"
+			values = append(values, id)
+		}
+		query = query[0:len(query)-1] + ")"
+	}
+
+	// categories are stored as a comma separated hierarchy, so commas are added around it to
+	// match a whole category at any level
+	if len(filter.Category) > 0 {
+		query += " AND " + s.Dialect.Concat("','", "category", "','") + " " + s.Dialect.Like()
+		values = append(values, "%,"+escapeLike(filter.Category)+",%")
+	}
+
+	if filter.MinAmount != nil {
+		query += " AND amount >= ?"
+		values = append(values, *filter.MinAmount)
+	}
+
+	if filter.MaxAmount != nil {
+		query += " AND amount <= ?"
+		values = append(values, *filter.MaxAmount)
+	}
+
+	if len(filter.Cursor) > 0 {
+		date, id, err := DecodeTransactionCursor(filter.Cursor)
+		if err != nil {
+			return TransactionPage{}, err
+		}
+
+		query += " AND (date < ? OR (date = ? AND id > ?))"
+		values = append(values, date, date, id)
+	}
+
+	// one more transaction than the limit is requested to know if there is a next page
+	query += " ORDER BY date DESC, id LIMIT ?"
+	values = append(values, filter.Limit+1)
+
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), values...)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	defer rows.Close()
+
+	page := TransactionPage{Transactions: make([]plaid.Transaction, 0)}
+	var date sqlDate
+	var id string
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data, &date, &id); err != nil {
+			return TransactionPage{}, err
+		}
+
+		if len(page.Transactions) == filter.Limit {
+			last := page.Transactions[len(page.Transactions)-1]
+			page.Next = EncodeTransactionCursor(last.Date, last.ID)
+			break
+		}
+
+		var transaction plaid.Transaction
+		if err := json.Unmarshal([]byte(data), &transaction); err != nil {
+			return TransactionPage{}, err
+		}
+
+		// the stored date and id are the ones used for sorting
+		transaction.Date, transaction.ID = string(date), id
+		page.Transactions = append(page.Transactions, transaction)
+	}
+
+	return page, rows.Err()
+}
+
+// sqlDate is a date column scanned as YYYY-MM-DD. SQLite stores dates as text, while Postgres
+// stores them as DATE, which its driver returns as a time that would otherwise be scanned as an
+// RFC 3339 timestamp.
+type sqlDate string
+
+// Scan formats the date the driver returned as YYYY-MM-DD
+func (d *sqlDate) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case time.Time:
+		*d = sqlDate(value.Format("2006-01-02"))
+	case []byte:
+		*d = sqlDate(value)
+	case string:
+		*d = sqlDate(value)
+	default:
+		return fmt.Errorf("unsupported date type %T", value)
+	}
+
+	return nil
+}
+
+// EncodeTransactionCursor creates the cursor pointing to the transaction with the date and id
+func EncodeTransactionCursor(date, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(date + "|" + id))
+}
+
+// DecodeTransactionCursor returns the date and id of the transaction the cursor points to
+func DecodeTransactionCursor(cursor string) (string, string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", "", ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(decoded), "|", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", ErrInvalidCursor
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// escapeLike escapes the wildcards of a value used in a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
+}
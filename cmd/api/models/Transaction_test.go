@@ -0,0 +1,200 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/plaid/plaid-go/plaid"
+)
+
+var testTransactions = []plaid.Transaction{
+	{
+		ID:        "lPNjeW1nR6CDn5okmGQ6hEpMo4lLNoSrzqDje",
+		AccountID: "BxBXxLj1m4HMXBm9WZZmCWVbPjX16EHwv99vp",
+		Amount:    2307.21,
+		Category:  []string{"Shops", "Computers and Electronics"},
+		Date:      "2017-01-29",
+		Name:      "Apple Store",
+	},
+	{
+		ID:           "dVzbVMLjrxTnLjX4G66XUp5GLklm4oiZy88yK",
+		AccountID:    "BxBXxLj1m4HMXBm9WZZmCWVbPjX16EHwv99vp",
+		Amount:       12.5,
+		Category:     []string{"Food and Drink", "Restaurants"},
+		Date:         "2017-01-28",
+		Name:         "MCDONALDS #4122",
+		MerchantName: "McDonald's",
+		Pending:      true,
+	},
+}
+
+func TestSaveTransactions(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query :=
+		`INSERT INTO transactions\(id, userId, itemID, accountId, amount, date, name, merchantName, category, pending, data\) ` +
+		`VALUES  \(\?,\?,\?,\?,\?,\?,\?,\?,\?,\?,\?\), \(\?,\?,\?,\?,\?,\?,\?,\?,\?,\?,\?\) AS updated ` +
+		`ON DUPLICATE KEY UPDATE `
+
+	first := testTransactions[0]
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(
+			first.ID, user.Id, token.Id, first.AccountID, first.Amount, first.Date, first.Name, "",
+			"Shops,Computers and Electronics", false, sqlmock.AnyArg(),
+			testTransactions[1].ID, user.Id, token.Id, first.AccountID, 12.5, "2017-01-28", "MCDONALDS #4122",
+			"McDonald's", "Food and Drink,Restaurants", true, sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := app.Transactions.Save(user.Id, token.Id, testTransactions)
+	test.ModelMethod(t, err, "insert")
+	test.MockExpectations(t, app)
+}
+
+func TestRemoveTransactions(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `DELETE FROM transactions WHERE itemID \= \? AND id IN \(\?,\?\);`
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(token.Id, testTransactions[0].ID, testTransactions[1].ID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := app.Transactions.Remove(token.Id, []string{testTransactions[0].ID, testTransactions[1].ID})
+	test.ModelMethod(t, err, "delete")
+	test.MockExpectations(t, app)
+}
+
+func TestGetTransactions(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	first, _ := json.Marshal(testTransactions[0])
+	second, _ := json.Marshal(testTransactions[1])
+	rows := sqlmock.NewRows([]string{"data"}).AddRow(string(first)).AddRow(string(second))
+
+	query := `SELECT data FROM transactions WHERE userId \= \? AND date BETWEEN \? AND \? ORDER BY date DESC, id`
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(user.Id, "2017-01-01", "2017-01-31").
+		WillReturnRows(rows)
+
+	transactions, err := app.Transactions.List(user.Id, "2017-01-01", "2017-01-31")
+	test.ModelMethod(t, err, "select")
+	test.MockExpectations(t, app)
+
+	if len(transactions) != 2 || transactions[1].MerchantName != "McDonald's" {
+		t.Fatal("The function did not return the stored transactions")
+	}
+}
+
+func TestSetCursor(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	query := `UPDATE plaidtokens SET syncCursor \= \?, lastSync \= \? WHERE itemID \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("2017-01-31", sqlmock.AnyArg(), token.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := app.Tokens.SetCursor(token.Id, "2017-01-31")
+	test.ModelMethod(t, err, "update")
+	test.MockExpectations(t, app)
+}
+
+func TestFindTransactionsPage(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	first, _ := json.Marshal(testTransactions[0])
+	second, _ := json.Marshal(testTransactions[1])
+	rows := sqlmock.NewRows([]string{"data", "date", "id"}).
+		AddRow(string(first), testTransactions[0].Date, testTransactions[0].ID).
+		AddRow(string(second), testTransactions[1].Date, testTransactions[1].ID)
+
+	query :=
+		`SELECT data, date, id FROM transactions WHERE userId \= \? AND date BETWEEN \? AND \? ` +
+		`AND CONCAT\(',', category, ','\) LIKE \? AND amount <= \? ` +
+		`AND \(date < \? OR \(date \= \? AND id > \?\)\) ORDER BY date DESC, id LIMIT \?`
+
+	maxAmount := 5000.0
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(user.Id, "2017-01-01", "2017-01-31", "%,Shops,%", maxAmount, "2017-01-30", "2017-01-30", "previous", 2).
+		WillReturnRows(rows)
+
+	page, err := app.Transactions.Find(user.Id, models.TransactionFilter{
+		StartDate: "2017-01-01",
+		EndDate:   "2017-01-31",
+		Category:  "Shops",
+		MaxAmount: &maxAmount,
+		Limit:     1,
+		Cursor:    models.EncodeTransactionCursor("2017-01-30", "previous"),
+	})
+	test.ModelMethod(t, err, "select")
+	test.MockExpectations(t, app)
+
+	// only one transaction fits in the page, so the cursor has to point to it
+	if len(page.Transactions) != 1 || page.Transactions[0].ID != testTransactions[0].ID {
+		t.Fatal("The function did not return the first page of transactions")
+	}
+
+	date, id, err := models.DecodeTransactionCursor(page.Next)
+	if err != nil || date != testTransactions[0].Date || id != testTransactions[0].ID {
+		t.Fatal("The function did not return the cursor of the next page")
+	}
+}
+
+func TestFindTransactionsPostgres(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// postgres stores dates as DATE, which its driver scans as a time
+	first, _ := json.Marshal(testTransactions[0])
+	second, _ := json.Marshal(testTransactions[1])
+	rows := sqlmock.NewRows([]string{"data", "date", "id"}).
+		AddRow(string(first), time.Date(2017, 1, 29, 0, 0, 0, 0, time.UTC), testTransactions[0].ID).
+		AddRow(string(second), time.Date(2017, 1, 28, 0, 0, 0, 0, time.UTC), testTransactions[1].ID)
+
+	query := `SELECT data, date, id FROM transactions WHERE userId \= \$1 AND date BETWEEN \$2 AND \$3 ORDER BY date DESC, id LIMIT \$4`
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(user.Id, "2017-01-01", "2017-01-31", 2).
+		WillReturnRows(rows)
+
+	store := &models.SQLTransactionStore{DB: app.DB.Client, Dialect: database.Postgres}
+	page, err := store.Find(user.Id, models.TransactionFilter{StartDate: "2017-01-01", EndDate: "2017-01-31", Limit: 1})
+	test.ModelMethod(t, err, "select")
+	test.MockExpectations(t, app)
+
+	if len(page.Transactions) != 1 || page.Transactions[0].Date != testTransactions[0].Date {
+		t.Fatal("The date of the transaction was not returned as YYYY-MM-DD:", page.Transactions)
+	}
+
+	date, _, err := models.DecodeTransactionCursor(page.Next)
+	if err != nil || date != testTransactions[0].Date {
+		t.Fatal("The cursor of the next page does not have the date as YYYY-MM-DD:", date)
+	}
+}
+
+func TestFindTransactionsInvalidCursor(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	_, err := app.Transactions.Find(user.Id, models.TransactionFilter{Limit: 1, Cursor: "not a cursor"})
+	if err != models.ErrInvalidCursor {
+		t.Fatal("Expected an invalid cursor error, got:", err)
+	}
+}
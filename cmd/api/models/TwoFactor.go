@@ -0,0 +1,357 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
+)
+
+// TwoFactorEnrollment is the secret responded when a user enrolls, along with its otpauth URI,
+// which clients show as a QR code for authenticator apps to scan
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes are the codes a user can log in with once each if they lose their authenticator
+// app. They are only responded once, when they are generated.
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// TwoFactorChallenge is responded by logins that need a TOTP code, instead of the session
+// tokens. The challenge token is sent back along with the code to finish logging in.
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challengeToken"`
+	ExpiresIn      int64  `json:"expiresIn"` // seconds until the challenge expires
+}
+
+// SQLTwoFactorStore stores TOTP secrets in the two_factor table, encrypted with the keyring, and
+// their recovery codes in the recovery_codes table
+type SQLTwoFactorStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+	Keyring *encryption.Keyring
+}
+
+// Get returns the TOTP secret of the user, decrypted. If the user has none the error will be
+// sql.ErrNoRows.
+func (s *SQLTwoFactorStore) Get(userId string) (TwoFactor, error) {
+	var twoFactor TwoFactor
+	var keyId string
+	query := "SELECT userId, secret, secretKeyId, enabled, lastStep FROM two_factor WHERE userId = ?"
+	if err := s.DB.QueryRow(s.Dialect.Rebind(query), userId).Scan(
+		&twoFactor.UserId, &twoFactor.Secret, &keyId, &twoFactor.Enabled, &twoFactor.LastStep,
+	); err != nil {
+		return TwoFactor{}, err
+	}
+
+	secret, err := s.Keyring.Decrypt(twoFactor.Secret, keyId, twoFactor.UserId)
+	if err != nil {
+		return TwoFactor{}, err
+	}
+	twoFactor.Secret = secret
+
+	return twoFactor, nil
+}
+
+// Enroll stores a new TOTP secret for the user that is not enabled yet, replacing any other
+// secret that was enrolled but not enabled. If the user already enabled a secret, the insert
+// fails.
+func (s *SQLTwoFactorStore) Enroll(twoFactor *TwoFactor) error {
+	secret, keyId, err := s.Keyring.Encrypt(twoFactor.Secret, twoFactor.UserId)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM two_factor WHERE userId = ? AND enabled = FALSE"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), twoFactor.UserId); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO two_factor(userId, secret, secretKeyId, enabled, lastStep) VALUES(?,?,?,?,?)"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), twoFactor.UserId, secret, keyId, false, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Enable enables the enrolled secret of the user with the code of the given time step, and
+// replaces the recovery codes of the user with the given hashes. If the user has no enrolled
+// secret, or it is already enabled, the error will be sql.ErrNoRows.
+func (s *SQLTwoFactorStore) Enable(userId string, step int64, codeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE two_factor SET enabled = TRUE, lastStep = ? WHERE userId = ? AND enabled = FALSE"
+	res, err := tx.Exec(s.Dialect.Rebind(query), step, userId)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceRecoveryCodes(tx, s.Dialect, userId, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records that the code of the time step was used to authenticate the user. If a code of
+// the same or a later step was already used, ErrCodeUsed is returned.
+func (s *SQLTwoFactorStore) UseStep(userId string, step int64) error {
+	query := "UPDATE two_factor SET lastStep = ? WHERE userId = ? AND enabled = TRUE AND lastStep < ?"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), step, userId, step)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrCodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode uses the recovery code of the user with the hash. If the code does not exist
+// or was already used, ErrInvalidRecoveryCode is returned.
+func (s *SQLTwoFactorStore) UseRecoveryCode(userId, codeHash string) error {
+	query := "UPDATE recovery_codes SET used = TRUE WHERE userId = ? AND codeHash = ? AND used = FALSE"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), userId, codeHash)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrInvalidRecoveryCode
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces every recovery code of the user with the given hashes
+func (s *SQLTwoFactorStore) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, s.Dialect, userId, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Disable removes the TOTP secret and recovery codes of the user
+func (s *SQLTwoFactorStore) Disable(userId string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM recovery_codes WHERE userId = ?"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), userId); err != nil {
+		return err
+	}
+
+	query = "DELETE FROM two_factor WHERE userId = ?"
+	if _, err := tx.Exec(s.Dialect.Rebind(query), userId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AddAttempt records that the user tried a code at the unix time. Attempts are recorded before the
+// code is checked, so that concurrent requests can't try more codes than allowed.
+func (s *SQLTwoFactorStore) AddAttempt(userId string, at int64) error {
+	query := "INSERT INTO two_factor_attempts(userId, created) VALUES(?,?)"
+	if _, err := s.DB.Exec(s.Dialect.Rebind(query), userId, at); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CountAttempts returns how many codes the user tried since the given unix time, which is used to
+// lock the user out after too many failures
+func (s *SQLTwoFactorStore) CountAttempts(userId string, since int64) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM two_factor_attempts WHERE userId = ? AND created >= ?"
+	if err := s.DB.QueryRow(s.Dialect.Rebind(query), userId, since).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ClearAttempts removes the attempts of the user once they logged in, so that only failed
+// attempts count towards the lockout
+func (s *SQLTwoFactorStore) ClearAttempts(userId string) error {
+	query := "DELETE FROM two_factor_attempts WHERE userId = ?"
+	if _, err := s.DB.Exec(s.Dialect.Rebind(query), userId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reencrypt encrypts every stored secret that is not encrypted with the active key with the active
+// key, the same way SQLTokenStore.Reencrypt does for plaid tokens. The number of re-encrypted
+// secrets is returned.
+func (s *SQLTwoFactorStore) Reencrypt() (int, error) {
+	query := "SELECT userId, secret, secretKeyId FROM two_factor WHERE secretKeyId <> ?"
+	rows, err := s.DB.Query(s.Dialect.Rebind(query), s.Keyring.KeyId)
+	if err != nil {
+		return 0, err
+	}
+
+	// read every outdated secret before updating them
+	type storedSecret struct {
+		userId string
+		secret string
+		keyId  string
+	}
+	stored := make([]storedSecret, 0)
+	for rows.Next() {
+		var secret storedSecret
+		if err := rows.Scan(&secret.userId, &secret.secret, &secret.keyId); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		stored = append(stored, secret)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	query = "UPDATE two_factor SET secret = ?, secretKeyId = ? WHERE userId = ? AND secret = ? AND secretKeyId = ?"
+	for _, secret := range stored {
+		plaintext, err := s.Keyring.Decrypt(secret.secret, secret.keyId, secret.userId)
+		if err != nil {
+			return count, err
+		}
+
+		encrypted, keyId, err := s.Keyring.Encrypt(plaintext, secret.userId)
+		if err != nil {
+			return count, err
+		}
+
+		res, err := s.DB.Exec(s.Dialect.Rebind(query), encrypted, keyId, secret.userId, secret.secret, secret.keyId)
+		if err != nil {
+			return count, err
+		}
+
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// replaceRecoveryCodes replaces every recovery code of the user with the given hashes within the
+// transaction
+func replaceRecoveryCodes(tx *sql.Tx, dialect database.Dialect, userId string, codeHashes []string) error {
+	query := "DELETE FROM recovery_codes WHERE userId = ?"
+	if _, err := tx.Exec(dialect.Rebind(query), userId); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO recovery_codes(userId, codeHash, used) VALUES(?,?,?)"
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(dialect.Rebind(query), userId, hash, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SQLLoginChallengeStore stores login challenges in the login_challenges table
+type SQLLoginChallengeStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Create inserts the login challenge. Any problem with the query or database connection will be
+// reflected in the returned error.
+func (s *SQLLoginChallengeStore) Create(challenge *LoginChallenge) error {
+	query := "INSERT INTO login_challenges(tokenHash, userId, expires, attempts) VALUES(?,?,?,?)"
+	if _, err := s.DB.Exec(s.Dialect.Rebind(query), challenge.TokenHash, challenge.UserId, challenge.Expires, challenge.Attempts); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Attempt counts an attempt of the challenge with the hash and returns the id of its user. If the
+// challenge does not exist, expired, or was already attempted the maximum number of times,
+// ErrInvalidChallenge is returned. The attempt is counted before the code is checked, so that
+// concurrent requests can't try more codes than allowed.
+func (s *SQLLoginChallengeStore) Attempt(tokenHash string, maxAttempts int) (string, error) {
+	query := "UPDATE login_challenges SET attempts = attempts + 1 WHERE tokenHash = ? AND attempts < ? AND expires > ?"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), tokenHash, maxAttempts, time.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return "", err
+	} else if affected == 0 {
+		return "", ErrInvalidChallenge
+	}
+
+	var userId string
+	query = "SELECT userId FROM login_challenges WHERE tokenHash = ?"
+	if err := s.DB.QueryRow(s.Dialect.Rebind(query), tokenHash).Scan(&userId); err != nil {
+		return "", err
+	}
+
+	return userId, nil
+}
+
+// Complete removes the challenge with the hash once the user gave a valid code, so that it can
+// only be completed once. If another request completed it first, ErrInvalidChallenge is returned.
+func (s *SQLLoginChallengeStore) Complete(tokenHash string) error {
+	query := "DELETE FROM login_challenges WHERE tokenHash = ?"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), tokenHash)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrInvalidChallenge
+	}
+
+	return nil
+}
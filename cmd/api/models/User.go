@@ -1,61 +1,135 @@
 package models
 
 import (
-	"log"
+	"database/sql"
+	"fmt"
+	"net/mail"
 
-	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/database"
 )
 
-// User struct will be used to get any information regarding the user information.
-// The id in this case scenario is a primary key and will be used to retrieve other tables
-// linked to the User.
-type User struct {
-	Id        string `json:"id,omitempty"`
-	FirstName string `json:"firstname,omitempty"`
-	LastName  string `json:"lastname,omitempty"`
-	Email     string `json:"email,omitempty"`
-	Password  string `json:"password,omitempty"`
+// minPasswordLength is the shortest password a user can onboard with
+const minPasswordLength = 8
+
+// ValidateUser checks that the user has everything needed to onboard, and returns why each
+// invalid field is invalid
+func ValidateUser(u *User) []FieldError {
+	details := make([]FieldError, 0)
+	if len(u.FirstName) == 0 {
+		details = append(details, FieldError{Field: "firstname", Message: "is required"})
+	}
+
+	if len(u.LastName) == 0 {
+		details = append(details, FieldError{Field: "lastname", Message: "is required"})
+	}
+
+	if address, err := mail.ParseAddress(u.Email); err != nil || address.Address != u.Email {
+		details = append(details, FieldError{Field: "email", Message: "must be an email address"})
+	}
+
+	if detail := ValidatePassword(u.Password); detail != nil {
+		details = append(details, *detail)
+	}
+
+	return details
 }
 
-// Create Method that creates user row based on current user. If there are any errors with the
-// query, these issues will be returned
-func (u *User) Create(app *application.App) error {
+// ValidatePassword checks that the password is long enough to onboard or reset a password with,
+// and returns why it is invalid otherwise
+func ValidatePassword(password string) *FieldError {
+	if len(password) < minPasswordLength {
+		return &FieldError{Field: "password", Message: fmt.Sprintf("must be at least %d characters", minPasswordLength)}
+	}
+
+	return nil
+}
+
+// SQLUserStore stores users in the userinfo table
+type SQLUserStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// Create Method that creates user row based on the given user. Users are always created with an
+// unverified email. If there are any errors with the query, these issues will be returned
+func (s *SQLUserStore) Create(u *User) error {
 	query := "INSERT INTO userinfo(id, firstname, lastname, email, password) VALUES(?,?,?,?,?)"
-	stmt, err := app.DB.Client.Prepare(query)
+	stmt, err := s.DB.Prepare(s.Dialect.Rebind(query))
 	if err != nil {
-		log.Println("Prepare failure")
 		return err
 	}
 
-	if _, err := stmt.Exec(u.Id, u.FirstName, u.LastName, u.Email, u.Password); err != nil {
-		log.Println("Execution failure", err)
-	}
-
-	return nil
+	_, err = stmt.Exec(u.Id, u.FirstName, u.LastName, u.Email, u.Password)
+	return err
 }
 
-// Exists This method checks to see if current user exists in the database.
+// Exists This method checks to see if a user with the email exists in the database.
 // Based on the result of this query the function will return a boolean.
 // ! This function automatically assumes that errors yield false
-func (u *User) Exists(app *application.App) bool {
+func (s *SQLUserStore) Exists(email string) bool {
 	var test User
 	query := "SELECT firstname, email FROM userinfo WHERE email = ?"
-	if err := app.DB.Client.QueryRow(query, u.Email).Scan(&test.Id, &test.Email); err != nil {
-		log.Println(err)
-		return false
-	} else {
-		log.Println(test.FirstName)
-		return true
+	err := s.DB.QueryRow(s.Dialect.Rebind(query), email).Scan(&test.Id, &test.Email)
+	return err == nil
+}
+
+// SetPassword replaces the password hash of the user. If the user does not exist the error will
+// be sql.ErrNoRows.
+func (s *SQLUserStore) SetPassword(userId, password string) error {
+	query := "UPDATE userinfo SET password = ? WHERE id = ?"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), password, userId)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
 	}
+
+	return nil
 }
 
-// GetCredentials Method gives gets credentials found in database using current user's Email value.
+// GetCredentials Method gives gets credentials found in database using the given email.
 // Any problem with the query or database connection will be reflected in returned error.
-func (u *User) GetCredentials(app *application.App, actualUser *User) error {
+func (s *SQLUserStore) GetCredentials(email string) (User, error) {
+	var actualUser User
 	query := "SELECT email, password, id FROM userinfo WHERE email = ?"
-	if err := app.DB.Client.QueryRow(query, u.Email).Scan(&actualUser.Email, &actualUser.Password, &actualUser.Id)
+	if err := s.DB.QueryRow(s.Dialect.Rebind(query), email).Scan(&actualUser.Email, &actualUser.Password, &actualUser.Id)
+	err != nil {
+		return User{}, err
+	}
+
+	return actualUser, nil
+}
+
+// Get returns the user with the id, without their password. If the user does not exist the error
+// will be sql.ErrNoRows.
+func (s *SQLUserStore) Get(userId string) (User, error) {
+	var user User
+	query := "SELECT id, firstname, lastname, email, verified FROM userinfo WHERE id = ?"
+	if err := s.DB.QueryRow(s.Dialect.Rebind(query), userId).Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Verified)
 	err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// SetVerified marks the email of the user as verified. If the user does not exist the error will
+// be sql.ErrNoRows.
+func (s *SQLUserStore) SetVerified(userId string) error {
+	query := "UPDATE userinfo SET verified = TRUE WHERE id = ?"
+	res, err := s.DB.Exec(s.Dialect.Rebind(query), userId)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
 		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
 	}
 
 	return nil
@@ -27,7 +27,7 @@ func TestUserCreate(t *testing.T) {
 		WithArgs(user.Id, user.FirstName, user.LastName, user.Email, user.Password).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err := user.Create(app)
+	err := app.Users.Create(&user)
 	test.ModelMethod(t, err, "insert")
 	test.MockExpectations(t, app)
 }
@@ -42,7 +42,7 @@ func TestUserDoesExists(t *testing.T) {
 	query := `SELECT firstname, email FROM userinfo WHERE email \= \?`
 	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
 
-	exists := user.Exists(app)
+	exists := app.Users.Exists(user.Email)
 	if !exists {
 		t.Error("The user should exist")
 		return
@@ -58,7 +58,7 @@ func TestUserDoesNotExist(t *testing.T) {
 	query := `SELECT firstname, email FROM userinfo WHERE email \= \?`
 	app.DB.Mock.ExpectQuery(query)
 
-	exists := user.Exists(app)
+	exists := app.Users.Exists(user.Email)
 	if exists {
 		t.Error("User should not exist")
 		return
@@ -77,8 +77,7 @@ func TestGetCredential(t *testing.T) {
 	query := `SELECT email, password, id FROM userinfo WHERE email \= \?`
 	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
 
-	var actualUser models.User
-	err := user.GetCredentials(app, &actualUser)
+	actualUser, err := app.Users.GetCredentials(user.Email)
 	test.ModelMethod(t, err, "select")
 	if actualUser.Id != user.Id || actualUser.Password != user.Password {
 		t.Error("Credentials are incorrect")
@@ -93,8 +92,7 @@ func TestUnsuccessfulGetCredential(t *testing.T) {
 	query := `SELECT email, password, id FROM userinfo WHERE email \= \?`
 	app.DB.Mock.ExpectQuery(query)
 
-	var actualUser models.User
-	if err := user.GetCredentials(app, &actualUser); err == nil {
+	if _, err := app.Users.GetCredentials(user.Email); err == nil {
 		t.Error("This process should have failed and returned an error")
 		return
 	}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// Webhook describes the body of the webhooks plaid sends whenever something happens to an
+// item. Only the fields used by the application are decoded, the rest depend on the type.
+type Webhook struct {
+	Type                string       `json:"webhook_type"`                      // TRANSACTIONS, ITEM, etc.
+	Code                string       `json:"webhook_code"`                      // what happened to the item
+	ItemId              string       `json:"item_id"`                           // item the webhook is about
+	Error               *plaid.Error `json:"error,omitempty"`                   // error of the item, if any
+	NewTransactions     int          `json:"new_transactions,omitempty"`        // amount of new transactions
+	RemovedTransactions []string     `json:"removed_transactions,omitempty"`    // ids of removed transactions
+	ConsentExpiration   string       `json:"consent_expiration_time,omitempty"` // when the item will expire
+}
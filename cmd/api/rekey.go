@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application/config"
+	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
+)
+
+// rekey runs the rekey subcommand, which re-encrypts every stored plaid token and two factor
+// secret with the active encryption key. To rotate the key, add the new key to TOKEN_KEYS, set
+// TOKEN_KEY_ID to its id, run this command, and once it finishes the old key can be removed from
+// TOKEN_KEYS. Any configuration flags go after the subcommand.
+func rekey(args []string) {
+	config, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keyring, err := encryption.Get(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Get(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// tokens are only ever stored in the database, so the store is used directly
+	tokens := &models.SQLTokenStore{DB: db.Client, Dialect: db.Dialect, Keyring: keyring}
+	count, err := tokens.Reencrypt()
+	if err != nil {
+		log.Fatalf("Re-encrypted %d tokens before failing: %v", count, err)
+	}
+
+	log.Printf("Re-encrypted %d tokens with key %q", count, keyring.KeyId)
+
+	// the TOTP secrets of two factor authentication are encrypted with the same keys
+	twoFactor := &models.SQLTwoFactorStore{DB: db.Client, Dialect: db.Dialect, Keyring: keyring}
+	count, err = twoFactor.Reencrypt()
+	if err != nil {
+		log.Fatalf("Re-encrypted %d two factor secrets before failing: %v", count, err)
+	}
+
+	log.Printf("Re-encrypted %d two factor secrets with key %q", count, keyring.KeyId)
+}
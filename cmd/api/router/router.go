@@ -12,16 +12,41 @@ import (
 func Get(app *application.App) *httprouter.Router {
 	mux := httprouter.New()
 
+	// probes used by the orchestrator
+	mux.GET("/healthz", sdk.Healthz())
+	mux.GET("/readyz", sdk.Readyz(app))
+	mux.GET("/version", sdk.Version())
+	mux.GET("/.well-known/jwks.json", sdk.JWKS(app))
+
 	// registration and account management
 	mux.POST("/v0/onboard", sdk.Onboard(app))
 	mux.POST("/v0/login", sdk.Login(app))
-	mux.GET("/v0/logout", sdk.Logout())
+	mux.POST("/v0/login/2fa", sdk.LoginTwoFactor(app))
+	mux.POST("/v0/logout", sdk.Logout(app))
+	mux.POST("/v0/logout/all", m.Authenticate(sdk.LogoutAll(app), app))
+	mux.POST("/v0/token/refresh", sdk.RefreshToken(app))
+	mux.POST("/v0/password/forgot", sdk.ForgotPassword(app))
+	mux.POST("/v0/password/reset", sdk.ResetPassword(app))
+	mux.POST("/v0/verify", sdk.VerifyEmail(app))
+	mux.POST("/v0/verify/resend", m.Authenticate(sdk.ResendVerification(app), app))
+
+	// two factor authentication
+	mux.POST("/v0/2fa/enroll", m.Authenticate(sdk.EnrollTwoFactor(app), app))
+	mux.POST("/v0/2fa/enable", m.Authenticate(sdk.EnableTwoFactor(app), app))
+	mux.POST("/v0/2fa/disable", m.Authenticate(sdk.DisableTwoFactor(app), app))
+	mux.POST("/v0/2fa/recovery", m.Authenticate(sdk.RegenerateRecoveryCodes(app), app))
 
 	// plaid token management
-	mux.POST("/v0/token/exchange", m.Authenticate(sdk.ExchangePublicToken(app), app))
-	mux.PUT("/v0/token/exchange", m.Authenticate(sdk.ExchangePublicToken(app), app))
-	mux.GET("/v0/token/link", m.Authenticate(sdk.GetPlaidToken(app), app))
+	// linking banks can require a verified email, so junk accounts can't get link tokens
+	mux.POST("/v0/token/exchange", m.Authenticate(m.RequireVerifiedEmail(sdk.ExchangePublicToken(app), app), app))
+	mux.PUT("/v0/token/exchange", m.Authenticate(m.RequireVerifiedEmail(sdk.ExchangePublicToken(app), app), app))
+	mux.GET("/v0/token/link", m.Authenticate(m.RequireVerifiedEmail(sdk.GetPlaidToken(app), app), app))
 	mux.PUT("/v0/token/link", m.Authenticate(sdk.UpdatePlaidToken(app), app))
+	mux.DELETE("/v0/token/:itemId", m.Authenticate(sdk.UnlinkToken(app), app))
+
+	// institutions
+	mux.GET("/v0/institutions", m.Authenticate(sdk.GetInstitutions(app), app))
+	mux.POST("/v0/plaid/webhook", sdk.PlaidWebhook(app))
 
 	// transactions
 	mux.GET("/v0/transactions", m.Authenticate(sdk.GetTransactions(app), app))
@@ -1,10 +1,18 @@
 package router_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/cmd/api/router"
 	"github.com/elopez00/scale-backend/pkg/test"
+	"github.com/elopez00/scale-backend/pkg/totp"
 )
 
 func TestRouterGet(t *testing.T) {
@@ -12,4 +20,91 @@ func TestRouterGet(t *testing.T) {
 	if router.Get(app) == nil {
 		t.Error("Router did not return a valid httprouter handle")
 	}
-}
\ No newline at end of file
+}
+
+// TestLogoutAllIsPost makes sure every session can't be revoked by a link to another site, which
+// the session cookie is sent along with when it is a GET
+func TestLogoutAllIsPost(t *testing.T) {
+	app := test.GetMemoryApp()
+	handler := router.Get(app)
+
+	req := httptest.NewRequest("GET", "/v0/logout/all", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Fatal("Expected signing out of every session to only be a POST, got", res.Code)
+	}
+}
+
+// TestTwoFactorLoginCookies logs in with two factor authentication the way a browser does, so the
+// cookies are only sent to the routes their path allows
+func TestTwoFactorLoginCookies(t *testing.T) {
+	app := test.GetMemoryApp()
+	server := httptest.NewServer(router.Get(app))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+
+	post := func(path string, body interface{}, result interface{}) int {
+		data, _ := json.Marshal(body)
+		res, err := client.Post(server.URL+path, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if result != nil {
+			response := struct {
+				Result interface{} `json:"result"`
+			}{result}
+			json.NewDecoder(res.Body).Decode(&response)
+		}
+
+		return res.StatusCode
+	}
+
+	user := models.User{FirstName: "Stan", LastName: "Marsh", Email: "smarsh@southpark.com", Password: "southpark"}
+	if status := post("/v0/onboard", user, nil); status != http.StatusOK {
+		t.Fatal("Failed to onboard, got", status)
+	}
+
+	var enrollment models.TwoFactorEnrollment
+	if status := post("/v0/2fa/enroll", nil, &enrollment); status != http.StatusOK {
+		t.Fatal("Failed to enroll, got", status)
+	}
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	if status := post("/v0/2fa/enable", map[string]string{"code": code}, nil); status != http.StatusOK {
+		t.Fatal("Failed to enable two factor authentication, got", status)
+	}
+
+	// sign out so that only the cookies of the second login step are left
+	if status := post("/v0/logout", nil, nil); status != http.StatusOK {
+		t.Fatal("Failed to sign out, got", status)
+	}
+
+	var challenge models.TwoFactorChallenge
+	if status := post("/v0/login", user, &challenge); status != http.StatusAccepted {
+		t.Fatal("Expected a login challenge, got", status)
+	}
+
+	next, _ := totp.Code(enrollment.Secret, step+1)
+	body := map[string]string{"challengeToken": challenge.ChallengeToken, "code": next}
+	if status := post("/v0/login/2fa", body, nil); status != http.StatusOK {
+		t.Fatal("Failed to complete the login challenge, got", status)
+	}
+
+	// the session cookies are sent to the authenticated routes outside of /v0/login
+	res, err := client.Get(server.URL + "/v0/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("The session of the two factor login is not sent to other routes, got", res.StatusCode)
+	}
+}
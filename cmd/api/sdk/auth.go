@@ -1,15 +1,23 @@
 package sdk
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
 	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/pkg/application"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"golang.org/x/crypto/bcrypt"
@@ -25,14 +33,23 @@ func Onboard(app *application.App) httprouter.Handle {
 		// get user input from body
 		var user models.User
 		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			msg := "Failed to decode user from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+			return
+		}
+
+		// make sure the user can log in with what they gave
+		if details := models.ValidateUser(&user); len(details) > 0 {
+			msg := "Invalid user"
+			models.CreateValidationError(w, r, models.CodeValidationFailed, msg, details)
 			return
 		}
 
 		// check to see if user already exists in database
-		if user.Exists(app) {
+		if app.Users.Exists(user.Email) {
 			msg := "User already exists"
-			models.CreateError(w, http.StatusNotAcceptable, msg, nil)
+			models.CreateError(w, r, http.StatusNotAcceptable, models.CodeUserExists, msg, nil)
+			return
 		}
 
 		// finish gather important user data
@@ -42,30 +59,50 @@ func Onboard(app *application.App) httprouter.Handle {
 		}
 
 		// create user in database
-		err := user.Create(app)
+		err := app.Users.Create(&user)
 		if err != nil {
 			msg := "Unable to create user"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
 			return
 		}
 
-		// create a cookie to completely authenticate user
-		err = CreateCookie(w, app, "AuthToken", user.Id)
+		// email the user a token to verify their email with, which they can ask for again if
+		// anything fails, so onboarding does not fail with it
+		log := app.Logger(r.Context())
+		if message, err := createVerification(app, user); err != nil {
+			log.Error("Failed to create email verification", "userId", user.Id, "error", err)
+		} else {
+			userId := user.Id
+			err := app.Worker.Add("verification:"+userId, func() error {
+				if err := app.Mailer.Send(message); err != nil {
+					return fmt.Errorf("failed to send verification email to user %s: %v", userId, err)
+				}
+
+				return nil
+			})
+			if err != nil {
+				log.Error("Failed to queue verification email", "userId", userId, "error", err)
+			}
+		}
+
+		// create a session to completely authenticate user
+		tokens, err := CreateSession(app, user.Id)
 		if err != nil {
 			msg := "Failed to login"
-			models.CreateError(w, http.StatusUnprocessableEntity, msg, err)
+			models.CreateError(w, r, http.StatusUnprocessableEntity, models.CodeSessionFailed, msg, err)
 			return
 		}
 
 		// return successful boarding message
 		msg := "User successfully onboard"
-		models.CreateResponse(w, msg, nil)
+		respondWithTokens(w, app, msg, tokens, wantsTokens(r))
 	}
 }
 
 // Login logs in user by doing a preliminary check to backend to check if the user exists. After
 // verification, the function will compare hashed and input password, so it can then focus
-// on creating a jwt token
+// on creating a jwt token. Users with two factor authentication get a challenge instead, with
+// the http status 202 (Accepted), which LoginTwoFactor exchanges for the tokens.
 func Login(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		defer CloseBody(r)
@@ -73,78 +110,334 @@ func Login(app *application.App) httprouter.Handle {
 		// grabs input user from body
 		var authUser models.User
 		if err := json.NewDecoder(r.Body).Decode(&authUser); err != nil {
-			log.Println(err.Error())
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			msg := "Failed to decode user from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
 			return
 		}
 
 		// get actual user from database
-		var actualUser models.User
-		err := authUser.GetCredentials(app, &actualUser)
+		actualUser, err := app.Users.GetCredentials(authUser.Email)
 		if err != nil {
 			msg := "User not found"
-			models.CreateError(w, http.StatusNotFound, msg, err)
+			models.CreateError(w, r, http.StatusNotFound, models.CodeUserNotFound, msg, err)
 			return
 		}
 
 		// check to see if passwords match
 		if match := hashMatch(authUser.Password, actualUser.Password); !match {
 			msg := "Password incorrect"
-			models.CreateError(w, http.StatusUnauthorized, msg, nil)
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidCredentials, msg, nil)
 			return
 		}
 
-		// create a cookie to completely authenticate user
-		err = CreateCookie(w, app, "AuthToken", actualUser.Id)
+		// users with two factor authentication only get a session once they give a code, so they
+		// are given a challenge to send it with instead
+		if twoFactor, err := app.TwoFactor.Get(actualUser.Id); err == nil && twoFactor.Enabled {
+			challenge, err := createChallenge(app, actualUser.Id)
+			if err != nil {
+				msg := "Failed to login"
+				models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+				return
+			}
+
+			msg := "Two factor code required"
+			models.CreateResponseWithStatus(w, http.StatusAccepted, msg, challenge)
+			return
+		} else if err != nil && err != sql.ErrNoRows {
+			msg := "Failed to login"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// create a session to completely authenticate user
+		tokens, err := CreateSession(app, actualUser.Id)
 		if err != nil {
 			msg := "Failed to login"
-			models.CreateError(w, http.StatusUnprocessableEntity, msg, err)
+			models.CreateError(w, r, http.StatusUnprocessableEntity, models.CodeSessionFailed, msg, err)
 			return
 		}
 
 		// send successful authentication message to client
 		msg := "User successfully authenticated"
-		models.CreateResponse(w, msg, nil)
+		respondWithTokens(w, app, msg, tokens, wantsTokens(r))
 	}
 }
 
-// Logout  logs the user out of their session by deleting the AuthToken cookie containing
-// the user's JWT. The function should return an error status if there is no token to delete
-func Logout() httprouter.Handle {
+// Logout logs the user out of their session by revoking it and deleting the cookies containing
+// the user's tokens. Since the session is revoked, copies of the tokens can't be used either.
+// The session is found with the access token, or with the refresh token once the access token
+// expired, so users can always sign out. The function should return an error status if there is
+// no token to sign out with.
+func Logout(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if len(r.Cookies()) < 1 {
+		session, err := logoutSession(r, app)
+		if err == errNotSignedIn {
 			msg := "User already signed out"
-			models.CreateError(w, http.StatusBadRequest, msg, nil)
-		} 
-		
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeNotSignedIn, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Invalid session"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeUnauthorized, msg, err)
+			return
+		}
+
+		// revoke the session the request was authenticated with
+		if err := app.Sessions.Revoke(session); err != nil {
+			msg := "Failed to sign out"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
 		DeleteCookie(w, "AuthToken")
+		DeleteCookie(w, "RefreshToken")
 		msg := "User successfully signed out"
 		models.CreateResponse(w, msg, nil)
 	}
 }
 
-// CreateCookie makes a valid httponly cookie
-func CreateCookie(w http.ResponseWriter, app *application.App, name, id string) error {
-	token, err := GenerateJWT(app, id)
+// errNotSignedIn is returned when a request has neither an access token nor a refresh token
+var errNotSignedIn = errors.New("no access token or refresh token")
+
+// logoutSession returns the session the request signs out of. It is identified by the access
+// token if it is still valid, otherwise by the refresh token found in the cookie or the body.
+func logoutSession(r *http.Request, app *application.App) (*models.Session, error) {
+	userId, sessionId, err := middleware.RequestIsAuthenticated(r, app)
+	if err == nil {
+		return &models.Session{Id: sessionId, UserId: userId}, nil
+	}
+
+	refreshToken, _, refreshErr := getRefreshToken(r)
+	if refreshErr == errNoRefreshToken && err == http.ErrNoCookie {
+		return nil, errNotSignedIn
+	} else if refreshErr == errNoRefreshToken {
+		return nil, err
+	} else if refreshErr != nil {
+		return nil, refreshErr
+	}
+
+	id, secret, ok := splitRefreshToken(refreshToken)
+	if !ok {
+		return nil, errors.New("malformed refresh token")
+	}
+
+	session := models.Session{Id: id}
+	if err := app.Sessions.Get(&session); err != nil {
+		return nil, err
+	}
+
+	// a rotated refresh token no longer identifies the session
+	if hashToken(secret) != session.Refresh {
+		return nil, errors.New("refresh token does not match the session")
+	}
+
+	return &session, nil
+}
+
+// LogoutAll logs the user out of every device by revoking all of their sessions, including
+// the one used to make this request
+func LogoutAll(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if err := app.Sessions.RevokeAll(GetIDFromContext(r)); err != nil {
+			msg := "Failed to sign out of all devices"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		DeleteCookie(w, "AuthToken")
+		DeleteCookie(w, "RefreshToken")
+		msg := "User successfully signed out of all devices"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// RefreshToken exchanges the refresh token found in the RefreshToken cookie, or in the
+// refreshToken field of the body for clients without cookies, for a new access token and a new
+// refresh token. The new tokens are given the same way the refresh token was. Refresh tokens can
+// only be used once, if a token that was already exchanged is presented again, it is assumed to
+// be stolen and the whole session is revoked. If the session is expired or revoked, the user will
+// have to log in again.
+func RefreshToken(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		refreshToken, inBody, err := getRefreshToken(r)
+		if err != nil {
+			msg := "Missing refresh token"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidRefreshToken, msg, err)
+			return
+		}
+
+		// get the session the refresh token belongs to
+		id, secret, ok := splitRefreshToken(refreshToken)
+		if !ok {
+			msg := "Invalid refresh token"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidRefreshToken, msg, nil)
+			return
+		}
+
+		session := models.Session{Id: id}
+		if err := app.Sessions.Get(&session); err != nil {
+			msg := "Invalid refresh token"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidRefreshToken, msg, err)
+			return
+		}
+
+		if session.Revoked || session.Expires <= time.Now().Unix() {
+			msg := "Session expired"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeSessionExpired, msg, nil)
+			return
+		}
+
+		// a refresh token that does not match the stored one was already rotated, which means
+		// someone else is using it, so the session can't be trusted anymore
+		if hashToken(secret) != session.Refresh {
+			if err := app.Sessions.Revoke(&session); err != nil {
+				app.Logger(r.Context()).Error("Failed to revoke session", "error", err)
+			}
+
+			msg := "Refresh token was already used"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeRefreshTokenReused, msg, nil)
+			return
+		}
+
+		// rotate the refresh token and give the user new tokens
+		secret = generateSecret()
+		if err := app.Sessions.Rotate(&session, hashToken(secret), time.Now().Add(refreshTokenDuration).Unix()); err != nil {
+			msg := "Failed to refresh session"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeSessionFailed, msg, err)
+			return
+		}
+
+		tokens, err := issueTokens(app, &session, secret)
+		if err != nil {
+			msg := "Failed to refresh session"
+			models.CreateError(w, r, http.StatusUnprocessableEntity, models.CodeSessionFailed, msg, err)
+			return
+		}
+
+		msg := "Session successfully refreshed"
+		respondWithTokens(w, app, msg, tokens, inBody)
+	}
+}
+
+// CreateSession starts a new session for the user and returns its tokens: a short lived access
+// token and the refresh token used to get new access tokens
+func CreateSession(app *application.App, userId string) (*models.TokenPair, error) {
+	secret := generateSecret()
+	session := models.Session{
+		Id:      uuid.New().String(),
+		UserId:  userId,
+		Refresh: hashToken(secret),
+		Expires: time.Now().Add(refreshTokenDuration).Unix(),
+	}
+
+	if err := app.Sessions.Create(&session); err != nil {
+		return nil, err
+	}
+
+	return issueTokens(app, &session, secret)
+}
+
+// issueTokens creates a new access token for the session, along with its refresh token
+func issueTokens(app *application.App, session *models.Session, secret string) (*models.TokenPair, error) {
+	token, err := GenerateJWT(app, session.UserId, session.Id)
 	if err != nil {
-		return err
-	} 
-	
-	cookie := http.Cookie{
-		Name:     name,
-		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
+		return nil, err
 	}
-	
-	http.SetCookie(w, &cookie)
-	return nil
+
+	return &models.TokenPair{
+		AccessToken:  token,
+		RefreshToken: session.Id + "." + secret,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenDuration / time.Second),
+	}, nil
+}
+
+// respondWithTokens responds with the tokens of the session in the body if the client asked for
+// them, or sets them as cookies otherwise
+func respondWithTokens(w http.ResponseWriter, app *application.App, msg string, tokens *models.TokenPair, inBody bool) {
+	if inBody {
+		models.CreateResponse(w, msg, tokens)
+		return
+	}
+
+	setSessionCookies(w, app, tokens)
+	models.CreateResponse(w, msg, nil)
+}
+
+// wantsTokens reports whether the client asked for the tokens in the body with the tokens query
+// parameter instead of cookies
+func wantsTokens(r *http.Request) bool {
+	return r.URL.Query().Get("tokens") == "true"
+}
+
+// getRefreshToken returns the refresh token found in the RefreshToken cookie, or in the body, and
+// whether it was found in the body
+func getRefreshToken(r *http.Request) (string, bool, error) {
+	if cookie, err := r.Cookie("RefreshToken"); err == nil {
+		return cookie.Value, false, nil
+	}
+
+	if r.Body == nil {
+		return "", false, errNoRefreshToken
+	}
+	defer CloseBody(r)
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err == io.EOF {
+		return "", false, errNoRefreshToken
+	} else if err != nil {
+		return "", false, err
+	}
+
+	if len(body.RefreshToken) == 0 {
+		return "", false, errNoRefreshToken
+	}
+
+	return body.RefreshToken, true, nil
+}
+
+// errNoRefreshToken is returned when a request has no refresh token in its cookies or its body
+var errNoRefreshToken = errors.New("no refresh token in cookie or body")
+
+// setSessionCookies sets the cookies with the access token and the refresh token of the session
+func setSessionCookies(w http.ResponseWriter, app *application.App, tokens *models.TokenPair) {
+	sameSite := cookieSameSite[app.Config.CORS.CookieSameSite]
+
+	// browsers only send SameSite=None cookies over https
+	http.SetCookie(w, &http.Cookie{
+		Name:     "AuthToken",
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		Expires:  time.Now().Add(accessTokenDuration),
+		HttpOnly: true,
+		SameSite: sameSite,
+		Secure:   sameSite == http.SameSiteNoneMode,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "RefreshToken",
+		Value:    tokens.RefreshToken,
+		Path:     "/",
+		Expires:  time.Now().Add(refreshTokenDuration),
+		HttpOnly: true,
+		SameSite: sameSite,
+		Secure:   sameSite == http.SameSiteNoneMode,
+	})
+}
+
+// cookieSameSite maps the configured SameSite policy of the session cookies to its cookie mode
+var cookieSameSite = map[string]http.SameSite {
+	"lax":		http.SameSiteLaxMode,
+	"strict":	http.SameSiteStrictMode,
+	"none":		http.SameSiteNoneMode,
 }
 
 // DeleteCookie removes existing cookie
 func DeleteCookie(w http.ResponseWriter, name string) {
 	cookie := http.Cookie{
 		Name:   name,
+		Path:   "/",
 		MaxAge: -1,
 	}
 
@@ -159,26 +452,56 @@ func AuthCheck() httprouter.Handle {
 	}
 }
 
-// GenerateJWT generates a JWT token based on the user id stored in the database that expires in
-// 24 hours. If this function were to fail, its error would be returned respectfully.
-func GenerateJWT(app *application.App, id string) (string, error) {
-	key := app.Config.GetServer()["key"]
-
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		Issuer:    id,
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-	})
+// GenerateJWT generates a JWT token for the user id stored in the database and the session it
+// belongs to, that expires in 15 minutes. If this function were to fail, its error would be
+// returned respectfully.
+func GenerateJWT(app *application.App, id, session string) (string, error) {
+	return app.Signing.Sign(id, session, accessTokenDuration)
+}
 
-	token, err := claims.SignedString([]byte(key))
-	if err != nil {
-		return "", err
-	} 
-	
-	return token, nil
+// JWKS responds with the public keys access tokens can be verified with, so that other services
+// can verify them without calling the api. Keys that are shared secrets are never listed.
+func JWKS(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(app.Signing.JWKS())
+	}
 }
 
 // * Static functions
 
+const (
+	accessTokenDuration  = 15 * time.Minute    // how long access tokens are valid for
+	refreshTokenDuration = 30 * 24 * time.Hour // how long a session lasts without being refreshed
+)
+
+// generateSecret generates a random url safe string used as the secret part of refresh tokens
+func generateSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(secret)
+}
+
+// hashToken hashes a token so that it can be stored and compared without keeping the original
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// splitRefreshToken splits a refresh token into the session id and secret parts of it
+func splitRefreshToken(token string) (string, string, bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
 // encryptPassword encrypts password with all appropriate settings and conversions for simple use in the
 // main authentication file
 func encryptPassword(password string) string {
@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/cmd/api/sdk"
 	"github.com/elopez00/scale-backend/pkg/test"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/julienschmidt/httprouter"
 )
 
 func getBody() io.Reader {
@@ -24,13 +29,25 @@ func TestOnboardSuccess(t *testing.T) {
 
 	// run expectation
 	query := "INSERT INTO userinfo\\(id, firstname, lastname, email, password\\) VALUES\\(\\?,\\?,\\?,\\?,\\?\\)"
-	app.DB.Mock.ExpectPrepare(query).ExpectExec()
-	
+	app.DB.Mock.ExpectPrepare(query).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// the user is emailed a verification token
+	query = `INSERT INTO email_verifications\(tokenHash, userId, created, expires, used\) VALUES\(\?,\?,\?,\?,\?\)`
+	app.DB.Mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// the user is logged in with a new session
+	query = `INSERT INTO sessions\(id, userId, refreshToken, expires, revoked\) VALUES\(\?,\?,\?,\?,\?\)`
+	app.DB.Mock.ExpectPrepare(query).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
 	// create body of function
 	body := getBody()
 	res := test.Post("/onboard", sdk.Onboard(app), body)
 	test.Response(t, res, http.StatusOK)
 	test.MockExpectations(t, app)
+
+	if message := test.GetMailbox(app).Receive(t); message.To != user.Email {
+		t.Error("The verification email was sent to", message.To)
+	}
 }
 
 func TestExistingUserError(t *testing.T) {
@@ -47,6 +64,27 @@ func TestExistingUserError(t *testing.T) {
 	body := getBody()
 	res := test.Post("/onboard", sdk.Onboard(app), body)
 	test.Response(t, res, http.StatusNotAcceptable)
+	test.Error(t, res, models.CodeUserExists)
+	test.MockExpectations(t, app)
+}
+
+func TestOnboardInvalidUser(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	invalid := user
+	invalid.Email = "smarsh"
+	invalid.Password = "short"
+	body, _ := json.Marshal(invalid)
+
+	// every invalid field is described
+	res := test.Post("/onboard", sdk.Onboard(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusBadRequest)
+
+	details := test.Error(t, res, models.CodeValidationFailed).Details
+	if len(details) != 2 || details[0].Field != "email" || details[1].Field != "password" {
+		t.Fatal("Unexpected details:", details)
+	}
 	test.MockExpectations(t, app)
 }
 
@@ -85,14 +123,178 @@ func TestUserSignout(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	res := test.GetWithCookie("/v0/logout", sdk.Logout(), app, "AuthToken")
+	test.ExpectSession(app, false)
+
+	query := `UPDATE sessions SET revoked \= TRUE WHERE id \= \? AND userId \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("testsession", user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res := test.PostWithCookie("/v0/logout", sdk.Logout(app), nil, app, "AuthToken")
 	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	// the cookies are deleted from every route they were set for
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.MaxAge >= 0 || cookie.Path != "/" {
+			t.Fatalf("Cookie %s was not deleted for every route", cookie.Name)
+		}
+	}
+}
+
+func TestUserSignoutWithRefreshToken(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the hash of the secret "refreshsecret"
+	hash := "082e75e33413a420deb1bcf1743bb9a62e5c4931d825f869d53bbfb1e9ab8731"
+	rows := sqlmock.NewRows([]string{"userId", "refreshToken", "expires", "revoked"}).
+		AddRow(user.Id, hash, time.Now().Add(time.Hour).Unix(), false)
+
+	query := `SELECT userId, refreshToken, expires, revoked FROM sessions WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs("testsession").WillReturnRows(rows)
+
+	// the access token expired, so the session is found with the refresh token
+	query = `UPDATE sessions SET revoked \= TRUE WHERE id \= \? AND userId \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("testsession", user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res := postWithRefreshToken(sdk.Logout(app), "testsession.refreshsecret")
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestUserSignoutWithRotatedRefreshToken(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the stored hash belongs to the secret "rotatedsecret"
+	hash := "7f01d0faef75b7bb9b54617508e2a44b2739a29b38c274bd126cc48a102880ad"
+	rows := sqlmock.NewRows([]string{"userId", "refreshToken", "expires", "revoked"}).
+		AddRow(user.Id, hash, time.Now().Add(time.Hour).Unix(), false)
+
+	query := `SELECT userId, refreshToken, expires, revoked FROM sessions WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs("testsession").WillReturnRows(rows)
+
+	res := postWithRefreshToken(sdk.Logout(app), "testsession.refreshsecret")
+	test.Response(t, res, http.StatusUnauthorized)
+	test.MockExpectations(t, app)
 }
 
 func TestUserSignoutFailure(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
-	res := test.Get("/v0/logout", sdk.Logout())
+	res := test.Post("/v0/logout", sdk.Logout(app), nil)
 	test.Response(t, res, http.StatusBadRequest)
+}
+
+func TestUserSignoutAll(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, false)
+
+	query := `UPDATE sessions SET revoked \= TRUE WHERE userId \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs(user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	res := test.PostWithCookie("/v0/logout/all", middleware.Authenticate(sdk.LogoutAll(app), app), nil, app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestRevokedSession(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, true)
+
+	res := test.PostWithCookie("/v0/logout", sdk.Logout(app), nil, app, "AuthToken")
+	test.Response(t, res, http.StatusUnauthorized)
+	test.MockExpectations(t, app)
+}
+
+func TestRefreshToken(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the hash of the secret "refreshsecret"
+	hash := "082e75e33413a420deb1bcf1743bb9a62e5c4931d825f869d53bbfb1e9ab8731"
+
+	rows := sqlmock.NewRows([]string{"userId", "refreshToken", "expires", "revoked"}).
+		AddRow(user.Id, hash, time.Now().Add(time.Hour).Unix(), false)
+
+	query := `SELECT userId, refreshToken, expires, revoked FROM sessions WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs("testsession").WillReturnRows(rows)
+
+	query = `UPDATE sessions SET refreshToken \= \?, expires \= \? WHERE id \= \? AND refreshToken \= \? AND revoked \= FALSE`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "testsession", hash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res := postWithRefreshToken(sdk.RefreshToken(app), "testsession.refreshsecret")
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	// both tokens have to be replaced
+	cookies := res.Result().Cookies()
+	if len(cookies) != 2 || cookies[1].Value == "testsession.refreshsecret" {
+		t.Fatal("The session was refreshed but the tokens were not replaced")
+	}
+
+	// the refresh route must not scope the new cookies to its own path
+	for _, cookie := range cookies {
+		if cookie.Path != "/" {
+			t.Fatalf("Cookie %s is only sent to %s", cookie.Name, cookie.Path)
+		}
+	}
+}
+
+func TestRefreshTokenReused(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the stored hash belongs to the secret "rotatedsecret"
+	hash := "7f01d0faef75b7bb9b54617508e2a44b2739a29b38c274bd126cc48a102880ad"
+	rows := sqlmock.NewRows([]string{"userId", "refreshToken", "expires", "revoked"}).
+		AddRow(user.Id, hash, time.Now().Add(time.Hour).Unix(), false)
+
+	query := `SELECT userId, refreshToken, expires, revoked FROM sessions WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs("testsession").WillReturnRows(rows)
+
+	// reusing an old refresh token revokes the whole session
+	query = `UPDATE sessions SET revoked \= TRUE WHERE id \= \? AND userId \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("testsession", user.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	res := postWithRefreshToken(sdk.RefreshToken(app), "testsession.refreshsecret")
+	test.Response(t, res, http.StatusUnauthorized)
+	test.MockExpectations(t, app)
+}
+
+func TestRefreshTokenMissing(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	res := test.Post("/v0/token/refresh", sdk.RefreshToken(app), nil)
+	test.Response(t, res, http.StatusUnauthorized)
+}
+
+// postWithRefreshToken calls the handler with the given refresh token cookie and no access token
+func postWithRefreshToken(handler httprouter.Handle, refresh string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/v0/token/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: "RefreshToken", Value: refresh})
+
+	res := httptest.NewRecorder()
+	handler(res, req, nil)
+	return res
 }
\ No newline at end of file
@@ -3,8 +3,8 @@ package sdk
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/pkg/application"
@@ -23,7 +23,8 @@ func UpdateBudget(app *application.App) httprouter.Handle {
 		var budget models.Budget
 		err := json.NewDecoder(r.Body).Decode(&budget)
 		if err != nil {
-			log.Println("Failed to decode budget from body")
+			msg := "Failed to decode budget from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
 			return
 		}
 
@@ -32,9 +33,9 @@ func UpdateBudget(app *application.App) httprouter.Handle {
 		userId := fmt.Sprintf("%v", r.Context().Value(models.Key("user")))
 
 		// updates any items in the budget.Request
-		if err := budget.Update(app, userId); err != nil {
+		if err := app.Budgets.Update(userId, &budget); err != nil {
 			msg := "Failed to store budget information in database"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
 			return
 		}
 
@@ -44,11 +45,54 @@ func UpdateBudget(app *application.App) httprouter.Handle {
 }
 
 // GetBudget handler gets the budget from the databse in the form of a JSONified budget
-// object returned in the responses result property. If there is an error with the
-// database connection or query it will be logged nad returned as a JSON response.
-// TODO make and test this function pls thank you!
+// object returned in the responses result property. Every category in the budget will also
+// contain how much has been spent in it and how much is remaining for the current month,
+// which is calculated from the stored transactions of every bank account linked to the user.
+// Stale items are synced in the background and items whose last sync failed are listed in the
+// errors of the response like in GetTransactions.
+// If there is an error with the database connection or query it will be logged and returned
+// as a JSON response.
 func GetBudget(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// gets the user id extracted from authentication cookie
+		userId := GetIDFromContext(r)
 
+		// gets the budget stored in the database
+		budget, err := app.Budgets.Get(userId)
+		if err != nil {
+			msg := "Failed to retrieve budget from database"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// gets all tokens affiliated with user
+		tokens, err := app.Tokens.List(userId)
+		if err != nil {
+			msg := "There was an error retrieving tokens from database affiliated with user"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// gets this period's transactions to calculate the spending of each category
+		failed := syncStaleItems(r.Context(), app, tokens)
+		startDate, endDate := currentPeriod(time.Now())
+		transactions, err := app.Transactions.List(userId, startDate, endDate)
+		if err != nil {
+			msg := "Failed to retrieve transactions from database"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		models.AddSpending(&budget, transactions)
+
+		msg := "Successfully retrieved budget"
+		models.CreatePartialResponse(w, r, msg, budget, failed)
 	}
 }
+
+// currentPeriod returns the first day of the month of the given time and the given time itself
+// formatted as dates that can be used to retrieve transactions for the current budget period
+func currentPeriod(now time.Time) (string, string) {
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return start.Format(iso8601TimeFormat), now.Format(iso8601TimeFormat)
+}
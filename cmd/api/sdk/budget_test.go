@@ -18,6 +18,8 @@ func TestCreateBudget(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	jsonObject, _ := json.Marshal(budget)
 
 	// test categories query
@@ -91,7 +93,7 @@ func TestGetBudget(t *testing.T) {
 		ExpectQuery(query2).
 		WillReturnRows(rows2)
 	
-	b, err := models.GetBudget(app, user.Id)
+	b, err := app.Budgets.Get(user.Id)
 	test.ModelMethod(t, err, "select")
 	test.MockExpectations(t, app)
 
@@ -99,4 +101,70 @@ func TestGetBudget(t *testing.T) {
 			b.Categories[0].WhiteList[0].Id != budget.Categories[0].WhiteList[0].Id {
 		t.Error("The function successfully executed but there was an error getting the correct budget")
 	}
-}
\ No newline at end of file
+}
+
+func TestGetBudgetWithSpending(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, false)
+
+	categories := budget.Request.Update.Categories
+
+	rows1 := sqlmock.NewRows([]string{"id", "name", "budget", "categoryId"}).
+		AddRow(user.Id, categories[0].Name, categories[0].Budget, categories[0].Id).
+		AddRow(user.Id, categories[1].Name, categories[1].Budget, categories[1].Id)
+
+	query1 := `SELECT id, name, budget, categoryId FROM categories WHERE categories.id \= \?`
+	app.DB.Mock.ExpectQuery(query1).WithArgs(user.Id).WillReturnRows(rows1)
+
+	rows2 := sqlmock.NewRows([]string{"id", "name", "category", "itemId"})
+	query2 := `SELECT id, name, category, itemId FROM whitelist WHERE whitelist.id \= \?`
+	app.DB.Mock.ExpectQuery(query2).WithArgs(user.Id).WillReturnRows(rows2)
+
+	// the user has no linked banks, so nothing has been spent
+	rows3 := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"})
+	query3 := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query3).WithArgs(user.Id).WillReturnRows(rows3)
+
+	rows4 := sqlmock.NewRows([]string{"data"})
+	query4 := `SELECT data FROM transactions WHERE userId \= \? AND date BETWEEN \? AND \?`
+	app.DB.Mock.ExpectQuery(query4).WillReturnRows(rows4)
+
+	res := test.GetWithCookie(
+		"/v0/budget",
+		middleware.Authenticate(sdk.GetBudget(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	var response struct {
+		Result models.Budget `json:"result"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal("Failed to decode body:", err)
+	}
+
+	if len(response.Result.Categories) != 2 || response.Result.Categories[1].Remaining != categories[1].Budget {
+		t.Fatal("The budget was returned, but the spending was not calculated correctly")
+	}
+}
+
+func TestGetBudgetFailure(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDBWhenFail(t, app)
+
+	test.ExpectSession(app, false)
+
+	res := test.GetWithCookie(
+		"/v0/budget",
+		middleware.Authenticate(sdk.GetBudget(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusBadGateway)
+}
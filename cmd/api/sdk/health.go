@@ -0,0 +1,95 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/version"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// readinessTimeout is how long every dependency is given to respond to a readiness check
+const readinessTimeout = 2 * time.Second
+
+// Readiness describes whether the api can serve requests, and the state of every dependency
+type Readiness struct {
+	Ready			bool						`json:"ready"`
+	Dependencies	map[string]DependencyStatus	`json:"dependencies"`
+}
+
+// DependencyStatus describes whether a dependency could be reached and how long it took
+type DependencyStatus struct {
+	Status		string	`json:"status"`	// up or down
+	LatencyMs	float64	`json:"latencyMs"`
+}
+
+// Healthz responds as long as the process is up and serving requests
+func Healthz() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		models.CreateResponse(w, "OK", nil)
+	}
+}
+
+// Readyz checks that the database and plaid can be reached. If any of them can't, the api is not
+// ready and the response has the http status 503 (Service Unavailable). The status and latency of
+// every dependency is responded either way, while the reasons they failed are only logged.
+func Readyz(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		checks := map[string]func(ctx context.Context) error {
+			"database":	app.DB.Client.PingContext,
+			"plaid":	app.Plaid.Ping,
+		}
+
+		readiness := Readiness { Ready: true, Dependencies: make(map[string]DependencyStatus) }
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+
+		// every dependency is checked at the same time
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check func(ctx context.Context) error) {
+				defer wg.Done()
+
+				start := time.Now()
+				err := check(ctx)
+				status := DependencyStatus {
+					Status:		"up",
+					LatencyMs:	float64(time.Since(start).Microseconds()) / 1000,
+				}
+
+				if err != nil {
+					app.Logger(ctx).Warn("Readiness check failed", "dependency", name, "error", err)
+					status.Status = "down"
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				readiness.Dependencies[name] = status
+				readiness.Ready = readiness.Ready && err == nil
+			}(name, check)
+		}
+		wg.Wait()
+
+		if !readiness.Ready {
+			models.CreateResponseWithStatus(w, http.StatusServiceUnavailable, "Not ready", readiness)
+			return
+		}
+
+		models.CreateResponse(w, "Ready", readiness)
+	}
+}
+
+// Version responds with the version of the api and how it was built
+func Version() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		models.CreateResponse(w, "Successfully retrieved version", version.Get())
+	}
+}
@@ -0,0 +1,79 @@
+package sdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+	"github.com/elopez00/scale-backend/pkg/version"
+)
+
+// getReadiness requests the readiness of the app and decodes it
+func getReadiness(t *testing.T, plaidErr error, status int) sdk.Readiness {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	app.Plaid.Ping = func(ctx context.Context) error {
+		return plaidErr
+	}
+
+	res := test.Get("/readyz", sdk.Readyz(app))
+	test.Response(t, res, status)
+
+	var response struct {
+		Result sdk.Readiness `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+
+	return response.Result
+}
+
+func TestHealthz(t *testing.T) {
+	res := test.Get("/healthz", sdk.Healthz())
+	test.Response(t, res, http.StatusOK)
+}
+
+func TestReadyz(t *testing.T) {
+	readiness := getReadiness(t, nil, http.StatusOK)
+	if !readiness.Ready {
+		t.Error("The app should be ready")
+	}
+
+	for _, name := range []string{"database", "plaid"} {
+		if readiness.Dependencies[name].Status != "up" {
+			t.Errorf("Expected %v to be up, got %+v", name, readiness.Dependencies[name])
+		}
+	}
+}
+
+func TestReadyzPlaidUnreachable(t *testing.T) {
+	readiness := getReadiness(t, errors.New("dial tcp: i/o timeout"), http.StatusServiceUnavailable)
+	if readiness.Ready {
+		t.Error("The app should not be ready without plaid")
+	}
+
+	if readiness.Dependencies["plaid"].Status != "down" || readiness.Dependencies["database"].Status != "up" {
+		t.Error("Unexpected dependencies:", readiness.Dependencies)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	version.Version, version.Commit = "v1.2.0", "abc123"
+	defer func() { version.Version, version.Commit = "", "" }()
+
+	res := test.Get("/version", sdk.Version())
+	test.Response(t, res, http.StatusOK)
+
+	var response struct {
+		Result version.Info `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+
+	if response.Result.Version != "v1.2.0" || response.Result.Commit != "abc123" || len(response.Result.GoVersion) == 0 {
+		t.Error("Unexpected version:", response.Result)
+	}
+}
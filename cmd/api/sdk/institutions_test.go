@@ -0,0 +1,115 @@
+package sdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// institutionServer fakes the plaid endpoints used to link an item and describe its institution
+func institutionServer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoder := json.NewEncoder(w)
+
+		switch r.URL.Path {
+		case "/item/public_token/exchange":
+			encoder.Encode(plaid.ExchangePublicTokenResponse{AccessToken: token.Value, ItemID: token.Id})
+		case "/item/get":
+			encoder.Encode(plaid.GetItemResponse{Item: plaid.Item{ItemID: token.Id, InstitutionID: "ins_1"}})
+		case "/institutions/get_by_id":
+			encoder.Encode(plaid.GetInstitutionByIDResponse{Institution: plaid.Institution{
+				ID:           "ins_1",
+				Name:         token.Institution,
+				Logo:         "iVBORw0KGgo=",
+				PrimaryColor: "#1f1f1f",
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestGetInstitutions(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+	defer test.WithPlaidServer(app, institutionServer())()
+
+	test.ExpectSession(app, false)
+
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"}).
+		AddRow(user.Id, test.EncryptToken(app, token.Id, token.Value), "test", token.Id, token.Institution, "ins_1", "", "2021-05-01", 1619827200).
+		AddRow(user.Id, "access-sandbox-2", "", "item2", "Other Bank", "", "ITEM_LOGIN_REQUIRED", "", 0)
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(user.Id).WillReturnRows(rows)
+
+	res := test.GetWithCookie(
+		"/v0/institutions",
+		middleware.Authenticate(sdk.GetInstitutions(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	// access tokens must never be sent to the client
+	body := res.Body.String()
+	if strings.Contains(body, token.Value) || strings.Contains(body, "access-sandbox-2") {
+		t.Fatal("The response contains an access token")
+	}
+
+	var response struct {
+		Result []models.Institution `json:"result"`
+	}
+	json.NewDecoder(strings.NewReader(body)).Decode(&response)
+
+	if len(response.Result) != 2 {
+		t.Fatal("Expected 2 institutions, got:", len(response.Result))
+	}
+
+	if first := response.Result[0]; first.Color != "#1f1f1f" || first.LastSync != 1619827200 || first.UpdateRequired {
+		t.Fatal("The first institution was not described correctly:", first)
+	}
+
+	if second := response.Result[1]; second.Status != "ITEM_LOGIN_REQUIRED" || !second.UpdateRequired {
+		t.Fatal("The second institution should require an update:", second)
+	}
+}
+
+func TestExchangePublicToken(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+	defer test.WithPlaidServer(app, institutionServer())()
+
+	test.ExpectSession(app, false)
+
+	// the new item is stored along with its institution
+	query := `INSERT INTO plaidtokens\(id, token, tokenKeyId, itemID, institution, institutionId\) VALUES\(\?,\?,\?,\?,\?,\?\)`
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(user.Id, test.EncryptedToken(app, token.Id, token.Value), "test", token.Id, token.Institution, "ins_1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body, _ := json.Marshal(publicToken)
+	res := test.PostWithCookie(
+		"/v0/token/exchange",
+		middleware.Authenticate(sdk.ExchangePublicToken(app), app),
+		bytes.NewBuffer(body),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
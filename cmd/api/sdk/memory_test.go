@@ -0,0 +1,232 @@
+package sdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// These tests use the memory stores, so they check what the handlers store and return instead of
+// which queries they run.
+
+func TestOnboardAndLoginInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	res := test.Post("/onboard", sdk.Onboard(app), getBody())
+	test.Response(t, res, http.StatusOK)
+
+	// the same user can't onboard twice
+	res = test.Post("/onboard", sdk.Onboard(app), getBody())
+	test.Response(t, res, http.StatusNotAcceptable)
+
+	res = test.Post("/login", sdk.Login(app), getBody())
+	test.Response(t, res, http.StatusOK)
+
+	wrong := user
+	wrong.Password = "wrong password"
+	body, _ := json.Marshal(wrong)
+	res = test.Post("/login", sdk.Login(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusUnauthorized)
+}
+
+func TestBearerTokensInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	// native clients ask for the tokens in the body instead of cookies
+	req, _ := http.NewRequest(http.MethodPost, "/onboard?tokens=true", getBody())
+	res := httptest.NewRecorder()
+	sdk.Onboard(app)(res, req, nil)
+	test.Response(t, res, http.StatusOK)
+
+	var response struct {
+		Result models.TokenPair `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+
+	tokens := response.Result
+	if len(tokens.AccessToken) == 0 || len(tokens.RefreshToken) == 0 || tokens.TokenType != "Bearer" || len(res.Result().Cookies()) > 0 {
+		t.Fatal("Expected the tokens in the body without cookies, got", tokens, res.Result().Cookies())
+	}
+
+	// the access token authenticates requests as a bearer token
+	authenticate := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, "/v0/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res := httptest.NewRecorder()
+		middleware.Authenticate(sdk.AuthCheck(), app)(res, req, nil)
+		return res
+	}
+	test.Response(t, authenticate(tokens.AccessToken), http.StatusOK)
+
+	// refresh tokens sent in the body are rotated and responded in the body too
+	body, _ := json.Marshal(map[string]string{"refreshToken": tokens.RefreshToken})
+	res = test.Post("/v0/token/refresh", sdk.RefreshToken(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusOK)
+	json.NewDecoder(res.Body).Decode(&response)
+
+	if response.Result.RefreshToken == tokens.RefreshToken || len(res.Result().Cookies()) > 0 {
+		t.Fatal("The refresh token was not rotated in the body:", response.Result)
+	}
+	test.Response(t, authenticate(response.Result.AccessToken), http.StatusOK)
+
+	// the old refresh token can't be used again
+	res = test.Post("/v0/token/refresh", sdk.RefreshToken(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusUnauthorized)
+}
+
+func TestUpdateAndGetBudgetInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	update := models.Budget{
+		Request: models.UpdateRequest{
+			Update: models.UpdateObject{
+				Categories: []models.Category{
+					{Id: "shopping", Name: "Shopping", Budget: 200},
+					{Id: "rent", Name: "Rent", Budget: 800},
+				},
+				WhiteList: []models.WhiteListItem{
+					{Id: "amazon", Category: "shopping", Name: "Amazon"},
+					{Id: "rise", Category: "rent", Name: "The Rise"},
+				},
+			},
+		},
+	}
+
+	body, _ := json.Marshal(update)
+	res := test.PostWithCookie("/v0/budget", middleware.Authenticate(sdk.UpdateBudget(app), app), bytes.NewBuffer(body), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	// removing a category removes its whitelist too
+	remove := models.Budget{
+		Request: models.UpdateRequest{
+			Remove: models.UpdateObject{Categories: []models.Category{{Id: "rent"}}},
+		},
+	}
+
+	body, _ = json.Marshal(remove)
+	res = test.PostWithCookie("/v0/budget", middleware.Authenticate(sdk.UpdateBudget(app), app), bytes.NewBuffer(body), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	res = test.GetWithCookie("/v0/budget", middleware.Authenticate(sdk.GetBudget(app), app), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	var response struct {
+		Result models.Budget `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+
+	categories := response.Result.Categories
+	if len(categories) != 1 || categories[0].Id != "shopping" || len(categories[0].WhiteList) != 1 {
+		t.Fatal("Unexpected budget:", categories)
+	}
+}
+
+func TestGetTransactionsInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	// the item was synced recently, so plaid is not called
+	app.Tokens.Add(user.Id, &token)
+	app.Tokens.SetCursor(token.Id, "2021-01-31")
+	app.Transactions.Save(user.Id, token.Id, []plaid.Transaction{
+		{ID: "transaction1", AccountID: "account1", Amount: 20, Date: "2021-01-03"},
+		{ID: "transaction2", AccountID: "account1", Amount: 5, Date: "2021-01-02"},
+		{ID: "transaction3", AccountID: "account2", Amount: 15, Date: "2021-01-01"},
+	})
+
+	var response struct {
+		Result models.TransactionPage `json:"result"`
+	}
+
+	res := test.GetWithCookie(
+		"/v0/transactions?start=2021-01-01&end=2021-01-31&min_amount=10&limit=1",
+		middleware.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+
+	json.NewDecoder(res.Body).Decode(&response)
+	if len(response.Result.Transactions) != 1 || response.Result.Transactions[0].ID != "transaction1" {
+		t.Fatal("Unexpected first page:", response.Result.Transactions)
+	}
+
+	res = test.GetWithCookie(
+		"/v0/transactions?start=2021-01-01&end=2021-01-31&min_amount=10&limit=1&cursor="+response.Result.Next,
+		middleware.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+
+	response.Result = models.TransactionPage{}
+	json.NewDecoder(res.Body).Decode(&response)
+	if len(response.Result.Transactions) != 1 || response.Result.Transactions[0].ID != "transaction3" || len(response.Result.Next) != 0 {
+		t.Fatal("Unexpected last page:", response.Result)
+	}
+}
+
+func TestUnlinkTokenInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(plaid.RemoveItemResponse{})
+	}))()
+
+	app.Tokens.Add(user.Id, &token)
+	app.Transactions.Save(user.Id, token.Id, []plaid.Transaction{{ID: "transaction1", Date: "2021-01-01"}})
+
+	res := test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/"+token.Id,
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+
+	// the item and its transactions are gone
+	if tokens, _ := app.Tokens.List(user.Id); len(tokens) != 0 {
+		t.Error("The token was not deleted")
+	}
+
+	if ids, _ := app.Transactions.Ids(token.Id, "2021-01-01", "2021-01-31"); len(ids) != 0 {
+		t.Error("The transactions of the item were not deleted")
+	}
+
+	// unlinking it again fails since it no longer exists
+	res = test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/"+token.Id,
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusNotFound)
+}
+
+func TestLogoutAllInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	res := test.PostWithCookie("/v0/logoutAll", middleware.Authenticate(sdk.LogoutAll(app), app), nil, app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	// the session can't be used anymore
+	res = test.GetWithCookie("/v0/budget", middleware.Authenticate(sdk.GetBudget(app), app), app, "AuthToken")
+	test.Response(t, res, http.StatusUnauthorized)
+}
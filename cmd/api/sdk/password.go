@@ -0,0 +1,155 @@
+package sdk
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+	"github.com/elopez00/scale-backend/pkg/application/mailer"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const resetTokenDuration = time.Hour // how long users have to choose a new password once they asked to
+
+// resetLimits keep the inbox of users and the password_resets table from being flooded: users have
+// to wait a minute before another reset email, and can get five of them in an hour
+var resetLimits = []models.ResetLimit{
+	{Window: time.Minute, Count: 1},
+	{Window: time.Hour, Count: 5},
+}
+
+// ForgotPassword emails a reset token to the user with the email in the body, which can be used
+// once within the hour to choose a new password. The response is the same whether the user
+// exists or not, and the email is sent by the worker after responding, so that the endpoint can't
+// be used to find out which emails have an account. Reset emails are throttled per user like verification
+// emails, requests past the limits are silently ignored for the same reason.
+func ForgotPassword(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer CloseBody(r)
+
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			msg := "Failed to decode email from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+			return
+		}
+
+		// requests for the same email that are still waiting are only sent once
+		log := app.Logger(r.Context())
+		email := body.Email
+		err := app.Worker.Add("password-reset:"+hashToken(email), func() error {
+			return sendPasswordReset(app, log, email)
+		})
+		if err != nil {
+			log.Error("Failed to queue password reset", "error", err)
+		}
+
+		msg := "If the email belongs to a user, a password reset email was sent"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// sendPasswordReset creates a password reset for the user with the email and emails its token to
+// them. Nothing is sent if there is no such user or they requested too many resets.
+func sendPasswordReset(app *application.App, log *logger.Logger, email string) error {
+	user, err := app.Users.GetCredentials(email)
+	if err == sql.ErrNoRows {
+		log.Info("Password reset requested for an unknown email")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get user for password reset: %v", err)
+	}
+
+	now := time.Now()
+	token := generateSecret()
+	reset := models.PasswordReset{
+		TokenHash: hashToken(token),
+		UserId:    user.Id,
+		Created:   now.Unix(),
+		Expires:   now.Add(resetTokenDuration).Unix(),
+	}
+	if err := app.Resets.CreateLimited(&reset, resetLimits...); err == models.ErrTooManyResets {
+		log.Warn("Too many password resets requested", "userId", user.Id)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to create password reset of user %s: %v", user.Id, err)
+	}
+
+	if err := app.Mailer.Send(resetMessage(app, user.Email, token)); err != nil {
+		return fmt.Errorf("failed to send password reset email to user %s: %v", user.Id, err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets the password in the body as the password of the user the reset token in the
+// body was sent to. The token can only be used once, and every session of the user is revoked so
+// that whoever knew the old password is signed out.
+func ResetPassword(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer CloseBody(r)
+
+		var body struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			msg := "Failed to decode reset token from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+			return
+		}
+
+		if detail := models.ValidatePassword(body.Password); detail != nil {
+			msg := "Invalid password"
+			models.CreateValidationError(w, r, models.CodeValidationFailed, msg, []models.FieldError{*detail})
+			return
+		}
+
+		userId, err := app.Resets.Consume(hashToken(body.Token))
+		if err == models.ErrInvalidResetToken {
+			msg := "Invalid reset token"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidResetToken, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Failed to reset password"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if err := app.Users.SetPassword(userId, encryptPassword(body.Password)); err != nil {
+			msg := "Failed to reset password"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if err := app.Sessions.RevokeAll(userId); err != nil {
+			msg := "Password was reset but the user could not be signed out of all devices"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Password successfully reset"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// resetMessage returns the email that gives the user their reset token. The token is a link to
+// the dashboard if APP_URL is configured.
+func resetMessage(app *application.App, email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your Scale account. If it was you, use this to choose a new password within the next hour:\n\n%s\n\nIf it wasn't you, you can ignore this email.\n",
+			appLink(app, "/reset-password", token),
+		),
+	}
+}
@@ -0,0 +1,103 @@
+package sdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+)
+
+func TestPasswordResetInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+	app.Config.Mail.AppURL = "https://app.example.com/"
+
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+
+	// onboarding sends the verification email, which has to be read before the reset email
+	if message := test.GetMailbox(app).Receive(t); !strings.Contains(message.Subject, "Verify") {
+		t.Fatal("Expected the verification email, got", message)
+	}
+
+	body, _ := json.Marshal(map[string]string{"email": user.Email})
+	res := test.Post("/v0/password/forgot", sdk.ForgotPassword(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusOK)
+
+	message := test.GetMailbox(app).Receive(t)
+	prefix := "https://app.example.com/reset-password?token="
+	start := strings.Index(message.Body, prefix)
+	if message.To != user.Email || start < 0 {
+		t.Fatal("Unexpected reset email:", message)
+	}
+	token := strings.Fields(message.Body[start+len(prefix):])[0]
+
+	reset := func(token, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"token": token, "password": password})
+		return test.Post("/v0/password/reset", sdk.ResetPassword(app), bytes.NewBuffer(body))
+	}
+
+	// the new password has to be valid
+	res = reset(token, "short")
+	test.Response(t, res, http.StatusBadRequest)
+	test.Error(t, res, models.CodeValidationFailed)
+
+	res = reset(token, "a new password")
+	test.Response(t, res, http.StatusOK)
+
+	// the token can only be used once
+	res = reset(token, "another password")
+	test.Response(t, res, http.StatusBadRequest)
+	test.Error(t, res, models.CodeInvalidResetToken)
+
+	// the user is signed out of every session and logs in with the new password
+	if active, _ := app.Sessions.IsActive("testsession", user.Id); active {
+		t.Error("The sessions of the user should have been revoked")
+	}
+
+	test.Response(t, test.Post("/login", sdk.Login(app), getBody()), http.StatusUnauthorized)
+
+	login := user
+	login.Password = "a new password"
+	body, _ = json.Marshal(login)
+	test.Response(t, test.Post("/login", sdk.Login(app), bytes.NewBuffer(body)), http.StatusOK)
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	// the response does not reveal whether the email has an account
+	body, _ := json.Marshal(map[string]string{"email": "nobody@southpark.com"})
+	res := test.Post("/v0/password/forgot", sdk.ForgotPassword(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusOK)
+
+	test.GetMailbox(app).Empty(t, 50*time.Millisecond)
+}
+
+func TestForgotPasswordThrottled(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+	test.GetMailbox(app).Receive(t)
+
+	forgot := func() {
+		body, _ := json.Marshal(map[string]string{"email": user.Email})
+		res := test.Post("/v0/password/forgot", sdk.ForgotPassword(app), bytes.NewBuffer(body))
+		test.Response(t, res, http.StatusOK)
+	}
+
+	forgot()
+	test.GetMailbox(app).Receive(t)
+
+	// another reset within the minute responds the same but sends nothing
+	forgot()
+	test.GetMailbox(app).Empty(t, 50*time.Millisecond)
+}
@@ -3,8 +3,9 @@ package sdk
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,16 +21,8 @@ import (
 func GetPlaidToken(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		// creates token configuration
-		tokenConfig := plaid.LinkTokenConfigs{
-			User: &plaid.LinkTokenUser{
-				ClientUserID: GetIDFromContext(r),
-			},
-			ClientName:   "Scale",
-			Products:     []string{"auth", "transactions"},
-			CountryCodes: []string{app.Config.GetPlaid()["countryCode"]},
-			Language:     "en",
-			Webhook:      app.Plaid.RedirectURL,
-		}
+		tokenConfig := linkTokenConfig(app, GetIDFromContext(r))
+		tokenConfig.Products = app.Config.Plaid.Products
 
 		// calls on the app's plaid client and creates a link token with the configuration
 		// provided by the tokenConfig struct. If for whatever reason the client fails, it
@@ -37,7 +30,7 @@ func GetPlaidToken(app *application.App) httprouter.Handle {
 		tokenResponse, err := app.Plaid.Client.CreateLinkToken(tokenConfig)
 		if err != nil {
 			msg := "Failure to load client"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreatePlaidError(w, r, msg, err, "")
 			return
 		}
 
@@ -57,27 +50,21 @@ func UpdatePlaidToken(app *application.App) httprouter.Handle {
 
 		var token models.Token
 		if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
-			log.Println("Failed to decode token object from json")
+			msg := "Failed to decode token object from json"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
 			return
 		}
 
 		// get the token
-		if err := token.Get(app, userId); err != nil {
+		if err := app.Tokens.Get(userId, &token); err != nil {
 			msg := "Failed to get token from database"
-			models.CreateError(w, http.StatusNotFound, msg, err)
+			models.CreateError(w, r, http.StatusNotFound, models.CodeItemNotFound, msg, err)
 			return
 		}
 
-		tokenConfig := plaid.LinkTokenConfigs{
-			User: &plaid.LinkTokenUser{
-				ClientUserID: GetIDFromContext(r),
-			},
-			ClientName:   "Scale",
-			CountryCodes: []string{app.Config.GetPlaid()["countryCode"]},
-			Language:     "en",
-			Webhook:      app.Plaid.RedirectURL,
-			AccessToken: token.Value,
-		}
+		// products can't be given in update mode, the item keeps the ones it was linked with
+		tokenConfig := linkTokenConfig(app, GetIDFromContext(r))
+		tokenConfig.AccessToken = token.Value
 
 		// by establishing the config with an access token, we return a link token that can
 		// operate under update mode which will automatically handle institutions that need
@@ -85,7 +72,7 @@ func UpdatePlaidToken(app *application.App) httprouter.Handle {
 		res, err := app.Plaid.Client.CreateLinkToken(tokenConfig)
 		if err != nil {
 			msg := "Failed to update token"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreatePlaidError(w, r, msg, err, token.Id)
 			return
 		}
 
@@ -97,7 +84,8 @@ func UpdatePlaidToken(app *application.App) httprouter.Handle {
 // ExchangePublicToken this function takes care of creating the permanent access token
 // that will be stored in the database for cross-platform connection to users' bank.
 // If for whatever reason there is a problem with the client or public token, there
-// are json responses and logs that will adequately reflect all issues
+// are json responses and logs that will adequately reflect all issues. The transactions of the
+// item are synced by the worker once it is stored.
 func ExchangePublicToken(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		defer CloseBody(r)
@@ -105,7 +93,8 @@ func ExchangePublicToken(app *application.App) httprouter.Handle {
 		var token models.Token
 		err := json.NewDecoder(r.Body).Decode(&token)
 		if err != nil {
-			log.Println("Failed to decode token object from json")
+			msg := "Failed to decode token object from json"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
 			return
 		}
 
@@ -114,24 +103,32 @@ func ExchangePublicToken(app *application.App) httprouter.Handle {
 		res, err := app.Plaid.Client.ExchangePublicToken(token.Value)
 		if err != nil {
 			msg := "Failure to exchange link token"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreatePlaidError(w, r, msg, err, "")
 			return
 		}
 
 		// sets value of token to response values
 		token.Value = res.AccessToken
 		token.Id = res.ItemID
-		
-		// get the institution name
-		institution, err := app.Plaid.Client.GetInstitutionByID(token.Id, []string{"US"})
+
+		// get the institution of the item
+		item, err := app.Plaid.Client.GetItem(token.Value)
+		if err != nil {
+			msg := "Failure to get item"
+			models.CreatePlaidError(w, r, msg, err, token.Id)
+			return
+		}
+
+		institution, err := app.Plaid.Client.GetInstitutionByID(item.Item.InstitutionID, app.Config.Plaid.CountryCodes)
 		if err != nil {
 			msg := "Failuer to get institution"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreatePlaidError(w, r, msg, err, token.Id)
 			return
 		}
 
 		// assign institution
 		token.Institution = institution.Institution.Name
+		token.InstitutionId = institution.Institution.ID
 
 		// gets the user id extracted from authentication cookie for later
 		// use in the creation of the row containing the permanent token
@@ -139,103 +136,166 @@ func ExchangePublicToken(app *application.App) httprouter.Handle {
 
 		// handles failures in the addition of tokens to the database and reflects
 		// any success or failure in json response/server logs
-		if r.Method == http.MethodGet {
-			if err = token.Add(app, userId); err != nil {
+		if r.Method == http.MethodPost {
+			if err = app.Tokens.Add(userId, &token); err != nil {
 				msg := "Failure to create access token"
-				models.CreateError(w, http.StatusBadGateway, msg, err)
+				models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
 				return
 			}
 		} else {
-			if err = token.Update(app, userId); err != nil {
+			if err = app.Tokens.Update(userId, &token); err != nil {
 				msg := "Failure to update access token"
-				models.CreateError(w, http.StatusBadGateway, msg, err)
+				models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
 				return
 			}
 		}
 
+		// the transactions of the item are downloaded in the background, so they are stored
+		// by the time they are asked for
+		if err := queueSync(app, token.Id); err != nil {
+			app.Logger(r.Context()).Warn("Failed to queue sync of item", "itemId", token.Id, "error", err)
+		}
+
 		msg := "Access token created successfully"
 		models.CreateResponse(w, msg, nil)
 	}
 }
 
-// GetTransactions is a function will get transactions from the past 12 months from all
-// bank accounts affiliated with the user. If there is an error with the database retrieval
-// or the plaid client call, this will be reflected in the json response accordingly.
-func GetTransactions(app *application.App) httprouter.Handle {
+// GetInstitutions returns every bank the user linked along with the health of its connection,
+// which includes the last time its transactions were synced and whether the user has to log in
+// again through link in update mode. The logo and color of each institution are retrieved from
+// plaid, if that fails the institution is still returned without them. Access tokens are never
+// part of the response. If the tokens can't be retrieved from the database, it will be returned
+// as a JSON error response.
+func GetInstitutions(app *application.App) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		// create the user with the id obtained from middleware context
 		userId := GetIDFromContext(r)
 
-		// gets all tokens affiliated with user
-		tokens, err := models.GetTokens(app, userId)
+		tokens, err := app.Tokens.List(userId)
 		if err != nil {
 			msg := "There was an error retrieving tokens from database affiliated with user"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
 		}
 
-		// determines the ending and starting dates to retrieve transactions
-		const iso8601TimeFormat = "2006-01-02"
-		startDate := time.Now().Add(-12 * 30 * 24 * time.Hour).Format(iso8601TimeFormat)
-		endDate := time.Now().Format(iso8601TimeFormat)
-
-		// initialize wait group
 		var waitGroup sync.WaitGroup
-		
-		// initialize context
-		ctx, cancel := context.WithCancel(r.Context())
-		defer cancel()
+		institutions := make([]models.Institution, len(tokens))
 
-		// make transactions map that will be returned in result
-		transactions := make(map[string][]plaid.Transaction)
-
-		// handling async error
-		var asyncError error
-		var institution string
+		for i, token := range tokens {
+			institutions[i] = models.NewInstitution(token)
+			if len(token.InstitutionId) == 0 {
+				continue
+			}
 
-		for _, token := range tokens {
 			waitGroup.Add(1)
 
-			go func(token *models.Token) {
+			go func(institution *models.Institution, id string) {
 				defer waitGroup.Done()
 
-				// stop all incoming processes after error
-				select {
-				case <- ctx.Done(): return
-				default: 
-				}
-
-				// gets the transactions from plaid, if there is any error in the request,
-				// it will be returned as a JSON response
-				res, err := app.Plaid.Client.GetTransactions(token.Value, startDate, endDate)
+				res, err := app.Plaid.Client.GetInstitutionByIDWithOptions(
+					id,
+					app.Config.Plaid.CountryCodes,
+					plaid.GetInstitutionByIDOptions{IncludeOptionalMetadata: true},
+				)
 				if err != nil {
-					asyncError = err
-					if GetPlaidErrorCode(err) == "ITEM_LOGIN_REQUIRED" {
-						institution = token.Id
-					}
-					cancel()
+					app.Logger(r.Context()).Warn("Failed to get institution metadata", "institutionId", id, "error", err)
 					return
 				}
-	
-				// loop through all transactions and put them in transactions map
-				for _, transaction := range res.Transactions {
-					transactions[transaction.AccountID] = append(transactions[transaction.AccountID], transaction)
-				}
-			}(token)
+
+				institution.Logo = res.Institution.Logo
+				institution.Color = res.Institution.PrimaryColor
+			}(&institutions[i], token.InstitutionId)
 		}
 
 		waitGroup.Wait()
 
-		if ctx.Err() == nil {
-			msg := "Successfully retrieved transactions from all bank accounts"
-			models.CreateResponse(w, msg, transactions)
-		} else {
-			msg := "Failed to retrieve tokens from Plaid client"
-			if len(institution) > 0 {
-				models.CreateErrorWithResult(w, http.StatusBadGateway, msg, asyncError, institution)
-			} else {
-				models.CreateError(w, http.StatusBadGateway, msg, asyncError)
+		msg := "Successfully retrieved institutions"
+		models.CreateResponse(w, msg, institutions)
+	}
+}
+
+// UnlinkToken removes the bank identified by the itemId parameter from the user's account. The
+// item is removed from plaid so the access token can't be used anymore, and then the token and
+// every piece of data stored for the item are deleted from the database. If plaid no longer knows
+// about the item, it is still deleted locally. Any failure will be returned as a JSON response.
+func UnlinkToken(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		userId := GetIDFromContext(r)
+
+		// get the token of the item
+		token := models.Token{Id: p.ByName("itemId")}
+		if err := app.Tokens.Get(userId, &token); err != nil {
+			msg := "Failed to get token from database"
+			models.CreateError(w, r, http.StatusNotFound, models.CodeItemNotFound, msg, err)
+			return
+		}
+
+		// remove the item from plaid, items plaid does not know about anymore are already removed
+		if _, err := app.Plaid.Client.RemoveItem(token.Value); err != nil {
+			if models.PlaidErrorCode(err) != "ITEM_NOT_FOUND" {
+				msg := "Failed to remove item from Plaid client"
+				models.CreatePlaidError(w, r, msg, err, token.Id)
+				return
 			}
-		}	
+		}
+
+		if err := app.Tokens.Delete(userId, &token); err != nil {
+			msg := "Failed to delete token from database"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Successfully unlinked bank"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// GetTransactions is a function that will get a page of transactions from all bank accounts
+// affiliated with the user. Transactions are served from the database, and the items that have
+// not been synced recently are queued to be synced with plaid by the worker. The transactions can be filtered with the
+// query parameters start, end, account_id, category, min_amount, and max_amount, and paginated
+// with limit and cursor, where cursor is the next cursor returned by the previous page. By default
+// the transactions of the past 12 months are returned. Items whose last sync failed are listed in
+// the errors of the response with their code and item id, while their stored transactions are
+// still returned. If the query is malformed or there is an error with the database retrieval, this will
+// be reflected in the json response accordingly.
+func GetTransactions(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// create the user with the id obtained from middleware context
+		userId := GetIDFromContext(r)
+
+		// determines which transactions were requested
+		filter, fieldError := parseTransactionFilter(r, time.Now())
+		if fieldError != nil {
+			msg := "Invalid transaction query: " + fieldError.Error()
+			models.CreateValidationError(w, r, models.CodeInvalidQuery, msg, []models.FieldError{*fieldError})
+			return
+		}
+
+		// gets all tokens affiliated with user
+		tokens, err := app.Tokens.List(userId)
+		if err != nil {
+			msg := "There was an error retrieving tokens from database affiliated with user"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// the stored transactions are served while the stale items are synced in the background
+		failed := syncStaleItems(r.Context(), app, tokens)
+		page, err := app.Transactions.Find(userId, filter)
+		if err == models.ErrInvalidCursor {
+			msg := "Invalid transaction query: " + err.Error()
+			details := []models.FieldError{{Field: "cursor", Message: "is not a cursor returned by a previous page"}}
+			models.CreateValidationError(w, r, models.CodeInvalidQuery, msg, details)
+			return
+		} else if err != nil {
+			msg := "Failed to retrieve transactions from database"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Successfully retrieved transactions from all bank accounts"
+		models.CreatePartialResponse(w, r, msg, page, failed)
 	}
 }
 
@@ -249,14 +309,16 @@ func GetBalance(app *application.App) httprouter.Handle {
 		userId := GetIDFromContext(r)
 
 		// get all tokens with the user id
-		tokens, err := models.GetTokens(app, userId)
+		tokens, err := app.Tokens.List(userId)
 		if err != nil {
 			msg := "There was an error retrieving tokens from database affiliated with user"
-			models.CreateError(w, http.StatusBadGateway, msg, err)
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
 		}
 		
-		// create waitGroup
+		// create waitGroup and the mutex that guards the balance
 		var waitGroup sync.WaitGroup
+		var mutex sync.Mutex
 
 		// creating a context with cancel
 		ctx, cancel := context.WithCancel(r.Context())
@@ -265,9 +327,9 @@ func GetBalance(app *application.App) httprouter.Handle {
 		// define a balance object and loop through tokens to start creating it
 		var balance models.Balance
 
-		// create continuous error
+		// create continuous error along with the item it happened for
 		var asyncError error
-		var faultyInstitute string
+		var failedItem string
 
 		for _, token := range tokens {
 			waitGroup.Add(1)
@@ -288,36 +350,29 @@ func GetBalance(app *application.App) httprouter.Handle {
 				res, err := app.Plaid.Client.GetLiabilities(token.Value)
 
 				// if getting liabilities fails because the product is not supported, then try to get 
-				// the balances to at least have general info, and it will log it to the server. If the
-				// liabilities call or the balances call fail for any other reason, it will return
-				// as json response
+				// the balances to at least have general info. If the liabilities call or the balances
+				// call fail for any other reason, it will return as json response
+				if err != nil && models.PlaidErrorCode(err) == "PRODUCTS_NOT_SUPPORTED" {
+					backup, err = app.Plaid.Client.GetAccounts(token.Value)
+				}
+
 				if err != nil {
-					switch (GetPlaidErrorCode(err)) {
-					case "PRODUCTS_NOT_SUPPORTED": 
-						{
-							if backup, err = app.Plaid.Client.GetAccounts(token.Value); err != nil {
-								asyncError = err
-								cancel()
-								return
-							}; break
-						}
-					case "ITEM_LOGIN_REQUIRED": 
-						{
-							faultyInstitute = token.Id
-							asyncError = err
-							cancel()
-							return
-						}
-					default: 
-						{
-							asyncError = err
-							cancel()
-							return
-						}
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					if asyncError == nil {
+						asyncError = err
+						failedItem = token.Id
 					}
+					cancel()
+					return
 				}
 
-				// loop through all accounts related to that token
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				// loop through all accounts related to that token, the accounts of items that
+				// don't support liabilities are added without them
 				if len(backup.Accounts) == 0 {
 					liabilities := models.PlaidLiabilities(res.Liabilities)
 
@@ -326,7 +381,7 @@ func GetBalance(app *application.App) httprouter.Handle {
 					}
 				}
 
-				for _, account := range res.Accounts {
+				for _, account := range backup.Accounts {
 					balance.AddBalance(token.Institution, account, &models.PlaidLiabilities{})
 				}
 			}(token)
@@ -340,11 +395,93 @@ func GetBalance(app *application.App) httprouter.Handle {
 			models.CreateResponse(w, msg, balance)
 		} else {
 			msg := "Error retrieving Balances from client"
-			if len(faultyInstitute) > 0 {
-				models.CreateErrorWithResult(w, http.StatusBadGateway, msg, asyncError, faultyInstitute)
-			} else {
-				models.CreateError(w, http.StatusBadGateway, msg, asyncError)
+			models.CreatePlaidError(w, r, msg, asyncError, failedItem)
+		}
+	}
+}
+
+
+// iso8601TimeFormat is the date format plaid expects for transaction date ranges
+const iso8601TimeFormat = "2006-01-02"
+
+const (
+	defaultTransactionLimit = 100 // transactions returned per page when no limit is given
+	maxTransactionLimit     = 500 // most transactions that can be returned per page
+)
+
+// parseTransactionFilter creates the transaction filter described by the query string of the
+// request. If a parameter is malformed, an error describing which one is returned.
+func parseTransactionFilter(r *http.Request, now time.Time) (models.TransactionFilter, *models.FieldError) {
+	query := r.URL.Query()
+	filter := models.TransactionFilter{
+		StartDate:  now.AddDate(-1, 0, 0).Format(iso8601TimeFormat),
+		EndDate:    now.Format(iso8601TimeFormat),
+		AccountIds: query["account_id"],
+		Category:   query.Get("category"),
+		Limit:      defaultTransactionLimit,
+		Cursor:     query.Get("cursor"),
+	}
+
+	// the bounds are checked in order, so that the same field is reported when several are invalid
+	dates := []struct {
+		name  string
+		value *string
+	}{{"start", &filter.StartDate}, {"end", &filter.EndDate}}
+
+	for _, date := range dates {
+		if value := query.Get(date.name); len(value) > 0 {
+			if _, err := time.Parse(iso8601TimeFormat, value); err != nil {
+				return filter, &models.FieldError{Field: date.name, Message: "must be a date formatted as YYYY-MM-DD"}
+			}
+			*date.value = value
+		}
+	}
+
+	if filter.StartDate > filter.EndDate {
+		return filter, &models.FieldError{Field: "start", Message: "must not be after end"}
+	}
+
+	amounts := []struct {
+		name  string
+		value **float64
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}}
+
+	for _, amount := range amounts {
+		if value := query.Get(amount.name); len(value) > 0 {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return filter, &models.FieldError{Field: amount.name, Message: "must be a number"}
 			}
+			*amount.value = &parsed
 		}
 	}
+
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, &models.FieldError{Field: "min_amount", Message: "must not be larger than max_amount"}
+	}
+
+	if value := query.Get("limit"); len(value) > 0 {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTransactionLimit {
+			return filter, &models.FieldError{Field: "limit", Message: fmt.Sprintf("must be a number between 1 and %d", maxTransactionLimit)}
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// linkTokenConfig creates the link token configuration shared by every link token of the user,
+// described by the plaid section of the application config
+func linkTokenConfig(app *application.App, userId string) plaid.LinkTokenConfigs {
+	return plaid.LinkTokenConfigs{
+		User: &plaid.LinkTokenUser{
+			ClientUserID: userId,
+		},
+		ClientName:   app.Config.Plaid.ClientName,
+		CountryCodes: app.Config.Plaid.CountryCodes,
+		Language:     app.Config.Plaid.Language,
+		Webhook:      app.Config.Plaid.Webhook,
+		RedirectUri:  app.Config.Plaid.RedirectURI,
+	}
 }
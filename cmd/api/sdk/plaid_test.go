@@ -2,13 +2,20 @@ package sdk_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	m "github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/application"
 	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/plaid/plaid-go/plaid"
 )
 
 // * Test Functions will invalid Plaid clients *
@@ -17,6 +24,8 @@ func TestLinkTokenInvalidClient(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	res := test.GetWithCookie(
 		"/v0/getLinkToken",
 		m.Authenticate(sdk.GetPlaidToken(app), app),
@@ -31,6 +40,8 @@ func TestExchangePublicTokenInvalidClient(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	body, _ := json.Marshal(publicToken)
 
 	res := test.PostWithCookie(
@@ -48,6 +59,8 @@ func TestGetTransactionsInvalidClient(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	body, _ := json.Marshal(publicToken)
 
 	res := test.PostWithCookie(
@@ -65,6 +78,8 @@ func TestGetBalancesInvalidClient(t *testing.T) {
 	app := test.GetMockApp()
 	defer test.CloseDB(t, app)
 
+	test.ExpectSession(app, false)
+
 	res := test.GetWithCookie(
 		"/v0/getBalances",
 		m.Authenticate(sdk.GetBalance(app), app),
@@ -77,9 +92,60 @@ func TestGetBalancesInvalidClient(t *testing.T) {
 
 // * Test calls with valid Plaid Clients *
 
+// fakeItem is the item the fake plaid server serves for token, with a checking account and a
+// credit card whose last payment is known, along with a transaction made today on each
+func fakeItem() *test.FakeItem {
+	today := time.Now().Format("2006-01-02")
+
+	return &test.FakeItem{
+		Item: plaid.Item{ItemID: token.Id},
+		Accounts: []plaid.Account{
+			{AccountID: "checking", Name: "Checking", Type: "depository", Balances: plaid.AccountBalances{Current: 500}},
+			{AccountID: "credit", Name: "Credit Card", Type: "credit", Balances: plaid.AccountBalances{Current: 100}},
+		},
+		Credit: []plaid.CreditLiability{{AccountID: "credit", LastPaymentAmount: 50, LastPaymentDate: "2021-05-01"}},
+		Transactions: []plaid.Transaction{
+			{ID: "transaction1", AccountID: "checking", Amount: 20, Date: today, Name: "Aldi"},
+			{ID: "transaction2", AccountID: "credit", Amount: 40, Date: today, Name: "Amazon"},
+		},
+	}
+}
+
+// getFakePlaidApp returns an application with memory stores whose plaid client sends every
+// request to a fake plaid server that can exchange publicToken for the item of token. The
+// returned function shuts down the fake server and should be deferred.
+func getFakePlaidApp(item *test.FakeItem) (*application.App, *test.FakePlaid, func()) {
+	app := test.GetMemoryApp()
+	fake := test.NewFakePlaid()
+	fake.AddItem(publicToken.Value, token.Value, plaid.Institution{ID: "ins_1", Name: token.Institution}, item)
+
+	return app, fake, test.WithPlaidServer(app, fake)
+}
+
+// getBalance requests the balance of the user and decodes the balance from the response
+func getBalance(t *testing.T, app *application.App, status int) models.Balance {
+	res := test.GetWithCookie(
+		"/v0/getBalances",
+		m.Authenticate(sdk.GetBalance(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, status)
+
+	var response struct {
+		Result models.Balance `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+
+	return response.Result
+}
+
 func TestGetLinkToken(t *testing.T) {
-	app := test.GetPlaidMockApp()
+	app, fake, closeServer := test.GetPlaidMockApp()
 	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	test.ExpectSession(app, false)
 
 	res := test.GetWithCookie(
 		"/v0/getLinkToken",
@@ -89,55 +155,228 @@ func TestGetLinkToken(t *testing.T) {
 	)
 
 	test.Response(t, res, http.StatusOK)
+	if len(fake.LinkTokens) != 1 || fake.LinkTokens[0].User.ClientUserID != user.Id {
+		t.Fatal("The link token was not created for the user:", fake.LinkTokens)
+	}
+}
+
+func TestExchangePublicTokenOnce(t *testing.T) {
+	app, _, closeServer := getFakePlaidApp(fakeItem())
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	body, _ := json.Marshal(publicToken)
+	res := test.PostWithCookie(
+		"/v0/exchangePublicToken",
+		m.Authenticate(sdk.ExchangePublicToken(app), app),
+		bytes.NewBuffer(body),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+
+	stored := models.Token{Id: token.Id}
+	if err := app.Tokens.Get(user.Id, &stored); err != nil || stored.Value != token.Value || stored.InstitutionId != "ins_1" {
+		t.Fatal("The item was not stored:", stored, err)
+	}
+
+	// public tokens can only be exchanged once
+	res = test.PostWithCookie(
+		"/v0/exchangePublicToken",
+		m.Authenticate(sdk.ExchangePublicToken(app), app),
+		bytes.NewBuffer(body),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusBadGateway)
+
+	// the transactions of the new item are synced without waiting for them to be asked for
+	waitForSyncs(t, app)
+	today := time.Now().Format("2006-01-02")
+	if transactions, err := app.Transactions.List(user.Id, today, today); err != nil || len(transactions) != 2 {
+		t.Fatal("The transactions of the new item were not synced:", transactions, err)
+	}
+}
+
+func TestGetBalances(t *testing.T) {
+	app, _, closeServer := getFakePlaidApp(fakeItem())
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	balance := getBalance(t, app, http.StatusOK)
+	if len(balance.Liquid) != 1 || len(balance.Credit) != 1 || balance.Credit[0].Due != 50 || balance.Net.Total != 400 {
+		t.Fatal("Unexpected balance:", balance)
+	}
+}
+
+func TestGetBalancesProductsNotSupported(t *testing.T) {
+	item := fakeItem()
+	item.Errors = map[string]plaid.Error{
+		"/liabilities/get": test.PlaidError("ITEM_ERROR", "PRODUCTS_NOT_SUPPORTED"),
+	}
+
+	app, _, closeServer := getFakePlaidApp(item)
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	// the accounts are still returned, just without their liabilities
+	balance := getBalance(t, app, http.StatusOK)
+	if len(balance.Liquid) != 1 || len(balance.Credit) != 1 || balance.Credit[0].Due != 0 || balance.Net.Total != 400 {
+		t.Fatal("Unexpected balance:", balance)
+	}
+}
+
+func TestGetBalancesItemLoginRequired(t *testing.T) {
+	item := fakeItem()
+	item.Errors = map[string]plaid.Error{
+		"/liabilities/get": test.PlaidError("ITEM_ERROR", "ITEM_LOGIN_REQUIRED"),
+	}
+
+	app, _, closeServer := getFakePlaidApp(item)
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	res := test.GetWithCookie(
+		"/v0/getBalances",
+		m.Authenticate(sdk.GetBalance(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusBadGateway)
+
+	// the item that has to be updated is returned so the user can log in again
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+	if response.Error == nil || response.Error.Code != "ITEM_LOGIN_REQUIRED" || response.Error.ItemId != token.Id {
+		t.Fatal("The item that failed was not returned:", response.Error)
+	}
+}
+
+// waitForSyncs stops the worker of the application once every queued sync finished
+func waitForSyncs(t *testing.T, app *application.App) {
+	if err := app.Worker.Stop(context.Background()); err != nil {
+		t.Fatal("Failed to wait for the syncs:", err)
+	}
+}
+
+func TestGetTransactionsFromFakePlaid(t *testing.T) {
+	app, _, closeServer := getFakePlaidApp(fakeItem())
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	getTransactions := func() []plaid.Transaction {
+		res := test.GetWithCookie(
+			"/v0/transactions",
+			m.Authenticate(sdk.GetTransactions(app), app),
+			app,
+			"AuthToken",
+		)
+		test.Response(t, res, http.StatusOK)
+
+		var response struct {
+			Result models.TransactionPage `json:"result"`
+		}
+		json.NewDecoder(res.Body).Decode(&response)
+		return response.Result.Transactions
+	}
+
+	// the item was never synced, so nothing is stored yet and plaid is left to the worker
+	if transactions := getTransactions(); len(transactions) != 0 {
+		t.Fatal("The request should not have waited for plaid:", transactions)
+	}
+
+	waitForSyncs(t, app)
+	if transactions := getTransactions(); len(transactions) != 2 {
+		t.Fatal("The transactions were not synced:", transactions)
+	}
+}
+
+func TestGetTransactionsItemLoginRequired(t *testing.T) {
+	item := fakeItem()
+	item.Errors = map[string]plaid.Error{
+		"/transactions/get": test.PlaidError("ITEM_ERROR", "ITEM_LOGIN_REQUIRED"),
+	}
+
+	app, _, closeServer := getFakePlaidApp(item)
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	// the sync fails in the background, and the item is marked as needing an update
+	res := test.GetWithCookie(
+		"/v0/transactions",
+		m.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+	waitForSyncs(t, app)
+
+	// the stored transactions are still returned
+	res = test.GetWithCookie(
+		"/v0/transactions",
+		m.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+	test.Response(t, res, http.StatusOK)
+
+	// the client is told which item needs the user to log in again
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+	if len(response.Errors) != 1 || response.Errors[0].Code != "ITEM_LOGIN_REQUIRED" || response.Errors[0].ItemId != token.Id {
+		t.Fatal("Expected the item to be reported as needing a login, got", response.Errors)
+	}
+
+	stored := models.Token{Id: token.Id}
+	app.Tokens.Get(user.Id, &stored)
+	if stored.Status != "ITEM_LOGIN_REQUIRED" {
+		t.Fatal("The status of the item was not recorded:", stored.Status)
+	}
 }
 
-//func TestGetTransactions(t *testing.T) {
-//	app := test.GetPlaidMockApp()
-//	defer test.CloseDB(t, app)
-//
-//	rows := sqlmock.NewRows([]string{"id", "token", "itemID", "institution"}).
-//		AddRow(user.Id, token.Value, token.Id, token.Institution)
-//
-//	query := `SELECT id, token, itemID, institution FROM plaidtokens WHERE id\="testvalue"`
-//	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
-//
-//	res := test.GetWithCookie(
-//		"/v0/getTransactions",
-//		m.Authenticate(sdk.GetTransactions(app), app),
-//		app,
-//		"AuthToken",
-//	)
-//
-//	test.Response(t, res, http.StatusOK)
-//}
-
-//func TestGetBalances(t *testing.T) {
-//	app := test.GetPlaidMockApp()
-//	defer test.CloseDB(t, app)
-//
-//	// mock the database retrieval
-//	rows := sqlmock.NewRows([]string{"id", "token", "itemID", "institution"}).
-//		AddRow(user.Id, token.Value, token.Id, token.Institution)
-//
-//	query := `SELECT id, token, itemID, institution FROM plaidtokens WHERE id\="testvalue"`
-//	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
-//
-//	res := test.GetWithCookie(
-//		"/v0/getBalance",
-//		m.Authenticate(sdk.GetBalance(app), app),
-//		app,
-//		"AuthToken",
-//	)
-//
-//	test.Response(t, res, http.StatusOK)
-//	test.MockExpectations(t, app)
-//}
+func TestGetBudgetItemLoginRequired(t *testing.T) {
+	item := fakeItem()
+	item.Errors = map[string]plaid.Error{
+		"/transactions/get": test.PlaidError("ITEM_ERROR", "ITEM_LOGIN_REQUIRED"),
+	}
+
+	app, _, closeServer := getFakePlaidApp(item)
+	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	app.Tokens.Add(user.Id, &token)
+
+	res := test.GetWithCookie("/v0/budget", m.Authenticate(sdk.GetBudget(app), app), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+	waitForSyncs(t, app)
+
+	// the budget is still returned, along with the item whose spending is out of date
+	res = test.GetWithCookie("/v0/budget", m.Authenticate(sdk.GetBudget(app), app), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+	if len(response.Errors) != 1 || response.Errors[0].Code != "ITEM_LOGIN_REQUIRED" || response.Errors[0].ItemId != token.Id {
+		t.Fatal("Expected the item to be reported as needing a login, got", response.Errors)
+	}
+}
 
 // * Testing error messages
 
 func TestExchangePublicTokenInvalidToken(t *testing.T) {
-	app := test.GetPlaidMockApp()
+	app, _, closeServer := test.GetPlaidMockApp()
 	defer test.CloseDB(t, app)
+	defer closeServer()
 
 	body, _ := json.Marshal(publicToken)
 
@@ -153,15 +392,63 @@ func TestExchangePublicTokenInvalidToken(t *testing.T) {
 }
 
 func TestGetBalancesInvalidToken(t *testing.T) {
-	app := test.GetPlaidMockApp()
+	app, _, closeServer := getFakePlaidApp(fakeItem())
 	defer test.CloseDB(t, app)
+	defer closeServer()
+
+	// plaid does not know about the access token
+	unknown := token
+	unknown.Value = "access-sandbox-unknown"
+	app.Tokens.Add(user.Id, &unknown)
 
 	res := test.GetWithCookie(
 		"/v0/getBalances",
-		sdk.GetBalance(app),
+		m.Authenticate(sdk.GetBalance(app), app),
 		app,
 		"AuthToken",
 	)
-
 	test.Response(t, res, http.StatusBadGateway)
+
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+	if response.Error == nil || response.Error.Code != "INVALID_ACCESS_TOKEN" || response.Error.Type != "INVALID_INPUT" {
+		t.Fatal("Unexpected error:", response.Error)
+	}
+}
+
+func TestGetLinkTokenConfig(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	app.Config.Plaid.Products = []string{"transactions", "liabilities"}
+	app.Config.Plaid.CountryCodes = []string{"US", "CA"}
+	app.Config.Plaid.Language = "fr"
+	app.Config.Plaid.ClientName = "Scale Beta"
+	app.Config.Plaid.Webhook = "https://api.example.com/v0/plaid/webhook"
+
+	// the fake plaid server records the link token configuration it receives
+	var received plaid.LinkTokenConfigs
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		json.NewEncoder(w).Encode(plaid.CreateLinkTokenResponse{LinkToken: "link-sandbox-1"})
+	}))()
+
+	test.ExpectSession(app, false)
+
+	res := test.GetWithCookie(
+		"/v0/getLinkToken",
+		m.Authenticate(sdk.GetPlaidToken(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+
+	if strings.Join(received.Products, ",") != "transactions,liabilities" ||
+		strings.Join(received.CountryCodes, ",") != "US,CA" ||
+		received.Language != "fr" ||
+		received.ClientName != "Scale Beta" ||
+		received.Webhook != app.Config.Plaid.Webhook {
+		t.Fatal("The link token was not created with the configuration:", received)
+	}
 }
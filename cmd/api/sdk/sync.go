@@ -0,0 +1,139 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+const (
+	initialHistory = 365 * 24 * time.Hour // how far back transactions are downloaded for new items
+	syncOverlap    = 30 * 24 * time.Hour  // how far before the cursor transactions are synced again
+	syncInterval   = 6 * time.Hour        // how long stored transactions are used before syncing
+	syncPageSize   = 500                  // how many transactions are requested from plaid at a time
+)
+
+// SyncItem downloads the transactions of the item from plaid and stores them in the database.
+// Only the transactions after the item's cursor are downloaded, along with an overlap window
+// before it, since plaid can still modify or remove recent transactions (e.g. pending ones).
+// Stored transactions inside the window that plaid no longer returns are removed. Once the
+// transactions are stored the cursor is moved to today. If plaid fails because of the item,
+// the error code is recorded as the item's status before the error is returned.
+func SyncItem(app *application.App, userId string, token *models.Token) error {
+	now := time.Now()
+	endDate := now.Format(iso8601TimeFormat)
+	startDate := now.Add(-initialHistory).Format(iso8601TimeFormat)
+	if cursor, err := time.Parse(iso8601TimeFormat, token.Cursor); err == nil {
+		startDate = cursor.Add(-syncOverlap).Format(iso8601TimeFormat)
+	}
+
+	// download every page of transactions in the window
+	transactions := make([]plaid.Transaction, 0)
+	for {
+		res, err := app.Plaid.Client.GetTransactionsWithOptions(token.Value, plaid.GetTransactionsOptions{
+			StartDate:  startDate,
+			EndDate:    endDate,
+			AccountIDs: []string{},
+			Count:      syncPageSize,
+			Offset:     len(transactions),
+		})
+		if err != nil {
+			if plaidError, ok := models.AsPlaidError(err); ok && plaidError.ErrorType == "ITEM_ERROR" {
+				if err := app.Tokens.SetStatus(token.Id, plaidError.ErrorCode); err != nil {
+					app.Log.Error("Failed to record item status", "itemId", token.Id, "error", err)
+				}
+			}
+			return err
+		}
+
+		transactions = append(transactions, res.Transactions...)
+		if len(res.Transactions) == 0 || len(transactions) >= res.TotalTransactions {
+			break
+		}
+	}
+
+	// find the stored transactions plaid did not return anymore
+	stored, err := app.Transactions.Ids(token.Id, startDate, endDate)
+	if err != nil {
+		return err
+	}
+
+	returned := make(map[string]bool)
+	for _, transaction := range transactions {
+		returned[transaction.ID] = true
+	}
+
+	removed := make([]string, 0)
+	for _, id := range stored {
+		if !returned[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	if err := app.Transactions.Save(userId, token.Id, transactions); err != nil {
+		return err
+	}
+
+	if err := app.Transactions.Remove(token.Id, removed); err != nil {
+		return err
+	}
+
+	if err := app.Tokens.SetCursor(token.Id, endDate); err != nil {
+		return err
+	}
+
+	// the item works, so any previous error was resolved
+	if len(token.Status) > 0 {
+		return app.Tokens.SetStatus(token.Id, "")
+	}
+
+	return nil
+}
+
+// queueSync queues a sync of the item on the worker, unless one is already waiting. The item is
+// read again once the sync starts, so that it continues from wherever the previous sync left it.
+func queueSync(app *application.App, itemId string) error {
+	return app.Worker.Add("sync:"+itemId, func() error {
+		token := models.Token{Id: itemId}
+		userId, err := app.Tokens.GetByItem(&token)
+		if err != nil {
+			return fmt.Errorf("failed to get item %s to sync: %v", itemId, err)
+		}
+
+		if err := SyncItem(app, userId, &token); err != nil {
+			return fmt.Errorf("failed to sync transactions of item %s: %v", itemId, err)
+		}
+
+		return nil
+	})
+}
+
+// syncStaleItems queues a sync of every item that has not been synced within the sync interval,
+// so that requests are served from the stored transactions without waiting for plaid. Items whose
+// sync failed have the plaid error code as their status, such as ITEM_LOGIN_REQUIRED, and are
+// returned as errors so that clients can tell which items are out of date and why.
+func syncStaleItems(ctx context.Context, app *application.App, tokens []*models.Token) []*models.APIError {
+	failed := make([]*models.APIError, 0)
+	staleBefore := time.Now().Add(-syncInterval).Unix()
+
+	for _, token := range tokens {
+		if len(token.Status) > 0 {
+			failed = append(failed, &models.APIError{Code: token.Status, ItemId: token.Id})
+		}
+
+		if token.LastSync > staleBefore {
+			continue
+		}
+
+		if err := queueSync(app, token.Id); err != nil {
+			app.Logger(ctx).Warn("Failed to queue sync of item", "itemId", token.Id, "error", err)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,243 @@
+package sdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// transactionsServer fakes the plaid transactions endpoint with the given transactions
+func transactionsServer(transactions []plaid.Transaction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(plaid.GetTransactionsResponse{
+			Transactions:      transactions,
+			TotalTransactions: len(transactions),
+		})
+	})
+}
+
+func TestSyncItem(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	transactions := []plaid.Transaction{
+		{ID: "transaction1", AccountID: "account1", Amount: 20, Date: "2021-05-01", Name: "Aldi"},
+		{ID: "transaction2", AccountID: "account1", Amount: 40, Date: "2021-05-02", Name: "Amazon"},
+	}
+	defer test.WithPlaidServer(app, transactionsServer(transactions))()
+
+	// a transaction that was stored before but is no longer returned by plaid
+	rows := sqlmock.NewRows([]string{"id"}).AddRow("transaction1").AddRow("removed")
+	query := `SELECT id FROM transactions WHERE itemID \= \? AND date BETWEEN \? AND \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(token.Id, "2021-04-01", sqlmock.AnyArg()).WillReturnRows(rows)
+
+	query = `INSERT INTO transactions`
+	app.DB.Mock.ExpectPrepare(query).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+
+	query = `DELETE FROM transactions WHERE itemID \= \? AND id IN \(\?\);`
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(token.Id, "removed").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	query = `UPDATE plaidtokens SET syncCursor \= \?, lastSync \= \? WHERE itemID \= \?`
+	app.DB.Mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tempToken := token
+	tempToken.Cursor = "2021-05-01"
+	err := sdk.SyncItem(app, user.Id, &tempToken)
+	test.ModelMethod(t, err, "insert")
+	test.MockExpectations(t, app)
+}
+
+func TestSyncItemLoginRequired(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(plaid.Error{ErrorType: "ITEM_ERROR", ErrorCode: "ITEM_LOGIN_REQUIRED"})
+	}))()
+
+	// the error is recorded so the user can be asked to log in again
+	query := `UPDATE plaidtokens SET status \= \? WHERE itemID \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("ITEM_LOGIN_REQUIRED", token.Id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tempToken := token
+	if err := sdk.SyncItem(app, user.Id, &tempToken); err == nil {
+		t.Fatal("The sync should have failed")
+	}
+	test.MockExpectations(t, app)
+}
+
+func TestGetTransactionsFromDatabase(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, false)
+
+	// the item was synced recently, so plaid is not called
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"}).
+		AddRow(user.Id, test.EncryptToken(app, token.Id, token.Value), "test", token.Id, token.Institution, "ins_1", "", "2100-01-01", 4102444800)
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(user.Id).WillReturnRows(rows)
+
+	data, _ := json.Marshal(plaid.Transaction{ID: "transaction1", AccountID: "account1", Amount: 20})
+	rows = sqlmock.NewRows([]string{"data", "date", "id"}).AddRow(string(data), "2021-05-01", "transaction1")
+	query = `SELECT data, date, id FROM transactions WHERE userId \= \? AND date BETWEEN \? AND \?`
+	app.DB.Mock.ExpectQuery(query).WillReturnRows(rows)
+
+	res := test.GetWithCookie(
+		"/v0/transactions",
+		middleware.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	var response struct {
+		Result models.TransactionPage `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&response)
+	if len(response.Result.Transactions) != 1 || len(response.Result.Next) != 0 {
+		t.Fatal("The stored transactions were not returned")
+	}
+}
+
+func TestWebhookTransactionsRemoved(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body, _ := json.Marshal(models.Webhook{
+		Type:                "TRANSACTIONS",
+		Code:                "TRANSACTIONS_REMOVED",
+		ItemId:              token.Id,
+		RemovedTransactions: []string{"transaction1", "transaction2"},
+	})
+
+	query := `DELETE FROM transactions WHERE itemID \= \? AND id IN \(\?,\?\);`
+	app.DB.Mock.
+		ExpectPrepare(query).
+		ExpectExec().
+		WithArgs(token.Id, "transaction1", "transaction2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestWebhookTransactionsSyncInBackground(t *testing.T) {
+	app := test.GetMemoryApp()
+	fake := test.NewFakePlaid()
+	fake.AddItem(publicToken.Value, token.Value, plaid.Institution{ID: "ins_1", Name: token.Institution}, fakeItem())
+
+	// plaid doesn't answer until the webhook was acknowledged
+	release := make(chan bool)
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fake.ServeHTTP(w, r)
+	}))()
+
+	app.Tokens.Add(user.Id, &token)
+
+	body, _ := json.Marshal(models.Webhook{Type: "TRANSACTIONS", Code: "DEFAULT_UPDATE", ItemId: token.Id})
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusOK)
+
+	// the worker syncs the item once plaid answers, and is stopped once it is done
+	close(release)
+	if err := app.Worker.Stop(context.Background()); err != nil {
+		t.Fatal("Failed to stop the worker:", err)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	transactions, err := app.Transactions.List(user.Id, today, today)
+	if err != nil || len(transactions) != 2 {
+		t.Fatal("The transactions of the item were not synced:", transactions, err)
+	}
+}
+
+func TestGetTransactionsWithQuery(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, false)
+
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution", "institutionId", "status", "syncCursor", "lastSync"})
+	query := `SELECT id, token, tokenKeyId, itemID, institution, institutionId, status, syncCursor, lastSync FROM plaidtokens WHERE id \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(user.Id).WillReturnRows(rows)
+
+	rows = sqlmock.NewRows([]string{"data", "date", "id"})
+	query =
+		`SELECT data, date, id FROM transactions WHERE userId \= \? AND date BETWEEN \? AND \? ` +
+		`AND accountId IN \(\?,\?\) AND amount >= \? ORDER BY date DESC, id LIMIT \?`
+	app.DB.Mock.
+		ExpectQuery(query).
+		WithArgs(user.Id, "2021-01-01", "2021-01-31", "account1", "account2", 10.5, 26).
+		WillReturnRows(rows)
+
+	res := test.GetWithCookie(
+		"/v0/transactions?start=2021-01-01&end=2021-01-31&account_id=account1&account_id=account2&min_amount=10.5&limit=25",
+		middleware.Authenticate(sdk.GetTransactions(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestGetTransactionsInvalidQuery(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	// the invalid parameter of each query
+	queries := map[string]string{
+		"start=yesterday":                 "start",
+		"start=2021-02-01&end=2021-01-01": "start",
+		"start=yesterday&end=tomorrow":    "start",
+		"min_amount=ten":                  "min_amount",
+		"min_amount=ten&max_amount=ten":   "min_amount",
+		"min_amount=20&max_amount=10":     "min_amount",
+		"limit=0":                         "limit",
+		"limit=501":                       "limit",
+	}
+
+	for query, field := range queries {
+		test.ExpectSession(app, false)
+
+		res := test.GetWithCookie(
+			"/v0/transactions?"+query,
+			middleware.Authenticate(sdk.GetTransactions(app), app),
+			app,
+			"AuthToken",
+		)
+
+		test.Response(t, res, http.StatusBadRequest)
+		if details := test.Error(t, res, models.CodeInvalidQuery).Details; len(details) != 1 || details[0].Field != field {
+			t.Error("Unexpected details for", query, details)
+		}
+	}
+
+	test.MockExpectations(t, app)
+}
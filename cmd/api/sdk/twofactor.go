@@ -0,0 +1,404 @@
+package sdk
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/totp"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	totpIssuer           = "Scale"          // name of the entry of the secret in authenticator apps
+	challengeDuration    = 5 * time.Minute  // how long users have to give their code once they logged in
+	maxChallengeAttempts = 5                // how many codes can be tried with a login challenge
+	maxTwoFactorFailures = 10               // how many codes can fail before the user is locked out
+	twoFactorLockout     = 15 * time.Minute // how long failed codes count towards the lockout
+	recoveryCodeCount    = 10               // how many recovery codes users get
+)
+
+// errInvalidCode is returned when a TOTP or recovery code is wrong or was already used
+var errInvalidCode = errors.New("the two factor code is invalid or was already used")
+
+// EnrollTwoFactor generates a new TOTP secret for the signed in user and responds with it and
+// its provisioning URI. Logins don't need a code until the user enables the secret with
+// EnableTwoFactor, and enrolling again replaces a secret that was not enabled.
+func EnrollTwoFactor(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := app.Users.Get(GetIDFromContext(r))
+		if err != nil {
+			msg := "Failed to get user"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if twoFactor, err := app.TwoFactor.Get(user.Id); err == nil && twoFactor.Enabled {
+			msg := "Two factor authentication is already enabled"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeTwoFactorEnabled, msg, nil)
+			return
+		} else if err != nil && err != sql.ErrNoRows {
+			msg := "Failed to get two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		secret := totp.GenerateSecret()
+		if err := app.TwoFactor.Enroll(&models.TwoFactor{UserId: user.Id, Secret: secret}); err != nil {
+			msg := "Failed to enroll two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Two factor authentication enrolled"
+		models.CreateResponse(w, msg, models.TwoFactorEnrollment{
+			Secret: secret,
+			URI:    totp.URI(secret, totpIssuer, user.Email),
+		})
+	}
+}
+
+// EnableTwoFactor enables the enrolled secret of the signed in user once they give a code of it,
+// which proves their authenticator app has it. The response has the recovery codes of the user,
+// which are never shown again.
+func EnableTwoFactor(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		code, ok := decodeCode(w, r)
+		if !ok {
+			return
+		}
+
+		userId := GetIDFromContext(r)
+		twoFactor, err := app.TwoFactor.Get(userId)
+		if err == sql.ErrNoRows {
+			msg := "Two factor authentication was not enrolled"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeTwoFactorNotEnabled, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Failed to get two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if twoFactor.Enabled {
+			msg := "Two factor authentication is already enabled"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeTwoFactorEnabled, msg, nil)
+			return
+		}
+
+		if !limitAttempts(w, r, app, userId) {
+			return
+		}
+
+		step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+		if !ok {
+			msg := "Invalid two factor code"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidTwoFactor, msg, nil)
+			return
+		}
+
+		codes, hashes := generateRecoveryCodes()
+		if err := app.TwoFactor.Enable(userId, step, hashes); err != nil {
+			msg := "Failed to enable two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		clearAttempts(r, app, userId)
+
+		msg := "Two factor authentication enabled"
+		models.CreateResponse(w, msg, models.RecoveryCodes{RecoveryCodes: codes})
+	}
+}
+
+// DisableTwoFactor removes the secret and recovery codes of the signed in user once they give a
+// TOTP or recovery code, so that a stolen session alone can't turn two factor authentication off
+func DisableTwoFactor(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		userId := GetIDFromContext(r)
+		if !checkEnabledCode(w, r, app, userId) {
+			return
+		}
+
+		if err := app.TwoFactor.Disable(userId); err != nil {
+			msg := "Failed to disable two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Two factor authentication disabled"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the signed in user once they give a TOTP
+// or recovery code, and responds with the new codes
+func RegenerateRecoveryCodes(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		userId := GetIDFromContext(r)
+		if !checkEnabledCode(w, r, app, userId) {
+			return
+		}
+
+		codes, hashes := generateRecoveryCodes()
+		if err := app.TwoFactor.ReplaceRecoveryCodes(userId, hashes); err != nil {
+			msg := "Failed to replace recovery codes"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Recovery codes replaced"
+		models.CreateResponse(w, msg, models.RecoveryCodes{RecoveryCodes: codes})
+	}
+}
+
+// LoginTwoFactor finishes the login of a user with two factor authentication. It takes the
+// challenge token Login responded with and a TOTP or recovery code, and gives the user a session
+// the same way Login does. Each challenge can only be attempted a few times before the user has
+// to log in with their password again, and users who fail too many codes across challenges are
+// locked out for a while.
+func LoginTwoFactor(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer CloseBody(r)
+
+		var body struct {
+			ChallengeToken string `json:"challengeToken"`
+			Code           string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			msg := "Failed to decode challenge from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+			return
+		}
+
+		tokenHash := hashToken(body.ChallengeToken)
+		userId, err := app.Challenges.Attempt(tokenHash, maxChallengeAttempts)
+		if err == models.ErrInvalidChallenge {
+			msg := "Invalid login challenge"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidChallenge, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Failed to login"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// failures are counted per user, since anyone with the password can start new challenges
+		if !limitAttempts(w, r, app, userId) {
+			return
+		}
+
+		twoFactor, err := app.TwoFactor.Get(userId)
+		if err != nil {
+			msg := "Failed to get two factor authentication"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if err := useCode(app, twoFactor, body.Code); err == errInvalidCode {
+			msg := "Invalid two factor code"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidTwoFactor, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Failed to login"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		// the challenge can only be completed once, even by concurrent requests
+		if err := app.Challenges.Complete(tokenHash); err != nil {
+			msg := "Invalid login challenge"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidChallenge, msg, err)
+			return
+		}
+
+		clearAttempts(r, app, userId)
+
+		tokens, err := CreateSession(app, userId)
+		if err != nil {
+			msg := "Failed to login"
+			models.CreateError(w, r, http.StatusUnprocessableEntity, models.CodeSessionFailed, msg, err)
+			return
+		}
+
+		msg := "User successfully authenticated"
+		respondWithTokens(w, app, msg, tokens, wantsTokens(r))
+	}
+}
+
+// createChallenge starts the second step of the login of the user, and returns the challenge
+// token the code has to be sent with
+func createChallenge(app *application.App, userId string) (*models.TwoFactorChallenge, error) {
+	token := generateSecret()
+	challenge := models.LoginChallenge{
+		TokenHash: hashToken(token),
+		UserId:    userId,
+		Expires:   time.Now().Add(challengeDuration).Unix(),
+	}
+	if err := app.Challenges.Create(&challenge); err != nil {
+		return nil, err
+	}
+
+	return &models.TwoFactorChallenge{
+		ChallengeToken: token,
+		ExpiresIn:      int64(challengeDuration / time.Second),
+	}, nil
+}
+
+// decodeCode decodes the code from the body of the request, and responds with an error if it
+// can't be decoded
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	defer CloseBody(r)
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		msg := "Failed to decode code from body"
+		models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+		return "", false
+	}
+
+	return body.Code, true
+}
+
+// checkEnabledCode checks that the user enabled two factor authentication and that the code in
+// the body is one of their TOTP or recovery codes, and responds with an error otherwise. The code
+// counts towards the same lockout as the codes of logins, so a stolen session can't guess it.
+func checkEnabledCode(w http.ResponseWriter, r *http.Request, app *application.App, userId string) bool {
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return false
+	}
+
+	twoFactor, err := app.TwoFactor.Get(userId)
+	if err != nil && err != sql.ErrNoRows {
+		msg := "Failed to get two factor authentication"
+		models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+		return false
+	}
+
+	if err == sql.ErrNoRows || !twoFactor.Enabled {
+		msg := "Two factor authentication is not enabled"
+		models.CreateError(w, r, http.StatusBadRequest, models.CodeTwoFactorNotEnabled, msg, nil)
+		return false
+	}
+
+	if !limitAttempts(w, r, app, userId) {
+		return false
+	}
+
+	if err := useCode(app, twoFactor, code); err == errInvalidCode {
+		msg := "Invalid two factor code"
+		models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidTwoFactor, msg, nil)
+		return false
+	} else if err != nil {
+		msg := "Failed to check two factor code"
+		models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+		return false
+	}
+
+	clearAttempts(r, app, userId)
+	return true
+}
+
+// limitAttempts records an attempt at a two factor code of the user, and responds with an error if
+// the user failed too many codes within the lockout. Every code check goes through it, whether it
+// is a login, enabling, or a change to two factor authentication, and the attempts are cleared
+// once a code is right so that only failures count.
+func limitAttempts(w http.ResponseWriter, r *http.Request, app *application.App, userId string) bool {
+	now := time.Now()
+	if err := app.TwoFactor.AddAttempt(userId, now.Unix()); err != nil {
+		msg := "Failed to check two factor code"
+		models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+		return false
+	}
+
+	failures, err := app.TwoFactor.CountAttempts(userId, now.Add(-twoFactorLockout).Unix())
+	if err != nil {
+		msg := "Failed to check two factor code"
+		models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+		return false
+	}
+
+	if failures > maxTwoFactorFailures {
+		w.Header().Set("Retry-After", fmt.Sprint(int(twoFactorLockout/time.Second)))
+		msg := "Too many failed two factor codes, try again later"
+		models.CreateError(w, r, http.StatusTooManyRequests, models.CodeTooManyRequests, msg, nil)
+		return false
+	}
+
+	return true
+}
+
+// clearAttempts clears the attempts of the user once they gave a right code
+func clearAttempts(r *http.Request, app *application.App, userId string) {
+	if err := app.TwoFactor.ClearAttempts(userId); err != nil {
+		app.Logger(r.Context()).Error("Failed to clear two factor attempts", "error", err)
+	}
+}
+
+// useCode uses the TOTP or recovery code of the user. TOTP codes can't be used again, and neither
+// can earlier ones, so a code that was seen by someone else is useless once it was used. If the
+// code is wrong or was already used errInvalidCode is returned.
+func useCode(app *application.App, twoFactor models.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+		if !ok {
+			return errInvalidCode
+		}
+
+		if err := app.TwoFactor.UseStep(twoFactor.UserId, step); err == models.ErrCodeUsed {
+			return errInvalidCode
+		} else if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	err := app.TwoFactor.UseRecoveryCode(twoFactor.UserId, hashToken(normalizeRecoveryCode(code)))
+	if err == models.ErrInvalidRecoveryCode {
+		return errInvalidCode
+	}
+
+	return err
+}
+
+// recoveryEncoding writes recovery codes with lowercase letters and digits only
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns new recovery codes, formatted as xxxx-xxxx-xxxx-xxxx, along with
+// the hashes they are stored as. Each code has 80 random bits, so storing them with a fast hash
+// is enough.
+func generateRecoveryCodes() ([]string, []string) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			panic(err)
+		}
+
+		code := recoveryEncoding.EncodeToString(random)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashToken(code)
+	}
+
+	return codes, hashes
+}
+
+// normalizeRecoveryCode removes the separators and spaces users may type in recovery codes
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,228 @@
+package sdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/test"
+	"github.com/elopez00/scale-backend/pkg/totp"
+)
+
+// withCode returns a JSON body with the code
+func withCode(code string) *bytes.Buffer {
+	body, _ := json.Marshal(map[string]string{"code": code})
+	return bytes.NewBuffer(body)
+}
+
+// enableTwoFactor onboards the user and enables two factor authentication for them, and returns
+// the secret along with the time step of the code that enabled it
+func enableTwoFactor(t *testing.T, app *application.App) (string, int64) {
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+
+	res := test.PostWithCookie("/v0/2fa/enroll", middleware.Authenticate(sdk.EnrollTwoFactor(app), app), nil, app, "AuthToken")
+	var enrollment struct {
+		Result models.TwoFactorEnrollment `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&enrollment)
+	secret := enrollment.Result.Secret
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+	res = test.PostWithCookie("/v0/2fa/enable", middleware.Authenticate(sdk.EnableTwoFactor(app), app), withCode(code), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	return secret, step
+}
+
+func TestTwoFactorInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+
+	// enrolling gives the secret and the uri authenticator apps scan
+	res := test.PostWithCookie("/v0/2fa/enroll", middleware.Authenticate(sdk.EnrollTwoFactor(app), app), nil, app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	var enrollment struct {
+		Result models.TwoFactorEnrollment `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&enrollment)
+	secret := enrollment.Result.Secret
+	if len(secret) == 0 || !strings.HasPrefix(enrollment.Result.URI, "otpauth://totp/Scale:") {
+		t.Fatal("Unexpected enrollment:", enrollment.Result)
+	}
+
+	// logins don't need a code until the secret is enabled
+	test.Response(t, test.Post("/login", sdk.Login(app), getBody()), http.StatusOK)
+
+	enable := middleware.Authenticate(sdk.EnableTwoFactor(app), app)
+	res = test.PostWithCookie("/v0/2fa/enable", enable, withCode("000000"), app, "AuthToken")
+	test.Response(t, res, http.StatusBadRequest)
+	test.Error(t, res, models.CodeInvalidTwoFactor)
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+	res = test.PostWithCookie("/v0/2fa/enable", enable, withCode(code), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	var recovery struct {
+		Result models.RecoveryCodes `json:"result"`
+	}
+	json.NewDecoder(res.Body).Decode(&recovery)
+	if len(recovery.Result.RecoveryCodes) != 10 {
+		t.Fatal("Expected 10 recovery codes, got", recovery.Result.RecoveryCodes)
+	}
+
+	// logins now respond with a challenge instead of the session
+	login := func() string {
+		res := test.Post("/login", sdk.Login(app), getBody())
+		test.Response(t, res, http.StatusAccepted)
+		if len(res.Result().Cookies()) > 0 {
+			t.Fatal("No session should be given before the code")
+		}
+
+		var challenge struct {
+			Result models.TwoFactorChallenge `json:"result"`
+		}
+		json.NewDecoder(res.Body).Decode(&challenge)
+		return challenge.Result.ChallengeToken
+	}
+
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"challengeToken": challenge, "code": code})
+		return test.Post("/v0/login/2fa", sdk.LoginTwoFactor(app), bytes.NewBuffer(body))
+	}
+
+	// the code used to enable the secret can't be used again
+	challenge := login()
+	res = verify(challenge, code)
+	test.Response(t, res, http.StatusUnauthorized)
+	test.Error(t, res, models.CodeInvalidTwoFactor)
+
+	next, _ := totp.Code(secret, step+1)
+	res = verify(challenge, next)
+	test.Response(t, res, http.StatusOK)
+	if len(res.Result().Cookies()) != 2 {
+		t.Fatal("Expected the session cookies, got", res.Result().Cookies())
+	}
+
+	// completed challenges can't be used again
+	res = verify(challenge, next)
+	test.Response(t, res, http.StatusUnauthorized)
+	test.Error(t, res, models.CodeInvalidChallenge)
+
+	// recovery codes work once each, however they are typed
+	recoveryCode := recovery.Result.RecoveryCodes[0]
+	test.Response(t, verify(login(), strings.ToUpper(recoveryCode)), http.StatusOK)
+	test.Response(t, verify(login(), recoveryCode), http.StatusUnauthorized)
+
+	// challenges can only be attempted a few times
+	challenge = login()
+	for i := 0; i < 5; i++ {
+		test.Error(t, verify(challenge, "000000"), models.CodeInvalidTwoFactor)
+	}
+	test.Error(t, verify(challenge, recovery.Result.RecoveryCodes[1]), models.CodeInvalidChallenge)
+
+	// disabling needs a code too
+	disable := middleware.Authenticate(sdk.DisableTwoFactor(app), app)
+	res = test.PostWithCookie("/v0/2fa/disable", disable, withCode("000000"), app, "AuthToken")
+	test.Error(t, res, models.CodeInvalidTwoFactor)
+
+	res = test.PostWithCookie("/v0/2fa/disable", disable, withCode(recovery.Result.RecoveryCodes[1]), app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+	test.Response(t, test.Post("/login", sdk.Login(app), getBody()), http.StatusOK)
+}
+
+func TestTwoFactorLockoutInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	secret, step := enableTwoFactor(t, app)
+
+	verify := func(code string) *httptest.ResponseRecorder {
+		res := test.Post("/login", sdk.Login(app), getBody())
+		var challenge struct {
+			Result models.TwoFactorChallenge `json:"result"`
+		}
+		json.NewDecoder(res.Body).Decode(&challenge)
+
+		body, _ := json.Marshal(map[string]string{"challengeToken": challenge.Result.ChallengeToken, "code": code})
+		return test.Post("/v0/login/2fa", sdk.LoginTwoFactor(app), bytes.NewBuffer(body))
+	}
+
+	// new challenges don't give more tries, failures are counted for the user
+	for i := 0; i < 10; i++ {
+		test.Error(t, verify("000000"), models.CodeInvalidTwoFactor)
+	}
+
+	next, _ := totp.Code(secret, step+1)
+	res := verify(next)
+	test.Response(t, res, http.StatusTooManyRequests)
+	test.Error(t, res, models.CodeTooManyRequests)
+	if res.Header().Get("Retry-After") != "900" {
+		t.Fatal("Expected to retry after 900 seconds, got", res.Header().Get("Retry-After"))
+	}
+}
+
+func TestTwoFactorDisableLockoutInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	secret, step := enableTwoFactor(t, app)
+
+	// a stolen session can't keep guessing the code that turns two factor authentication off
+	disable := middleware.Authenticate(sdk.DisableTwoFactor(app), app)
+	for i := 0; i < 10; i++ {
+		res := test.PostWithCookie("/v0/2fa/disable", disable, withCode("000000"), app, "AuthToken")
+		test.Error(t, res, models.CodeInvalidTwoFactor)
+	}
+
+	next, _ := totp.Code(secret, step+1)
+	res := test.PostWithCookie("/v0/2fa/disable", disable, withCode(next), app, "AuthToken")
+	test.Response(t, res, http.StatusTooManyRequests)
+	test.Error(t, res, models.CodeTooManyRequests)
+
+	if twoFactor, err := app.TwoFactor.Get("testvalue"); err != nil || !twoFactor.Enabled {
+		t.Fatal("Two factor authentication should still be enabled:", err)
+	}
+}
+
+func TestTwoFactorRecoveryLockoutInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	secret, step := enableTwoFactor(t, app)
+
+	// the failures of logins and of the signed in user count towards the same lockout
+	for i := 0; i < 5; i++ {
+		res := test.Post("/login", sdk.Login(app), getBody())
+		var challenge struct {
+			Result models.TwoFactorChallenge `json:"result"`
+		}
+		json.NewDecoder(res.Body).Decode(&challenge)
+
+		body, _ := json.Marshal(map[string]string{"challengeToken": challenge.Result.ChallengeToken, "code": "000000"})
+		test.Error(t, test.Post("/v0/login/2fa", sdk.LoginTwoFactor(app), bytes.NewBuffer(body)), models.CodeInvalidTwoFactor)
+	}
+
+	recovery := middleware.Authenticate(sdk.RegenerateRecoveryCodes(app), app)
+	for i := 0; i < 5; i++ {
+		res := test.PostWithCookie("/v0/2fa/recovery", recovery, withCode("aaaa-bbbb-cccc-dddd"), app, "AuthToken")
+		test.Error(t, res, models.CodeInvalidTwoFactor)
+	}
+
+	next, _ := totp.Code(secret, step+1)
+	res := test.PostWithCookie("/v0/2fa/recovery", recovery, withCode(next), app, "AuthToken")
+	test.Response(t, res, http.StatusTooManyRequests)
+	test.Error(t, res, models.CodeTooManyRequests)
+}
@@ -0,0 +1,133 @@
+package sdk_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// expectToken adds the expectation of the token of the test item being retrieved
+func expectToken(app *application.App) {
+	rows := sqlmock.NewRows([]string{"id", "token", "tokenKeyId", "itemID", "institution"}).
+		AddRow(user.Id, test.EncryptToken(app, token.Id, token.Value), "test", token.Id, token.Institution)
+
+	query := `SELECT id, token, tokenKeyId, itemID, institution FROM plaidtokens WHERE id \= \? AND itemID \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(user.Id, token.Id).WillReturnRows(rows)
+}
+
+// expectTokenDelete adds the expectations of the token of the test item being deleted
+func expectTokenDelete(app *application.App) {
+	app.DB.Mock.ExpectBegin()
+	app.DB.Mock.ExpectExec(`DELETE FROM transactions`).WillReturnResult(sqlmock.NewResult(0, 5))
+	app.DB.Mock.ExpectExec(`DELETE FROM plaidtokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+	app.DB.Mock.ExpectCommit()
+}
+
+func TestUnlinkToken(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	removed := false
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		removed = r.URL.Path == "/item/remove"
+		json.NewEncoder(w).Encode(plaid.RemoveItemResponse{})
+	}))()
+
+	test.ExpectSession(app, false)
+	expectToken(app)
+	expectTokenDelete(app)
+
+	res := test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/"+token.Id,
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+
+	if !removed {
+		t.Fatal("The item was not removed from plaid")
+	}
+}
+
+func TestUnlinkTokenUnknownToPlaid(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(plaid.Error{ErrorType: "ITEM_ERROR", ErrorCode: "ITEM_NOT_FOUND"})
+	}))()
+
+	test.ExpectSession(app, false)
+	expectToken(app)
+	expectTokenDelete(app)
+
+	res := test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/"+token.Id,
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestUnlinkTokenPlaidFailure(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	defer test.WithPlaidServer(app, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(plaid.Error{ErrorType: "API_ERROR", ErrorCode: "INTERNAL_SERVER_ERROR"})
+	}))()
+
+	// the token must not be deleted if plaid could not remove it
+	test.ExpectSession(app, false)
+	expectToken(app)
+
+	res := test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/"+token.Id,
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusBadGateway)
+	test.MockExpectations(t, app)
+}
+
+func TestUnlinkTokenNotFound(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	test.ExpectSession(app, false)
+
+	query := `SELECT id, token, tokenKeyId, itemID, institution FROM plaidtokens WHERE id \= \? AND itemID \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs(user.Id, "unknown").WillReturnRows(sqlmock.NewRows(nil))
+
+	res := test.DeleteWithCookie(
+		"/v0/token/:itemId",
+		"/v0/token/unknown",
+		middleware.Authenticate(sdk.UnlinkToken(app), app),
+		app,
+		"AuthToken",
+	)
+
+	test.Response(t, res, http.StatusNotFound)
+	test.MockExpectations(t, app)
+}
@@ -3,16 +3,15 @@ package sdk
 import (
 	"fmt"
 	"github.com/elopez00/scale-backend/cmd/api/models"
-	"log"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
 	"net/http"
-	"strings"
 )
 
 // CloseBody utility function that repetitive closing handling
 func CloseBody(request *http.Request) {
 	err := request.Body.Close()
 	if err != nil {
-		log.Println("Failed to close the body")
+		logger.FromContext(request.Context(), logger.Default).Warn("Failed to close the body", "error", err)
 	}
 }
 
@@ -21,16 +20,7 @@ func GetIDFromContext(request *http.Request) string {
 	return fmt.Sprintf("%v", request.Context().Value(models.Key("user")))
 }
 
-// GetPlaidErrorCode will get the error code from the error message and return it as a string
-func GetPlaidErrorCode(err error) string {
-	errorMessage := err.Error()
-
-	// first get the index of the substring code
-	start := strings.Index(errorMessage, ", code: ") + 8
-
-	// get the end by creating a substring and getting the index of the first comma
-	end := strings.Index(errorMessage[start:], ", ") + start
-
-	// return the substring with the window of indeces
-	return errorMessage[start:end]
-}
\ No newline at end of file
+// GetSessionFromContext will get the session ID from the applications context
+func GetSessionFromContext(request *http.Request) string {
+	return fmt.Sprintf("%v", request.Context().Value(models.Key("session")))
+}
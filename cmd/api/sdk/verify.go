@@ -0,0 +1,165 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/mailer"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	verificationTokenDuration  = 24 * time.Hour // how long users have to verify their email
+	verificationResendInterval = time.Minute    // how long users wait before asking for another email
+	verificationHourlyLimit    = 5              // how many emails a user can ask for within an hour
+)
+
+// VerifyEmail marks the email of the user the verification token in the body was sent to as
+// verified. The token can only be used once, and the user does not need to be signed in, since
+// the email can be opened on another device.
+func VerifyEmail(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer CloseBody(r)
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			msg := "Failed to decode verification token from body"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidBody, msg, err)
+			return
+		}
+
+		userId, err := app.Verifications.Consume(hashToken(body.Token))
+		if err == models.ErrInvalidVerificationToken {
+			msg := "Invalid verification token"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidVerification, msg, nil)
+			return
+		} else if err != nil {
+			msg := "Failed to verify email"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if err := app.Users.SetVerified(userId); err != nil {
+			msg := "Failed to verify email"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Email successfully verified"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// ResendVerification sends a new verification email to the signed in user, whose previous tokens
+// keep working until one of them is used. Users can ask for one email per minute and five per
+// hour, past that the response has the http status 429 (Too Many Requests).
+func ResendVerification(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, err := app.Users.Get(GetIDFromContext(r))
+		if err != nil {
+			msg := "Failed to get user"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if user.Verified {
+			msg := "Email already verified"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeAlreadyVerified, msg, nil)
+			return
+		}
+
+		now := time.Now()
+		recent, err := app.Verifications.CountSince(user.Id, now.Add(-verificationResendInterval).Unix())
+		if err != nil {
+			msg := "Failed to send verification email"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		hourly, err := app.Verifications.CountSince(user.Id, now.Add(-time.Hour).Unix())
+		if err != nil {
+			msg := "Failed to send verification email"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if recent > 0 || hourly >= verificationHourlyLimit {
+			retryAfter := verificationResendInterval
+			if hourly >= verificationHourlyLimit {
+				retryAfter = time.Hour
+			}
+
+			w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter / time.Second)))
+			msg := "Too many verification emails, try again later"
+			models.CreateError(w, r, http.StatusTooManyRequests, models.CodeTooManyRequests, msg, nil)
+			return
+		}
+
+		message, err := createVerification(app, user)
+		if err != nil {
+			msg := "Failed to create verification"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		if err := app.Mailer.Send(message); err != nil {
+			msg := "Failed to send verification email"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeMailFailed, msg, err)
+			return
+		}
+
+		msg := "Verification email sent"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// createVerification stores a new verification token of the user, which is valid for a day, and
+// returns the email that gives it to the user
+func createVerification(app *application.App, user models.User) (mailer.Message, error) {
+	token := generateSecret()
+	now := time.Now()
+	verification := models.EmailVerification{
+		TokenHash: hashToken(token),
+		UserId:    user.Id,
+		Created:   now.Unix(),
+		Expires:   now.Add(verificationTokenDuration).Unix(),
+	}
+	if err := app.Verifications.Create(&verification); err != nil {
+		return mailer.Message{}, err
+	}
+
+	return verificationMessage(app, user.Email, token), nil
+}
+
+// verificationMessage returns the email that gives the user their verification token. The token
+// is a link to the dashboard if APP_URL is configured.
+func verificationMessage(app *application.App, email, token string) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Welcome to Scale! Use this within the next day to verify your email:\n\n%s\n\nIf you didn't create an account, you can ignore this email.\n",
+			appLink(app, "/verify", token),
+		),
+	}
+}
+
+// appLink returns the link to the page of the dashboard that takes the token, or only the token
+// if APP_URL is not configured
+func appLink(app *application.App, page, token string) string {
+	appURL := app.Config.Mail.AppURL
+	if len(appURL) == 0 {
+		return token
+	}
+
+	return strings.TrimRight(appURL, "/") + page + "?token=" + url.QueryEscape(token)
+}
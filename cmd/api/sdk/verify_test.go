@@ -0,0 +1,78 @@
+package sdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/middleware"
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+)
+
+func TestEmailVerificationInMemory(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+	app.Config.Mail.AppURL = "https://app.example.com"
+	app.Config.Plaid.RequireVerified = true
+
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+
+	message := test.GetMailbox(app).Receive(t)
+	prefix := "https://app.example.com/verify?token="
+	start := strings.Index(message.Body, prefix)
+	if message.To != user.Email || start < 0 {
+		t.Fatal("Unexpected verification email:", message)
+	}
+	token := strings.Fields(message.Body[start+len(prefix):])[0]
+
+	// banks can't be linked before the email is verified
+	link := middleware.Authenticate(middleware.RequireVerifiedEmail(sdk.AuthCheck(), app), app)
+	res := test.GetWithCookie("/v0/token/link", link, app, "AuthToken")
+	test.Response(t, res, http.StatusForbidden)
+	test.Error(t, res, models.CodeEmailNotVerified)
+
+	// another email can't be sent right after the first one
+	resend := middleware.Authenticate(sdk.ResendVerification(app), app)
+	res = test.PostWithCookie("/v0/verify/resend", resend, nil, app, "AuthToken")
+	test.Response(t, res, http.StatusTooManyRequests)
+	test.Error(t, res, models.CodeTooManyRequests)
+	if res.Header().Get("Retry-After") != "60" {
+		t.Error("Unexpected Retry-After header:", res.Header().Get("Retry-After"))
+	}
+
+	verify := func(token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"token": token})
+		return test.Post("/v0/verify", sdk.VerifyEmail(app), bytes.NewBuffer(body))
+	}
+
+	test.Response(t, verify(token), http.StatusOK)
+
+	// the token can only be used once
+	res = verify(token)
+	test.Response(t, res, http.StatusBadRequest)
+	test.Error(t, res, models.CodeInvalidVerification)
+
+	res = test.GetWithCookie("/v0/token/link", link, app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+
+	res = test.PostWithCookie("/v0/verify/resend", resend, nil, app, "AuthToken")
+	test.Response(t, res, http.StatusBadRequest)
+	test.Error(t, res, models.CodeAlreadyVerified)
+}
+
+func TestUnverifiedEmailAllowed(t *testing.T) {
+	app := test.GetMemoryApp()
+	defer test.CloseDB(t, app)
+
+	test.Response(t, test.Post("/onboard", sdk.Onboard(app), getBody()), http.StatusOK)
+
+	// unverified users can link banks unless verification is required
+	link := middleware.Authenticate(middleware.RequireVerifiedEmail(sdk.AuthCheck(), app), app)
+	res := test.GetWithCookie("/v0/token/link", link, app, "AuthToken")
+	test.Response(t, res, http.StatusOK)
+}
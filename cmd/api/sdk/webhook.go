@@ -0,0 +1,104 @@
+package sdk
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/elopez00/scale-backend/cmd/api/models"
+	"github.com/elopez00/scale-backend/pkg/application"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxWebhookSize is the largest webhook body that will be read
+const maxWebhookSize = 1 << 20
+
+// PlaidWebhook receives the webhooks plaid sends about the user's items. Every webhook has to
+// be signed by plaid, which is verified using the Plaid-Verification header, otherwise it is
+// rejected. Depending on the type and code of the webhook, the state of the item is recorded
+// so that problems like ITEM_LOGIN_REQUIRED are known before the item is used. New transactions
+// are synced by the worker once the webhook is acknowledged, since plaid gives up on webhooks
+// that take too long to respond to. Webhooks that the application does not care about are
+// acknowledged and ignored.
+func PlaidWebhook(app *application.App) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer CloseBody(r)
+
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+		if err != nil {
+			msg := "Failed to read webhook"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidWebhook, msg, err)
+			return
+		}
+
+		// make sure the webhook actually came from plaid
+		if err := app.Plaid.VerifyWebhook(r.Header.Get("Plaid-Verification"), body); err != nil {
+			msg := "Invalid webhook signature"
+			models.CreateError(w, r, http.StatusUnauthorized, models.CodeInvalidWebhook, msg, err)
+			return
+		}
+
+		var webhook models.Webhook
+		if err := json.Unmarshal(body, &webhook); err != nil {
+			msg := "Failed to decode webhook"
+			models.CreateError(w, r, http.StatusBadRequest, models.CodeInvalidWebhook, msg, err)
+			return
+		}
+
+		if err := handleWebhook(app, webhook); err != nil {
+			msg := "Failed to handle webhook"
+			models.CreateError(w, r, http.StatusBadGateway, models.CodeDatabaseError, msg, err)
+			return
+		}
+
+		msg := "Webhook received"
+		models.CreateResponse(w, msg, nil)
+	}
+}
+
+// handleWebhook dispatches the webhook according to its type and code
+func handleWebhook(app *application.App, webhook models.Webhook) error {
+	switch webhook.Type {
+	case "TRANSACTIONS":
+		{
+			if webhook.Code == "TRANSACTIONS_REMOVED" {
+				return app.Transactions.Remove(webhook.ItemId, webhook.RemovedTransactions)
+			}
+
+			// any other code means there are new transactions to sync, which is left to the worker
+			// so plaid gets its response right away. If the worker can't take it, the item is
+			// synced once it is stale.
+			if err := queueSync(app, webhook.ItemId); err != nil {
+				app.Log.Warn("Failed to queue sync of item", "itemId", webhook.ItemId, "error", err)
+			}
+
+			return nil
+		}
+	case "ITEM":
+		{
+			switch webhook.Code {
+			case "ERROR":
+				{
+					status := "ERROR"
+					if webhook.Error != nil && len(webhook.Error.ErrorCode) > 0 {
+						status = webhook.Error.ErrorCode
+					}
+					return app.Tokens.SetStatus(webhook.ItemId, status)
+				}
+			case "PENDING_EXPIRATION", "USER_PERMISSION_REVOKED":
+				{
+					return app.Tokens.SetStatus(webhook.ItemId, webhook.Code)
+				}
+			case "LOGIN_REPAIRED":
+				{
+					return app.Tokens.SetStatus(webhook.ItemId, "")
+				}
+			}
+		}
+	}
+
+	app.Log.Debug("Ignoring plaid webhook", "type", webhook.Type, "code", webhook.Code, "itemId", webhook.ItemId)
+	return nil
+}
@@ -0,0 +1,87 @@
+package sdk_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/elopez00/scale-backend/cmd/api/sdk"
+	"github.com/elopez00/scale-backend/pkg/test"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestWebhookItemError(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body := []byte(`{
+		"webhook_type": "ITEM",
+		"webhook_code": "ERROR",
+		"item_id": "wz666MBjYWTp2PDzzggYhM6oWWmBb",
+		"error": { "error_type": "ITEM_ERROR", "error_code": "ITEM_LOGIN_REQUIRED" }
+	}`)
+
+	query := `UPDATE plaidtokens SET status \= \? WHERE itemID \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("ITEM_LOGIN_REQUIRED", "wz666MBjYWTp2PDzzggYhM6oWWmBb").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestWebhookPendingExpiration(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body := []byte(`{"webhook_type": "ITEM", "webhook_code": "PENDING_EXPIRATION", "item_id": "itemid"}`)
+
+	query := `UPDATE plaidtokens SET status \= \? WHERE itemID \= \?`
+	app.DB.Mock.
+		ExpectExec(query).
+		WithArgs("PENDING_EXPIRATION", "itemid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestWebhookUnknownCode(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body := []byte(`{"webhook_type": "AUTH", "webhook_code": "AUTOMATICALLY_VERIFIED", "item_id": "itemid"}`)
+
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusOK)
+	test.MockExpectations(t, app)
+}
+
+func TestWebhookMissingSignature(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body := []byte(`{"webhook_type": "ITEM", "webhook_code": "ERROR", "item_id": "itemid"}`)
+
+	res := test.Post("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(body))
+	test.Response(t, res, http.StatusUnauthorized)
+}
+
+func TestWebhookTamperedBody(t *testing.T) {
+	app := test.GetMockApp()
+	defer test.CloseDB(t, app)
+
+	body := []byte(`{"webhook_type": "ITEM", "webhook_code": "LOGIN_REPAIRED", "item_id": "itemid"}`)
+	tampered := []byte(`{"webhook_type": "ITEM", "webhook_code": "LOGIN_REPAIRED", "item_id": "otherid"}`)
+
+	signature := test.SignWebhook(app, body)
+	res := test.PostWithHeader("/v0/plaid/webhook", sdk.PlaidWebhook(app), bytes.NewBuffer(tampered), "Plaid-Verification", signature)
+	test.Response(t, res, http.StatusUnauthorized)
+}
@@ -1,11 +1,23 @@
 package application
 
 import (
+	"context"
+	"os"
+
 	"github.com/elopez00/scale-backend/pkg/application/config"
 	"github.com/elopez00/scale-backend/pkg/application/database"
+	"github.com/elopez00/scale-backend/pkg/application/encryption"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+	"github.com/elopez00/scale-backend/pkg/application/mailer"
 	"github.com/elopez00/scale-backend/pkg/application/plaid"
+	"github.com/elopez00/scale-backend/pkg/application/signing"
+	"github.com/elopez00/scale-backend/pkg/application/store"
+	"github.com/elopez00/scale-backend/pkg/application/worker"
 )
 
+// workerQueueSize is how many background jobs can wait to run before new ones are rejected
+const workerQueueSize = 100
+
 type App struct {
 	// DB is where the database client lives, which is in charge of all database
 	// functionalities
@@ -17,13 +29,38 @@ type App struct {
 	// Plaid is where the plaid client lives, which is in charge of all bank
 	// information retrieval and functionalities
 	Plaid	*plaid.Plaid
+
+	// Keyring is in charge of encrypting the plaid tokens before they are stored and decrypting
+	// them once they are read from the database
+	Keyring	*encryption.Keyring
+
+	// Signing signs access tokens and verifies them with the key they were signed with, so the
+	// signing key can be rotated without invalidating the tokens signed before
+	Signing	*signing.Keyring
+
+	// Log writes the structured logs of the application at the configured level. Requests are
+	// logged with a logger derived from it, which Logger returns.
+	Log		*logger.Logger
+
+	// Mailer sends emails to users, such as the links they reset their password with
+	Mailer	mailer.Mailer
+
+	// Worker runs slow work in the background once the request that asked for it was answered,
+	// such as syncing the items plaid sent webhooks about. It has to be stopped on shutdown.
+	Worker	*worker.Worker
+
+	// Stores are where users, tokens, budgets, sessions, and transactions are kept. Handlers only
+	// depend on their interfaces, so they can be backed by the database or by memory. Get leaves
+	// them empty, whoever runs the application sets the stores it should use.
+	store.Stores
 }
 
-// Get will initialize environment variables and database connection.
+// Get will initialize the database connection and clients described by the configuration.
 // If the function encounters any errors, it will return it.
-func Get(environment map[string]string) (*App, error) {
-	// get the config
-	Config := config.Get(environment)
+func Get(Config *config.Config) (*App, error) {
+	// get the logger, the level was already validated with the configuration
+	level, _ := logger.ParseLevel(Config.Server.LogLevel)
+	Log := logger.New(os.Stderr, level)
 
 	// get the database client
 	DB, err := database.Get(*Config)
@@ -37,5 +74,32 @@ func Get(environment map[string]string) (*App, error) {
 		return nil, err
 	}
 
-	return &App { DB: DB, Config: Config, Plaid: Plaid }, nil
+	// get the keyring used to encrypt tokens
+	Keyring, err := encryption.Get(*Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the keyring used to sign access tokens
+	Signing, err := signing.Get(*Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// get the mailer emails are sent to users with
+	Mailer, err := mailer.Get(*Config, Log)
+	if err != nil {
+		return nil, err
+	}
+
+	// start the worker background jobs run on
+	Worker := worker.New(workerQueueSize, Log)
+
+	return &App { DB: DB, Config: Config, Plaid: Plaid, Keyring: Keyring, Signing: Signing, Log: Log, Mailer: Mailer, Worker: Worker }, nil
+}
+
+// Logger returns the logger of the request the context belongs to, which writes the request id
+// and user with every entry, or the logger of the application if there is no request
+func (app *App) Logger(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, app.Log)
 }
\ No newline at end of file
@@ -1,64 +1,599 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
-)
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
 
-// TODO make implement dev key for plaid api
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+)
 
 type Config struct {
-	plaid	 map[string]string
-	database map[string]string
-	server 	 map[string]string
-}
-
-// Get the environment variable configuration necessary to run application
-func Get(environment map[string]string) *Config {
-	config := &Config {
-		plaid: map[string]string {
-			"countryCode": 	environment["PLAID_COUNTRY_CODES"],
-			"redirectUri": 	environment["PLAID_REDIRECT_URI"],
-			"secret": 		environment["PLAID_SECRET"],
-			"client": 		environment["PLAID_CLIENT_ID"],
+	// Server describes how the API is served and how its tokens are signed
+	Server		Server		`yaml:"server"`
+
+	// Database describes the connection to the database
+	Database	Database	`yaml:"database"`
+
+	// Plaid describes the credentials and options of the plaid client
+	Plaid		Plaid		`yaml:"plaid"`
+
+	// Encryption describes the keys used to encrypt plaid tokens at rest
+	Encryption	Encryption	`yaml:"encryption"`
+
+	// CORS describes which browser origins can call the API and how
+	CORS		CORS		`yaml:"cors"`
+
+	// JWT describes the keys access tokens are signed with and who they are issued for
+	JWT			JWT			`yaml:"jwt"`
+
+	// Mail describes how emails, such as password reset links, are sent to users
+	Mail		Mail		`yaml:"mail"`
+}
+
+type Server struct {
+	Port			int				`yaml:"port"`			// HOST, port the server listens on
+	Key				string			`yaml:"key"`				// KEY, secret used to sign access tokens
+	ReadTimeout		time.Duration	`yaml:"readTimeout"`		// SERVER_READ_TIMEOUT, to read a whole request
+	WriteTimeout	time.Duration	`yaml:"writeTimeout"`	// SERVER_WRITE_TIMEOUT, to write a response
+	IdleTimeout		time.Duration	`yaml:"idleTimeout"`		// SERVER_IDLE_TIMEOUT, for the next keep-alive request
+	ShutdownTimeout	time.Duration	`yaml:"shutdownTimeout"`	// SERVER_SHUTDOWN_TIMEOUT, to drain requests
+	TLSCert			string			`yaml:"tlsCert"`			// TLS_CERT_FILE, PEM certificate, enables HTTPS
+	TLSKey			string			`yaml:"tlsKey"`			// TLS_KEY_FILE, PEM key of the certificate
+	LogLevel		string			`yaml:"logLevel"`		// LOG_LEVEL, debug, info, warn, or error
+}
+
+type Database struct {
+	Driver		string	`yaml:"driver"`		// DB_DRIVER, mysql, postgres, or sqlite
+	User		string	`yaml:"user"`		// DB_USERNAME
+	Password	string	`yaml:"password"`	// DB_PASSWORD
+	Host		string	`yaml:"host"`		// DB_ACCESSPT, "test" uses a mocked database
+	Port		int		`yaml:"port"`		// DB_PORT, 0 uses the default port of the driver
+	Name		string	`yaml:"name"`		// DB_DATABASE, the path of the database file for sqlite
+	Options		string	`yaml:"options"`	// DB_OPTIONS, extra connection parameters, e.g. sslmode=disable
+	Migrate		bool	`yaml:"migrate"`	// DB_MIGRATE, whether pending migrations are applied at startup
+}
+
+// defaultPorts are the ports each database driver listens on by default
+var defaultPorts = map[string]int{"mysql": 3306, "postgres": 5432}
+
+type Plaid struct {
+	ClientId		string		`yaml:"clientId"`		// PLAID_CLIENT_ID, "test" disables the client
+	Secret			string		`yaml:"secret"`			// PLAID_SECRET
+	Environment		string		`yaml:"environment"`	// PLAID_ENV, sandbox, development, or production
+	RedirectURI		string		`yaml:"redirectUri"`	// PLAID_REDIRECT_URI, OAuth redirect registered with plaid
+	Webhook			string		`yaml:"webhook"`		// PLAID_WEBHOOK_URL, where plaid sends item webhooks
+	CountryCodes	[]string	`yaml:"countryCodes"`	// PLAID_COUNTRY_CODES, comma separated
+	Products		[]string	`yaml:"products"`		// PLAID_PRODUCTS, comma separated
+	Language		string		`yaml:"language"`		// PLAID_LANGUAGE
+	ClientName		string		`yaml:"clientName"`		// PLAID_CLIENT_NAME, shown to users in plaid link
+	RequireVerified	bool		`yaml:"requireVerified"`	// PLAID_REQUIRE_VERIFIED_EMAIL, users must verify their email to link banks
+}
+
+type CORS struct {
+	AllowedOrigins		[]string		`yaml:"allowedOrigins"`		// CORS_ALLOWED_ORIGINS, comma separated, none by default
+	AllowedMethods		[]string		`yaml:"allowedMethods"`		// CORS_ALLOWED_METHODS, comma separated
+	AllowedHeaders		[]string		`yaml:"allowedHeaders"`		// CORS_ALLOWED_HEADERS, comma separated
+	AllowCredentials	bool			`yaml:"allowCredentials"`	// CORS_ALLOW_CREDENTIALS, lets browsers send cookies
+	MaxAge				time.Duration	`yaml:"maxAge"`				// CORS_MAX_AGE, how long preflights are cached
+	CookieSameSite		string			`yaml:"cookieSameSite"`		// COOKIE_SAMESITE, lax, strict, or none
+}
+
+type JWT struct {
+	KeyId			string				`yaml:"keyId"`			// JWT_KEY_ID, key new access tokens are signed with, default is KEY
+	Keys			map[string]string	`yaml:"keys"`			// JWT_KEYS, comma separated id:secret HMAC keys
+	PrivateKeyFiles	map[string]string	`yaml:"privateKeyFiles"`	// JWT_PRIVATE_KEY_FILES, comma separated id:path RSA or Ed25519 PEM keys
+	Issuer			string				`yaml:"issuer"`			// JWT_ISSUER, iss claim of access tokens
+	Audience		string				`yaml:"audience"`		// JWT_AUDIENCE, aud claim of access tokens
+}
+
+type Mail struct {
+	Driver			string	`yaml:"driver"`			// MAIL_DRIVER, smtp, file, or log
+	From			string	`yaml:"from"`			// MAIL_FROM, sender of every email, e.g. Scale <no-reply@example.com>
+	Dir				string	`yaml:"dir"`				// MAIL_DIR, where the file driver writes emails
+	SMTPHost		string	`yaml:"smtpHost"`		// SMTP_HOST
+	SMTPPort		int		`yaml:"smtpPort"`		// SMTP_PORT
+	SMTPUsername	string	`yaml:"smtpUsername"`	// SMTP_USERNAME, no authentication if empty
+	SMTPPassword	string	`yaml:"smtpPassword"`	// SMTP_PASSWORD
+	AppURL			string	`yaml:"appUrl"`			// APP_URL, dashboard the links of emails point to
+}
+
+type Encryption struct {
+	KeyId	string				`yaml:"keyId"`	// TOKEN_KEY_ID, id of the key new tokens are encrypted with
+	Keys	map[string]string	`yaml:"keys"`	// TOKEN_KEYS, comma separated id:base64 pairs
+}
+
+// ValidationError lists every setting that is missing or malformed, so that all of them can be
+// fixed at once instead of finding them one startup at a time
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n\t" + strings.Join(e.Problems, "\n\t")
+}
+
+// Default returns the configuration used for every setting that is not given
+func Default() *Config {
+	return &Config {
+		Server: Server {
+			Port: 5000,
+			ReadTimeout: 15 * time.Second,
+			WriteTimeout: 60 * time.Second,
+			IdleTimeout: 120 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+			LogLevel: "info",
+		},
+		Database: Database { Driver: "mysql", Migrate: true },
+		CORS: CORS {
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-Request-Id"},
+			AllowCredentials: true,
+			MaxAge: 10 * time.Minute,
+			CookieSameSite: "lax",
+		},
+		JWT: JWT {
+			KeyId: DefaultJWTKeyId,
+			Issuer: "scale",
+			Audience: "scale-api",
 		},
-		database: map[string]string {
-			"user":		environment["DB_USERNAME"],
-			"password": environment["DB_PASSWORD"],
-			"host": 	environment["DB_ACCESSPT"],
-			"name": 	environment["DB_DATABASE"],
+		Mail: Mail {
+			Driver: "log",
+			From: "Scale <no-reply@localhost>",
+			SMTPPort: 587,
 		},
-		server: map[string]string {
-			"port": environment["HOST"],
-			"key":  environment["KEY"],
+		Plaid: Plaid {
+			Environment: "sandbox",
+			CountryCodes: []string{"US"},
+			Products: []string{"auth", "transactions"},
+			Language: "en",
+			ClientName: "Scale",
 		},
 	}
+}
+
+// Load gets the configuration necessary to run the application. Settings are read from, in order
+// of precedence, the command line flags, the system environment, the .env file, and the YAML file
+// given with the -config flag, with the defaults used for anything left unset. Every setting that
+// is missing or malformed is reported in a single ValidationError.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("scale", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of a YAML configuration file")
+	envFile := flags.String("env", ".env", "path of the .env file")
+	port := flags.Int("port", 0, "port the server listens on")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config := Default()
+	var problems []string
+
+	// the YAML file is only read when it is given
+	if len(*configFile) > 0 {
+		data, err := ioutil.ReadFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", *configFile, err)
+		}
+	}
+
+	// the .env file is optional unless a different one was asked for
+	environment, err := godotenv.Read(*envFile)
+	if err != nil && (*envFile != ".env" || !os.IsNotExist(err)) {
+		return nil, err
+	}
+	problems = append(problems, config.ApplyEnvironment(environment)...)
+	problems = append(problems, config.ApplyEnvironment(Environ())...)
+
+	if *port != 0 {
+		config.Server.Port = *port
+	}
+
+	if config.Database.Port == 0 {
+		config.Database.Port = defaultPorts[config.Database.Driver]
+	}
+
+	problems = append(problems, config.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError { Problems: problems }
+	}
+
+	return config, nil
+}
+
+// Environ returns the system environment as a map. Values can contain "=", so only the first
+// one separates the name from the value.
+func Environ() map[string]string {
+	environment := make(map[string]string)
+	for _, item := range os.Environ() {
+		splits := strings.SplitN(item, "=", 2)
+		if len(splits) == 2 {
+			environment[splits[0]] = splits[1]
+		}
+	}
+
+	return environment
+}
+
+// ApplyEnvironment overrides the configuration with every setting present in the environment. The
+// returned slice describes every value that could not be parsed.
+func (config *Config) ApplyEnvironment(environment map[string]string) []string {
+	var problems []string
+
+	setString := func(name string, value *string) {
+		if v, ok := environment[name]; ok {
+			*value = strings.TrimSpace(v)
+		}
+	}
+
+	setInt := func(name string, value *int) {
+		if v, ok := environment[name]; ok {
+			number, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be a number, got %q", name, v))
+				return
+			}
+			*value = number
+		}
+	}
+
+	setDuration := func(name string, value *time.Duration) {
+		if v, ok := environment[name]; ok {
+			duration, err := time.ParseDuration(strings.TrimSpace(v))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be a duration such as 30s, got %q", name, v))
+				return
+			}
+			*value = duration
+		}
+	}
+
+	setBool := func(name string, value *bool) {
+		if v, ok := environment[name]; ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s must be true or false, got %q", name, v))
+				return
+			}
+			*value = b
+		}
+	}
+
+	setPairs := func(name string, value *map[string]string) {
+		if v, ok := environment[name]; ok {
+			*value = make(map[string]string)
+			for _, pair := range splitList(v) {
+				parts := strings.SplitN(pair, ":", 2)
+				if len(parts) != 2 {
+					problems = append(problems, fmt.Sprintf("%s entry %q must be formatted as id:key", name, pair))
+					continue
+				}
+				(*value)[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	setInt("HOST", &config.Server.Port)
+	setString("KEY", &config.Server.Key)
+	setDuration("SERVER_READ_TIMEOUT", &config.Server.ReadTimeout)
+	setDuration("SERVER_WRITE_TIMEOUT", &config.Server.WriteTimeout)
+	setDuration("SERVER_IDLE_TIMEOUT", &config.Server.IdleTimeout)
+	setDuration("SERVER_SHUTDOWN_TIMEOUT", &config.Server.ShutdownTimeout)
+	setString("TLS_CERT_FILE", &config.Server.TLSCert)
+	setString("TLS_KEY_FILE", &config.Server.TLSKey)
+	setString("LOG_LEVEL", &config.Server.LogLevel)
+
+	setString("DB_DRIVER", &config.Database.Driver)
+	setString("DB_USERNAME", &config.Database.User)
+	setString("DB_PASSWORD", &config.Database.Password)
+	setString("DB_ACCESSPT", &config.Database.Host)
+	setInt("DB_PORT", &config.Database.Port)
+	setString("DB_DATABASE", &config.Database.Name)
+	setString("DB_OPTIONS", &config.Database.Options)
+	setBool("DB_MIGRATE", &config.Database.Migrate)
+
+	setString("PLAID_CLIENT_ID", &config.Plaid.ClientId)
+	setString("PLAID_SECRET", &config.Plaid.Secret)
+	setString("PLAID_ENV", &config.Plaid.Environment)
+	setString("PLAID_REDIRECT_URI", &config.Plaid.RedirectURI)
+	setString("PLAID_WEBHOOK_URL", &config.Plaid.Webhook)
+	setString("PLAID_LANGUAGE", &config.Plaid.Language)
+	setString("PLAID_CLIENT_NAME", &config.Plaid.ClientName)
+	setBool("PLAID_REQUIRE_VERIFIED_EMAIL", &config.Plaid.RequireVerified)
+	if v, ok := environment["PLAID_COUNTRY_CODES"]; ok {
+		config.Plaid.CountryCodes = splitList(v)
+	}
+	if v, ok := environment["PLAID_PRODUCTS"]; ok {
+		config.Plaid.Products = splitList(v)
+	}
+
+	if v, ok := environment["CORS_ALLOWED_ORIGINS"]; ok {
+		config.CORS.AllowedOrigins = splitList(v)
+	}
+	if v, ok := environment["CORS_ALLOWED_METHODS"]; ok {
+		config.CORS.AllowedMethods = splitList(v)
+	}
+	if v, ok := environment["CORS_ALLOWED_HEADERS"]; ok {
+		config.CORS.AllowedHeaders = splitList(v)
+	}
+	setBool("CORS_ALLOW_CREDENTIALS", &config.CORS.AllowCredentials)
+	setDuration("CORS_MAX_AGE", &config.CORS.MaxAge)
+	setString("COOKIE_SAMESITE", &config.CORS.CookieSameSite)
+
+	setString("JWT_KEY_ID", &config.JWT.KeyId)
+	setPairs("JWT_KEYS", &config.JWT.Keys)
+	setPairs("JWT_PRIVATE_KEY_FILES", &config.JWT.PrivateKeyFiles)
+	setString("JWT_ISSUER", &config.JWT.Issuer)
+	setString("JWT_AUDIENCE", &config.JWT.Audience)
+
+	setString("MAIL_DRIVER", &config.Mail.Driver)
+	setString("MAIL_FROM", &config.Mail.From)
+	setString("MAIL_DIR", &config.Mail.Dir)
+	setString("SMTP_HOST", &config.Mail.SMTPHost)
+	setInt("SMTP_PORT", &config.Mail.SMTPPort)
+	setString("SMTP_USERNAME", &config.Mail.SMTPUsername)
+	setString("SMTP_PASSWORD", &config.Mail.SMTPPassword)
+	setString("APP_URL", &config.Mail.AppURL)
+
+	setString("TOKEN_KEY_ID", &config.Encryption.KeyId)
+	setPairs("TOKEN_KEYS", &config.Encryption.Keys)
+
+	return problems
+}
+
+// Validate checks that every required setting is present and that every setting is well formed.
+// If there are any problems they are all returned in a ValidationError.
+func (config *Config) Validate() error {
+	if problems := config.problems(); len(problems) > 0 {
+		return &ValidationError { Problems: problems }
+	}
 
-	return config
+	return nil
 }
 
-// GetDBConnectionString retrieves the required string to open database instance
+// problems describes every missing or malformed setting of the configuration
+func (config *Config) problems() []string {
+	var problems []string
+	require := func(name, value string) {
+		if len(value) == 0 {
+			problems = append(problems, name+" is required")
+		}
+	}
+
+	if config.Server.Port <= 0 || config.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("HOST must be a valid port, got %d", config.Server.Port))
+	}
+	if config.JWT.KeyId == DefaultJWTKeyId {
+		require("KEY", config.Server.Key)
+	}
+	if len(config.Server.Key) > 0 && len(config.Server.Key) < minJWTSecretLength {
+		problems = append(problems, fmt.Sprintf("KEY must be at least %d characters", minJWTSecretLength))
+	}
+	for name, timeout := range map[string]time.Duration{
+		"SERVER_READ_TIMEOUT":     config.Server.ReadTimeout,
+		"SERVER_WRITE_TIMEOUT":    config.Server.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":     config.Server.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT": config.Server.ShutdownTimeout,
+	} {
+		if timeout < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %v", name, timeout))
+		}
+	}
+	if (len(config.Server.TLSCert) == 0) != (len(config.Server.TLSKey) == 0) {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be given together")
+	}
+	if _, err := logger.ParseLevel(config.Server.LogLevel); err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL must be debug, info, warn, or error, got %q", config.Server.LogLevel))
+	}
+
+	switch config.Database.Driver {
+	case "sqlite":
+		// sqlite databases are files, so only their path is needed
+		if config.Database.Host != "test" {
+			require("DB_DATABASE", config.Database.Name)
+		}
+	case "mysql", "postgres":
+		require("DB_ACCESSPT", config.Database.Host)
+		if config.Database.Host != "test" {
+			require("DB_USERNAME", config.Database.User)
+			require("DB_DATABASE", config.Database.Name)
+			if config.Database.Port <= 0 || config.Database.Port > 65535 {
+				problems = append(problems, fmt.Sprintf("DB_PORT must be a valid port, got %d", config.Database.Port))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf(
+			"DB_DRIVER must be mysql, postgres, or sqlite, got %q", config.Database.Driver,
+		))
+	}
+
+	require("PLAID_CLIENT_ID", config.Plaid.ClientId)
+	if config.Plaid.ClientId != "test" {
+		require("PLAID_SECRET", config.Plaid.Secret)
+		switch config.Plaid.Environment {
+		case "sandbox", "development", "production":
+		default:
+			problems = append(problems, fmt.Sprintf(
+				"PLAID_ENV must be sandbox, development, or production, got %q", config.Plaid.Environment,
+			))
+		}
+	}
+	if len(config.Plaid.CountryCodes) == 0 {
+		problems = append(problems, "PLAID_COUNTRY_CODES must contain at least one country")
+	}
+	if len(config.Plaid.Products) == 0 {
+		problems = append(problems, "PLAID_PRODUCTS must contain at least one product")
+	}
+	require("PLAID_LANGUAGE", config.Plaid.Language)
+	require("PLAID_CLIENT_NAME", config.Plaid.ClientName)
+	for name, value := range map[string]string{
+		"PLAID_WEBHOOK_URL":  config.Plaid.Webhook,
+		"PLAID_REDIRECT_URI": config.Plaid.RedirectURI,
+	} {
+		if parsed, err := url.Parse(value); len(value) > 0 && (err != nil || !parsed.IsAbs()) {
+			problems = append(problems, fmt.Sprintf("%s must be an absolute url, got %q", name, value))
+		}
+	}
+
+	for _, origin := range config.CORS.AllowedOrigins {
+		if origin == "*" {
+			// browsers refuse credentials from a server that allows every origin
+			if config.CORS.AllowCredentials {
+				problems = append(problems, "CORS_ALLOWED_ORIGINS can't be * when CORS_ALLOW_CREDENTIALS is true")
+			}
+			continue
+		}
+
+		if parsed, err := url.Parse(origin); err != nil || !parsed.IsAbs() || len(parsed.Host) == 0 || len(parsed.Path) > 0 {
+			problems = append(problems, fmt.Sprintf("CORS_ALLOWED_ORIGINS must contain origins such as https://example.com, got %q", origin))
+		}
+	}
+	if config.CORS.MaxAge < 0 {
+		problems = append(problems, fmt.Sprintf("CORS_MAX_AGE must not be negative, got %v", config.CORS.MaxAge))
+	}
+	switch config.CORS.CookieSameSite {
+	case "lax", "strict", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("COOKIE_SAMESITE must be lax, strict, or none, got %q", config.CORS.CookieSameSite))
+	}
+
+	require("JWT_KEY_ID", config.JWT.KeyId)
+	require("JWT_ISSUER", config.JWT.Issuer)
+	require("JWT_AUDIENCE", config.JWT.Audience)
+	_, isSecret := config.JWT.Keys[config.JWT.KeyId]
+	_, isPrivateKey := config.JWT.PrivateKeyFiles[config.JWT.KeyId]
+	if config.JWT.KeyId != DefaultJWTKeyId && !isSecret && !isPrivateKey {
+		problems = append(problems, fmt.Sprintf("JWT_KEYS or JWT_PRIVATE_KEY_FILES must contain the key %q", config.JWT.KeyId))
+	}
+	for id, secret := range config.JWT.Keys {
+		if _, ok := config.JWT.PrivateKeyFiles[id]; ok || id == DefaultJWTKeyId {
+			problems = append(problems, fmt.Sprintf("JWT key id %q is used more than once", id))
+		}
+		if len(secret) < minJWTSecretLength {
+			problems = append(problems, fmt.Sprintf("JWT_KEYS key %q must be at least %d characters", id, minJWTSecretLength))
+		}
+	}
+	if _, ok := config.JWT.PrivateKeyFiles[DefaultJWTKeyId]; ok {
+		problems = append(problems, fmt.Sprintf("JWT key id %q is used more than once", DefaultJWTKeyId))
+	}
+
+	switch config.Mail.Driver {
+	case "smtp":
+		require("SMTP_HOST", config.Mail.SMTPHost)
+		if config.Mail.SMTPPort <= 0 || config.Mail.SMTPPort > 65535 {
+			problems = append(problems, fmt.Sprintf("SMTP_PORT must be a valid port, got %d", config.Mail.SMTPPort))
+		}
+	case "file":
+		require("MAIL_DIR", config.Mail.Dir)
+	case "log":
+	default:
+		problems = append(problems, fmt.Sprintf("MAIL_DRIVER must be smtp, file, or log, got %q", config.Mail.Driver))
+	}
+	if _, err := mail.ParseAddress(config.Mail.From); err != nil {
+		problems = append(problems, fmt.Sprintf("MAIL_FROM must be an email address, got %q", config.Mail.From))
+	}
+	if parsed, err := url.Parse(config.Mail.AppURL); len(config.Mail.AppURL) > 0 && (err != nil || !parsed.IsAbs()) {
+		problems = append(problems, fmt.Sprintf("APP_URL must be an absolute url, got %q", config.Mail.AppURL))
+	}
+
+	require("TOKEN_KEY_ID", config.Encryption.KeyId)
+	if _, ok := config.Encryption.Keys[config.Encryption.KeyId]; !ok && len(config.Encryption.KeyId) > 0 {
+		problems = append(problems, fmt.Sprintf("TOKEN_KEYS must contain the key %q", config.Encryption.KeyId))
+	}
+	for id, key := range config.Encryption.Keys {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || (len(decoded) != 16 && len(decoded) != 24 && len(decoded) != 32) {
+			problems = append(problems, fmt.Sprintf("TOKEN_KEYS key %q must be a base64 encoded 16, 24, or 32 byte key", id))
+		}
+	}
+
+	return problems
+}
+
+// GetDBConnectionString retrieves the required string to open database instance, in the format
+// the driver of the database expects
 func (config *Config) GetDBConnectionString() string {
 	// check if config is using a testing host for the database, if so return a
 	// test connection string
-	if config.database["host"] == "test" {
+	if config.Database.Host == "test" {
 		return "test"
 	}
 
-	return fmt.Sprintf(
-		"%s:%s@tcp(%s:3306)/%s", 
-		config.database["user"],
-		config.database["password"],
-		config.database["host"],
-		config.database["name"],
-	)
+	var connectionString string
+	options := config.Database.Options
+	switch config.Database.Driver {
+	case "postgres":
+		connection := url.URL {
+			Scheme: "postgres",
+			User: url.UserPassword(config.Database.User, config.Database.Password),
+			Host: fmt.Sprintf("%s:%d", config.Database.Host, config.Database.Port),
+			Path: "/" + config.Database.Name,
+		}
+		connectionString = connection.String()
+	case "sqlite":
+		// requests are served concurrently, so writers wait for each other instead of failing
+		connectionString = "file:" + config.Database.Name
+		options = strings.Trim("_busy_timeout=5000&_journal_mode=WAL&" + options, "&")
+	default:
+		connectionString = fmt.Sprintf(
+			"%s:%s@tcp(%s:%d)/%s",
+			config.Database.User,
+			config.Database.Password,
+			config.Database.Host,
+			config.Database.Port,
+			config.Database.Name,
+		)
+	}
+
+	if len(options) > 0 {
+		connectionString += "?" + options
+	}
+
+	return connectionString
 }
 
-// GetPlaid will retrieve all plaid client details
-func (config *Config) GetPlaid() map[string]string {
-	return config.plaid
+// DefaultJWTKeyId is the id of the KEY secret when access tokens are signed with it
+const DefaultJWTKeyId = "default"
+
+// minJWTSecretLength is the shortest HMAC secret access tokens can be signed with, whether it is
+// KEY or one of JWT_KEYS
+const minJWTSecretLength = 32
+
+// ErrMissingKey is returned when tokens would have to be signed without a secret
+var ErrMissingKey = errors.New("the KEY used to sign tokens is not configured")
+
+// SigningKey returns the secret used to sign access tokens. It is never empty, since signing
+// tokens with an empty secret would let anyone forge them.
+func (config *Config) SigningKey() ([]byte, error) {
+	if len(config.Server.Key) == 0 {
+		return nil, ErrMissingKey
+	}
+
+	return []byte(config.Server.Key), nil
 }
 
-// GetServer gets the server details
-func (config *Config) GetServer() map[string]string {
-	return config.server
-}
\ No newline at end of file
+// splitList splits a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -2,12 +2,13 @@ package database
 
 import (
 	"database/sql"
-	"log"
 
 	"github.com/elopez00/scale-backend/pkg/application/config"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
@@ -16,34 +17,36 @@ type DB struct {
 
 	// Mock will only be available in a test environment and is used for mocking database functions
 	Mock	sqlmock.Sqlmock
+
+	// Dialect is the kind of database the client is connected to
+	Dialect	Dialect
 }
 
 // Get receives a string that will describe its credentials and will return a database object
 // If the function encounters any errors, it will return it.
 func Get(config config.Config) (*DB, error) {
-	// get the connection string
+	// get the connection string and the database it connects to
 	connectionString := config.GetDBConnectionString()
+	dialect := Dialect(config.Database.Driver)
 
 	// if the connection string is test, return a test database and mock instance
 	if connectionString == "test" {
 		db, mock, _ := sqlmock.New()
-		return &DB { Client: db, Mock: mock }, nil
+		return &DB { Client: db, Mock: mock, Dialect: dialect }, nil
 	}
 
 	// else, we get the database described by the environment
-	db, err := sql.Open("mysql", connectionString)
+	db, err := sql.Open(dialect.Driver(), connectionString)
 	if err != nil {
-		log.Println(connectionString)
 		return nil, err
 	}
 
 	// if we can't successfully ping the server than we return an error
 	if err := db.Ping(); err != nil {
-		log.Println(connectionString)
 		return nil, err
 	}
 
-	return &DB { Client: db, Mock: nil }, nil
+	return &DB { Client: db, Mock: nil, Dialect: dialect }, nil
 }
 
 // Close will close the database client
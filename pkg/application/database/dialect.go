@@ -0,0 +1,94 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes which database the api is connected to, so that the few queries that can't be
+// written the same way for every database can be adapted to it. The zero value is MySQL.
+type Dialect string
+
+const (
+	MySQL		Dialect = "mysql"
+	Postgres	Dialect = "postgres"
+	SQLite		Dialect = "sqlite"
+)
+
+// Dialects are every database the api can be connected to
+var Dialects = []Dialect{MySQL, Postgres, SQLite}
+
+// Driver returns the name of the database/sql driver used to connect to the database
+func (d Dialect) Driver() string {
+	switch d {
+	case Postgres:	return "postgres"
+	case SQLite:	return "sqlite3"
+	default:		return "mysql"
+	}
+}
+
+// Rebind replaces the ? placeholders of the query with the ones the database expects. Queries are
+// always written with ? placeholders, but postgres numbers them as $1, $2, and so on. Question
+// marks inside of string literals are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var rebound strings.Builder
+	inString := false
+	count := 0
+	for _, char := range query {
+		switch {
+		case char == '\'':
+			inString = !inString
+		case char == '?' && !inString:
+			count++
+			rebound.WriteString("$" + strconv.Itoa(count))
+			continue
+		}
+
+		rebound.WriteRune(char)
+	}
+
+	return rebound.String()
+}
+
+// Upsert returns the end of a multi row INSERT that replaces the columns of the rows that already
+// exist instead of failing. The key is the primary key of the table, which MySQL finds by itself.
+func (d Dialect) Upsert(key []string, columns []string) string {
+	updates := make([]string, len(columns))
+	if d == Postgres || d == SQLite {
+		for i, column := range columns {
+			updates[i] = column + "=excluded." + column
+		}
+
+		return " ON CONFLICT (" + strings.Join(key, ", ") + ") DO UPDATE SET " + strings.Join(updates, ", ") + ";"
+	}
+
+	for i, column := range columns {
+		updates[i] = column + "=updated." + column
+	}
+
+	return " AS updated ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ") + ";"
+}
+
+// Concat returns the expression that concatenates the given expressions. SQLite has no CONCAT
+// function and MySQL treats || as OR, so neither can be used everywhere.
+func (d Dialect) Concat(expressions ...string) string {
+	if d == SQLite {
+		return "(" + strings.Join(expressions, " || ") + ")"
+	}
+
+	return "CONCAT(" + strings.Join(expressions, ", ") + ")"
+}
+
+// Like returns the operator that matches a LIKE pattern escaped with backslashes. MySQL and
+// postgres escape with backslashes by default, but SQLite needs to be told to.
+func (d Dialect) Like() string {
+	if d == SQLite {
+		return `LIKE ? ESCAPE '\'`
+	}
+
+	return "LIKE ?"
+}
@@ -0,0 +1,52 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/elopez00/scale-backend/pkg/application/database"
+)
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM categories WHERE id = ? AND name <> '?' AND categoryId IN (?,?)"
+
+	if rebound := database.MySQL.Rebind(query); rebound != query {
+		t.Error("MySQL queries should not change:", rebound)
+	}
+
+	expected := "SELECT id FROM categories WHERE id = $1 AND name <> '?' AND categoryId IN ($2,$3)"
+	if rebound := database.Postgres.Rebind(query); rebound != expected {
+		t.Error("Unexpected postgres query:", rebound)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	key := []string{"id", "itemId"}
+	columns := []string{"category", "name"}
+
+	expected := map[database.Dialect]string{
+		database.MySQL:    " AS updated ON DUPLICATE KEY UPDATE category=updated.category, name=updated.name;",
+		database.Postgres: " ON CONFLICT (id, itemId) DO UPDATE SET category=excluded.category, name=excluded.name;",
+		database.SQLite:   " ON CONFLICT (id, itemId) DO UPDATE SET category=excluded.category, name=excluded.name;",
+	}
+
+	for dialect, upsert := range expected {
+		if actual := dialect.Upsert(key, columns); actual != upsert {
+			t.Error("Unexpected upsert for", dialect, actual)
+		}
+	}
+
+	// the zero dialect is MySQL
+	if actual := database.Dialect("").Upsert(key, columns); actual != expected[database.MySQL] {
+		t.Error("Unexpected upsert for the zero dialect:", actual)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	if concat := database.Postgres.Concat("','", "category"); concat != "CONCAT(',', category)" {
+		t.Error("Unexpected postgres concatenation:", concat)
+	}
+
+	if concat := database.SQLite.Concat("','", "category"); concat != "(',' || category)" {
+		t.Error("Unexpected SQLite concatenation:", concat)
+	}
+}
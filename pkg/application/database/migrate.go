@@ -0,0 +1,344 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the name of the lock held while migrations run, so that several instances
+// starting at the same time don't apply the same migration twice
+const migrationLock = "schema_migrations"
+
+// migrationLockTimeout is how many seconds to wait for another instance to finish migrating
+const migrationLockTimeout = 60
+
+// migrationLockKey identifies the migration lock in postgres, whose locks are numbered instead
+// of named
+const migrationLockKey = 20210601
+
+type Migration struct {
+	// Version orders the migrations, it is the number at the start of the file names
+	Version	int
+
+	// Name describes the migration, it is the rest of the file names
+	Name	string
+
+	// Up and Down are the statements that apply and revert the migration
+	Up		[]string
+	Down	[]string
+}
+
+type MigrationStatus struct {
+	Migration
+
+	// AppliedAt is the unix time the migration was applied at, or 0 if it is pending
+	AppliedAt	int64
+}
+
+// Migrations returns every migration of the dialect embedded in the binary sorted by version.
+// Migrations are the files in the directory of the dialect (e.g. migrations/mysql) named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, where each statement ends with a
+// semicolon at the end of a line. Every dialect has the same migrations, written for its database.
+func Migrations(dialect Dialect) ([]Migration, error) {
+	directory := "migrations/" + string(dialect)
+	files, err := migrationFiles.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("there are no migrations for the %q dialect", dialect)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		name := file.Name()
+		direction := path.Ext(strings.TrimSuffix(name, ".sql"))
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", name)
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(name, direction+".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>", name)
+		}
+
+		data, err := migrationFiles.ReadFile(directory + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration { Version: version, Name: parts[1] }
+			byVersion[version] = migration
+		} else if migration.Name != parts[1] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migration.Name, parts[1])
+		}
+
+		if direction == ".up" {
+			migration.Up = splitStatements(string(data))
+		} else {
+			migration.Down = splitStatements(string(data))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies every pending migration in order and returns the ones that were applied. On
+// Postgres and SQLite every migration is applied in a transaction along with its version, so if
+// one fails it is rolled back and can be migrated again once it is fixed. MySQL commits schema
+// changes as soon as they run and can't roll them back, so if a migration fails there the
+// statements before the failing one stay applied and have to be reverted by hand.
+func (db *DB) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0)
+	err = db.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			query := db.Dialect.Rebind("INSERT INTO schema_migrations(version, name, appliedAt) VALUES(?,?,?)")
+			err := db.runMigration(ctx, conn, migration.Up, query, migration.Version, migration.Name, time.Now().Unix())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Rollback reverts the given number of the most recently applied migrations, newest first, and
+// returns the ones that were reverted
+func (db *DB) Rollback(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := make([]Migration, 0)
+	err = db.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			query := db.Dialect.Rebind("DELETE FROM schema_migrations WHERE version = ?")
+			if err := db.runMigration(ctx, conn, migration.Down, query, migration.Version); err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// MigrationStatus returns every migration along with the time it was applied at, if it was
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Client.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status = append(status, MigrationStatus { Migration: migration, AppliedAt: versions[migration.Version] })
+	}
+
+	return status, nil
+}
+
+// withMigrationLock runs the function on a single connection while holding the migration lock.
+// The lock belongs to the connection, which is why every migration query has to use it. SQLite
+// databases are files that a single instance uses, so they are not locked.
+func (db *DB) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Client.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch db.Dialect {
+	case SQLite:
+		return fn(conn)
+	case Postgres:
+		// postgres waits for the lock until the context is done, so it is given the same timeout
+		lockCtx, cancel := context.WithTimeout(ctx, migrationLockTimeout * time.Second)
+		defer cancel()
+
+		if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("timed out waiting for another instance to finish migrating: %v", err)
+		}
+
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		return fn(conn)
+	}
+
+	var acquired sql.NullInt64
+	query := "SELECT GET_LOCK(?, ?)"
+	if err := conn.QueryRowContext(ctx, query, migrationLock, migrationLockTimeout).Scan(&acquired); err != nil {
+		return err
+	}
+
+	if acquired.Int64 != 1 {
+		return errors.New("timed out waiting for another instance to finish migrating")
+	}
+
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLock)
+	return fn(conn)
+}
+
+// appliedVersions creates the schema_migrations table if needed and returns the time every applied
+// migration was applied at, by version
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]int64, error) {
+	query :=
+		"CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version BIGINT NOT NULL, name VARCHAR(255) NOT NULL, appliedAt BIGINT NOT NULL, PRIMARY KEY (version))"
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, appliedAt FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+// execer is what statements are executed with, either the connection holding the migration lock or
+// a transaction started on it
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// runMigration executes the statements of a migration followed by the query that records it in
+// schema_migrations. Postgres and SQLite run them in a transaction, so that the schema and its
+// version are changed together or not at all. MySQL implicitly commits every schema change, so a
+// transaction would not undo anything and the statements are executed on the connection instead.
+func (db *DB) runMigration(ctx context.Context, conn *sql.Conn, statements []string, record string, args ...interface{}) error {
+	if db.Dialect != Postgres && db.Dialect != SQLite {
+		if err := execStatements(ctx, conn, statements); err != nil {
+			return err
+		}
+
+		_, err := conn.ExecContext(ctx, record, args...)
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := execStatements(ctx, tx, statements); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execStatements executes every statement of a migration in order
+func execStatements(ctx context.Context, conn execer, statements []string) error {
+	for _, statement := range statements {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitStatements splits a migration file into its statements, ignoring comment lines
+func splitStatements(data string) []string {
+	statements := make([]string, 0)
+	var statement strings.Builder
+
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		statement.WriteString(line + "\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(statement.String()); len(rest) > 0 {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
@@ -0,0 +1,318 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+	"github.com/elopez00/scale-backend/pkg/application/database"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// getMockDB returns a database backed by sqlmock
+func getMockDB() *database.DB {
+	mock := config.Default()
+	mock.Database.Host = "test"
+
+	db, _ := database.Get(*mock)
+	return db
+}
+
+// expectLock adds the expectations of the migration lock being acquired and the applied
+// versions being read
+func expectLock(db *database.DB, versions ...int64) {
+	db.Mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).
+		WithArgs("schema_migrations", 60).
+		WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+	db.Mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rows := sqlmock.NewRows([]string{"version", "appliedAt"})
+	for _, version := range versions {
+		rows.AddRow(version, 1622505600)
+	}
+	db.Mock.ExpectQuery(`SELECT version, appliedAt FROM schema_migrations`).WillReturnRows(rows)
+}
+
+func TestMigrations(t *testing.T) {
+	mysql, err := database.Migrations(database.MySQL)
+	if err != nil {
+		t.Fatal("Failed to read the migrations:", err)
+	}
+
+	// the initial migration creates every table the api was written against
+	if mysql[0].Name != "initial" || len(mysql[0].Up) != 4 {
+		t.Fatal("Unexpected initial migration:", mysql[0].Name, len(mysql[0].Up))
+	}
+
+	for _, dialect := range database.Dialects {
+		migrations, err := database.Migrations(dialect)
+		if err != nil {
+			t.Fatal("Failed to read the migrations:", err)
+		}
+
+		// every dialect has the same migrations
+		if len(migrations) != len(mysql) {
+			t.Fatal("The migrations of", dialect, "don't match the MySQL ones")
+		}
+
+		for i, migration := range migrations {
+			if migration.Version != i+1 || migration.Name != mysql[i].Name {
+				t.Fatal("The migrations are not numbered in order:", dialect, migration.Version, migration.Name)
+			}
+
+			if len(migration.Up) == 0 || len(migration.Down) == 0 {
+				t.Fatal("The migration is missing statements:", dialect, migration.Name)
+			}
+
+			for _, statement := range append(migration.Up, migration.Down...) {
+				if strings.HasPrefix(statement, "--") || !strings.HasSuffix(statement, ";") {
+					t.Fatal("The statement was not split correctly:", statement)
+				}
+			}
+		}
+	}
+
+	if _, err := database.Migrations("oracle"); err == nil {
+		t.Fatal("Unknown dialects should not have migrations")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := getMockDB()
+	defer db.Close()
+
+	migrations, _ := database.Migrations(database.MySQL)
+
+	// only the migrations after the second one are pending
+	expectLock(db, 1, 2)
+	for _, migration := range migrations[2:] {
+		for range migration.Up {
+			db.Mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		db.Mock.
+			ExpectExec(`INSERT INTO schema_migrations\(version, name, appliedAt\) VALUES\(\?,\?,\?\)`).
+			WithArgs(migration.Version, migration.Name, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	db.Mock.ExpectExec(`SELECT RELEASE_LOCK\(\?\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := db.Migrate(context.Background())
+	if err != nil {
+		t.Fatal("Failed to migrate:", err)
+	}
+
+	if len(applied) != len(migrations)-2 || applied[0].Version != 3 {
+		t.Fatal("The wrong migrations were applied:", applied)
+	}
+
+	if err := db.Mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("There were unfulfilled expectations:", err)
+	}
+}
+
+func TestMigrateLocked(t *testing.T) {
+	db := getMockDB()
+	defer db.Close()
+
+	// another instance holds the lock for too long
+	db.Mock.ExpectQuery(`SELECT GET_LOCK\(\?, \?\)`).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+
+	if _, err := db.Migrate(context.Background()); err == nil {
+		t.Fatal("Migrations should not run without the lock")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db := getMockDB()
+	defer db.Close()
+
+	migrations, _ := database.Migrations(database.MySQL)
+	last := migrations[len(migrations)-1]
+
+	// every migration is applied, only the last one is reverted
+	versions := make([]int64, 0)
+	for _, migration := range migrations {
+		versions = append(versions, int64(migration.Version))
+	}
+	expectLock(db, versions...)
+	for range last.Down {
+		db.Mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	db.Mock.
+		ExpectExec(`DELETE FROM schema_migrations WHERE version \= \?`).
+		WithArgs(last.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectExec(`SELECT RELEASE_LOCK\(\?\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := db.Rollback(context.Background(), 1)
+	if err != nil {
+		t.Fatal("Failed to roll back:", err)
+	}
+
+	if len(reverted) != 1 || reverted[0].Version != last.Version {
+		t.Fatal("The wrong migrations were reverted:", reverted)
+	}
+
+	if err := db.Mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("There were unfulfilled expectations:", err)
+	}
+}
+
+func TestMigratePostgresRollsBackFailures(t *testing.T) {
+	db := getMockDB()
+	defer db.Close()
+	db.Dialect = database.Postgres
+
+	migrations, _ := database.Migrations(database.Postgres)
+	last := migrations[len(migrations)-1]
+
+	// every migration but the last one is applied
+	rows := sqlmock.NewRows([]string{"version", "appliedAt"})
+	for _, migration := range migrations[:len(migrations)-1] {
+		rows.AddRow(migration.Version, 1622505600)
+	}
+	db.Mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectQuery(`SELECT version, appliedAt FROM schema_migrations`).WillReturnRows(rows)
+
+	// the migration fails part way, so neither its statements nor its version are committed
+	db.Mock.ExpectBegin()
+	db.Mock.ExpectExec(`.+`).WillReturnError(errors.New("syntax error"))
+	db.Mock.ExpectRollback()
+	db.Mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := db.Migrate(context.Background())
+	if err == nil || !strings.Contains(err.Error(), last.Name) {
+		t.Fatal("The failing migration should have been reported:", err)
+	}
+
+	if len(applied) != 0 {
+		t.Fatal("The failing migration should not have been applied:", applied)
+	}
+
+	if err := db.Mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("There were unfulfilled expectations:", err)
+	}
+}
+
+func TestMigratePostgres(t *testing.T) {
+	db := getMockDB()
+	defer db.Close()
+	db.Dialect = database.Postgres
+
+	migrations, _ := database.Migrations(database.Postgres)
+	last := migrations[len(migrations)-1]
+
+	rows := sqlmock.NewRows([]string{"version", "appliedAt"})
+	for _, migration := range migrations[:len(migrations)-1] {
+		rows.AddRow(migration.Version, 1622505600)
+	}
+	db.Mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.Mock.ExpectQuery(`SELECT version, appliedAt FROM schema_migrations`).WillReturnRows(rows)
+
+	// the statements and the version of the migration are committed together
+	db.Mock.ExpectBegin()
+	for range last.Up {
+		db.Mock.ExpectExec(`.+`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	db.Mock.
+		ExpectExec(`INSERT INTO schema_migrations\(version, name, appliedAt\) VALUES\(\$1,\$2,\$3\)`).
+		WithArgs(last.Version, last.Name, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.Mock.ExpectCommit()
+	db.Mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := db.Migrate(context.Background())
+	if err != nil || len(applied) != 1 || applied[0].Version != last.Version {
+		t.Fatal("Failed to apply the last migration:", applied, err)
+	}
+
+	if err := db.Mock.ExpectationsWereMet(); err != nil {
+		t.Fatal("There were unfulfilled expectations:", err)
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrate")
+	defer os.RemoveAll(dir)
+
+	cfg := config.Default()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Name = filepath.Join(dir, "scale.db")
+
+	db, err := database.Get(*cfg)
+	if err != nil {
+		t.Fatal("Failed to open the database:", err)
+	}
+	defer db.Close()
+
+	// the migrations are run against a real database, so every statement has to be valid SQLite
+	ctx := context.Background()
+	applied, err := db.Migrate(ctx)
+	if err != nil {
+		t.Fatal("Failed to migrate:", err)
+	}
+
+	reverted, err := db.Rollback(ctx, len(applied))
+	if err != nil || len(reverted) != len(applied) {
+		t.Fatal("Failed to roll back every migration:", reverted, err)
+	}
+
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatal("Failed to migrate after rolling back:", err)
+	}
+
+	status, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal("Failed to get the status of the migrations:", err)
+	}
+
+	for _, migration := range status {
+		if migration.AppliedAt == 0 {
+			t.Error("The migration was not applied:", migration.Name)
+		}
+	}
+}
+
+func TestMigrateSQLiteRollsBackFailures(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "migrate")
+	defer os.RemoveAll(dir)
+
+	cfg := config.Default()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Name = filepath.Join(dir, "scale.db")
+
+	db, err := database.Get(*cfg)
+	if err != nil {
+		t.Fatal("Failed to open the database:", err)
+	}
+	defer db.Close()
+
+	// the transactions table is in the way, so the third migration fails after altering plaidtokens
+	ctx := context.Background()
+	if _, err := db.Client.ExecContext(ctx, "CREATE TABLE transactions (id VARCHAR(255))"); err != nil {
+		t.Fatal("Failed to create the conflicting table:", err)
+	}
+
+	applied, err := db.Migrate(ctx)
+	if err == nil || len(applied) != 2 {
+		t.Fatal("The third migration should have failed:", applied, err)
+	}
+
+	// once the conflict is gone the third migration applies from the start, which it can't if the
+	// columns it added before failing were kept
+	if _, err := db.Client.ExecContext(ctx, "DROP TABLE transactions"); err != nil {
+		t.Fatal("Failed to drop the conflicting table:", err)
+	}
+
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatal("Failed to migrate after fixing the failed migration:", err)
+	}
+}
@@ -0,0 +1,38 @@
+-- the tables the api was first written against, created only if they don't exist so that
+-- databases set up by hand can adopt migrations
+CREATE TABLE IF NOT EXISTS userinfo (
+	id        VARCHAR(36)  NOT NULL,
+	firstname VARCHAR(255) NOT NULL,
+	lastname  VARCHAR(255) NOT NULL,
+	email     VARCHAR(255) NOT NULL,
+	password  VARCHAR(255) NOT NULL,
+	PRIMARY KEY (id),
+	UNIQUE KEY userinfo_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS plaidtokens (
+	id          VARCHAR(36)  NOT NULL,
+	token       VARCHAR(255) NOT NULL,
+	itemID      VARCHAR(255) NOT NULL,
+	institution VARCHAR(255) NOT NULL,
+	PRIMARY KEY (itemID),
+	KEY plaidtokens_user (id)
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+	id         VARCHAR(36)  NOT NULL,
+	categoryId VARCHAR(36)  NOT NULL,
+	name       VARCHAR(255) NOT NULL,
+	budget     DOUBLE       NOT NULL DEFAULT 0,
+	color      VARCHAR(32)  NOT NULL DEFAULT '',
+	PRIMARY KEY (id, categoryId)
+);
+
+CREATE TABLE IF NOT EXISTS whitelist (
+	id       VARCHAR(36)  NOT NULL,
+	itemId   VARCHAR(36)  NOT NULL,
+	category VARCHAR(36)  NOT NULL,
+	name     VARCHAR(255) NOT NULL,
+	PRIMARY KEY (id, itemId),
+	KEY whitelist_category (category)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE sessions (
+	id           VARCHAR(36) NOT NULL,
+	userId       VARCHAR(36) NOT NULL,
+	refreshToken CHAR(64)    NOT NULL,
+	expires      BIGINT      NOT NULL,
+	revoked      BOOLEAN     NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	KEY sessions_user (userId)
+);
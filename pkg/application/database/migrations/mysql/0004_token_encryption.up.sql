@@ -0,0 +1,5 @@
+-- encrypted tokens are longer than plaintext ones, and tokens stored before this migration
+-- keep an empty key id until they are re-encrypted
+ALTER TABLE plaidtokens
+	MODIFY COLUMN token VARCHAR(512) NOT NULL,
+	ADD COLUMN tokenKeyId VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- only the hash of each reset token is stored, so the table can't be used to reset passwords
+CREATE TABLE password_resets (
+	tokenHash CHAR(64)    NOT NULL,
+	userId    VARCHAR(36) NOT NULL,
+	expires   BIGINT      NOT NULL,
+	used      BOOLEAN     NOT NULL DEFAULT 0,
+	PRIMARY KEY (tokenHash),
+	KEY password_resets_user (userId)
+);
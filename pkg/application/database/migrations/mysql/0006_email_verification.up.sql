@@ -0,0 +1,15 @@
+-- users who onboarded before this migration are trusted, so only new users have to verify
+ALTER TABLE userinfo ADD COLUMN verified BOOLEAN NOT NULL DEFAULT 0;
+UPDATE userinfo SET verified = 1;
+
+-- only the hash of each verification token is stored, and when it was sent so that resending
+-- can be throttled
+CREATE TABLE email_verifications (
+	tokenHash CHAR(64)    NOT NULL,
+	userId    VARCHAR(36) NOT NULL,
+	created   BIGINT      NOT NULL,
+	expires   BIGINT      NOT NULL,
+	used      BOOLEAN     NOT NULL DEFAULT 0,
+	PRIMARY KEY (tokenHash),
+	KEY email_verifications_user (userId, created)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS whitelist;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS plaidtokens;
+DROP TABLE IF EXISTS userinfo;
@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+	id           VARCHAR(36) NOT NULL,
+	userId       VARCHAR(36) NOT NULL,
+	refreshToken CHAR(64)    NOT NULL,
+	expires      BIGINT      NOT NULL,
+	revoked      BOOLEAN     NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX sessions_user ON sessions (userId);
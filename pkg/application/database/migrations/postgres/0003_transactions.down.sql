@@ -0,0 +1,7 @@
+DROP TABLE transactions;
+
+ALTER TABLE plaidtokens
+	DROP COLUMN lastSync,
+	DROP COLUMN syncCursor,
+	DROP COLUMN status,
+	DROP COLUMN institutionId;
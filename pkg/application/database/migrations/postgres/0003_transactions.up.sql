@@ -0,0 +1,24 @@
+ALTER TABLE plaidtokens
+	ADD COLUMN institutionId VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN status        VARCHAR(64)  NOT NULL DEFAULT '',
+	ADD COLUMN syncCursor    VARCHAR(10)  NOT NULL DEFAULT '',
+	ADD COLUMN lastSync      BIGINT       NOT NULL DEFAULT 0;
+
+CREATE TABLE transactions (
+	id           VARCHAR(255)     NOT NULL,
+	userId       VARCHAR(36)      NOT NULL,
+	itemID       VARCHAR(255)     NOT NULL,
+	accountId    VARCHAR(255)     NOT NULL,
+	amount       DOUBLE PRECISION NOT NULL,
+	date         DATE             NOT NULL,
+	name         VARCHAR(255)     NOT NULL,
+	merchantName VARCHAR(255)     NOT NULL DEFAULT '',
+	category     VARCHAR(1024)    NOT NULL DEFAULT '',
+	pending      BOOLEAN          NOT NULL DEFAULT FALSE,
+	data         JSON             NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX transactions_user_date ON transactions (userId, date);
+
+CREATE INDEX transactions_item_date ON transactions (itemID, date);
@@ -0,0 +1,4 @@
+-- tokens have to be decrypted before rolling back, or they won't be usable afterwards
+ALTER TABLE plaidtokens
+	DROP COLUMN tokenKeyId,
+	ALTER COLUMN token TYPE VARCHAR(255);
@@ -0,0 +1,8 @@
+-- every code tried at the second step of a login, so that users can be locked out after too many
+-- failures no matter how many login challenges were started
+CREATE TABLE two_factor_attempts (
+	userId  VARCHAR(36) NOT NULL,
+	created BIGINT      NOT NULL
+);
+
+CREATE INDEX two_factor_attempts_user ON two_factor_attempts (userId, created);
@@ -0,0 +1,2 @@
+-- when each reset was requested, so that reset emails can be throttled like verification emails
+ALTER TABLE password_resets ADD COLUMN created BIGINT NOT NULL DEFAULT 0;
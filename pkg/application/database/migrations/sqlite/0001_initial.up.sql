@@ -0,0 +1,39 @@
+-- the same tables as the initial MySQL migration. SQLite doesn't enforce the length of text
+-- columns, so the types are only kept to describe what is stored.
+CREATE TABLE IF NOT EXISTS userinfo (
+	id        VARCHAR(36)  NOT NULL,
+	firstname VARCHAR(255) NOT NULL,
+	lastname  VARCHAR(255) NOT NULL,
+	email     VARCHAR(255) NOT NULL UNIQUE,
+	password  VARCHAR(255) NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS plaidtokens (
+	id          VARCHAR(36)  NOT NULL,
+	token       VARCHAR(255) NOT NULL,
+	itemID      VARCHAR(255) NOT NULL,
+	institution VARCHAR(255) NOT NULL,
+	PRIMARY KEY (itemID)
+);
+
+CREATE INDEX IF NOT EXISTS plaidtokens_user ON plaidtokens (id);
+
+CREATE TABLE IF NOT EXISTS categories (
+	id         VARCHAR(36)  NOT NULL,
+	categoryId VARCHAR(36)  NOT NULL,
+	name       VARCHAR(255) NOT NULL,
+	budget     REAL         NOT NULL DEFAULT 0,
+	color      VARCHAR(32)  NOT NULL DEFAULT '',
+	PRIMARY KEY (id, categoryId)
+);
+
+CREATE TABLE IF NOT EXISTS whitelist (
+	id       VARCHAR(36)  NOT NULL,
+	itemId   VARCHAR(36)  NOT NULL,
+	category VARCHAR(36)  NOT NULL,
+	name     VARCHAR(255) NOT NULL,
+	PRIMARY KEY (id, itemId)
+);
+
+CREATE INDEX IF NOT EXISTS whitelist_category ON whitelist (category);
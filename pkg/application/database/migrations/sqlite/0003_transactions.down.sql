@@ -0,0 +1,6 @@
+DROP TABLE transactions;
+
+ALTER TABLE plaidtokens DROP COLUMN lastSync;
+ALTER TABLE plaidtokens DROP COLUMN syncCursor;
+ALTER TABLE plaidtokens DROP COLUMN status;
+ALTER TABLE plaidtokens DROP COLUMN institutionId;
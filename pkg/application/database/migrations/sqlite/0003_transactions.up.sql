@@ -0,0 +1,25 @@
+-- SQLite can only add one column at a time
+ALTER TABLE plaidtokens ADD COLUMN institutionId VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE plaidtokens ADD COLUMN status VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE plaidtokens ADD COLUMN syncCursor VARCHAR(10) NOT NULL DEFAULT '';
+ALTER TABLE plaidtokens ADD COLUMN lastSync BIGINT NOT NULL DEFAULT 0;
+
+-- dates are stored as YYYY-MM-DD text, which sorts and compares the same way dates do
+CREATE TABLE transactions (
+	id           VARCHAR(255)  NOT NULL,
+	userId       VARCHAR(36)   NOT NULL,
+	itemID       VARCHAR(255)  NOT NULL,
+	accountId    VARCHAR(255)  NOT NULL,
+	amount       REAL          NOT NULL,
+	date         VARCHAR(10)   NOT NULL,
+	name         VARCHAR(255)  NOT NULL,
+	merchantName VARCHAR(255)  NOT NULL DEFAULT '',
+	category     VARCHAR(1024) NOT NULL DEFAULT '',
+	pending      BOOLEAN       NOT NULL DEFAULT FALSE,
+	data         TEXT          NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX transactions_user_date ON transactions (userId, date);
+
+CREATE INDEX transactions_item_date ON transactions (itemID, date);
@@ -0,0 +1,2 @@
+-- tokens have to be decrypted before rolling back, or they won't be usable afterwards
+ALTER TABLE plaidtokens DROP COLUMN tokenKeyId;
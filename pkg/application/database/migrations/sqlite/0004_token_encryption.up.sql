@@ -0,0 +1,2 @@
+-- tokens stored before this migration keep an empty key id until they are re-encrypted
+ALTER TABLE plaidtokens ADD COLUMN tokenKeyId VARCHAR(64) NOT NULL DEFAULT '';
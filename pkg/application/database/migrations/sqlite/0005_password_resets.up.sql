@@ -0,0 +1,10 @@
+-- only the hash of each reset token is stored, so the table can't be used to reset passwords
+CREATE TABLE password_resets (
+	tokenHash CHAR(64)    NOT NULL,
+	userId    VARCHAR(36) NOT NULL,
+	expires   BIGINT      NOT NULL,
+	used      BOOLEAN     NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (tokenHash)
+);
+
+CREATE INDEX password_resets_user ON password_resets (userId);
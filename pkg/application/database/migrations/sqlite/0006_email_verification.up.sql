@@ -0,0 +1,16 @@
+-- users who onboarded before this migration are trusted, so only new users have to verify
+ALTER TABLE userinfo ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE userinfo SET verified = TRUE;
+
+-- only the hash of each verification token is stored, and when it was sent so that resending
+-- can be throttled
+CREATE TABLE email_verifications (
+	tokenHash CHAR(64)    NOT NULL,
+	userId    VARCHAR(36) NOT NULL,
+	created   BIGINT      NOT NULL,
+	expires   BIGINT      NOT NULL,
+	used      BOOLEAN     NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (tokenHash)
+);
+
+CREATE INDEX email_verifications_user ON email_verifications (userId, created);
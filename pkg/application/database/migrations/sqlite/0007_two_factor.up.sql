@@ -0,0 +1,26 @@
+-- the TOTP secret is encrypted like plaid tokens, and lastStep is the time step of the last code
+-- that was accepted, so that a code can't be used twice
+CREATE TABLE two_factor (
+	userId      VARCHAR(36)  NOT NULL,
+	secret      VARCHAR(255) NOT NULL,
+	secretKeyId VARCHAR(64)  NOT NULL,
+	enabled     BOOLEAN      NOT NULL DEFAULT FALSE,
+	lastStep    BIGINT       NOT NULL DEFAULT 0,
+	PRIMARY KEY (userId)
+);
+
+-- recovery codes and login challenges are only stored hashed, like reset tokens
+CREATE TABLE recovery_codes (
+	userId   VARCHAR(36) NOT NULL,
+	codeHash CHAR(64)    NOT NULL,
+	used     BOOLEAN     NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (userId, codeHash)
+);
+
+CREATE TABLE login_challenges (
+	tokenHash CHAR(64)    NOT NULL,
+	userId    VARCHAR(36) NOT NULL,
+	expires   BIGINT      NOT NULL,
+	attempts  INT         NOT NULL DEFAULT 0,
+	PRIMARY KEY (tokenHash)
+);
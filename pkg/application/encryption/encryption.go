@@ -0,0 +1,114 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+)
+
+// ErrUnknownKey is returned when a value was encrypted with a key that is not configured
+var ErrUnknownKey = errors.New("unknown encryption key id")
+
+// Keyring encrypts values with the active key and decrypts them with the key they were encrypted
+// with, so the active key can be rotated without losing the values stored before
+type Keyring struct {
+	// KeyId is the id of the key that new values are encrypted with. Every other key in the
+	// keyring is only used to decrypt values that were encrypted before the key was rotated.
+	KeyId	string
+
+	// keys are the AES-GCM ciphers of every configured key, by key id
+	keys	map[string]cipher.AEAD
+}
+
+// Get will return the keyring described by the application config. Each configured key is base64
+// encoded and 16, 24, or 32 bytes long. If the active key is missing, an error is returned since
+// tokens can't be stored without it.
+func Get(config config.Config) (*Keyring, error) {
+	encryptionConfig := config.Encryption
+
+	keys := make(map[string][]byte)
+	for id, encoded := range encryptionConfig.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q is not base64 encoded: %v", id, err)
+		}
+
+		keys[id] = key
+	}
+
+	return New(encryptionConfig.KeyId, keys)
+}
+
+// New creates a keyring with the given keys that encrypts values with the key of the given id
+func New(keyId string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[keyId]; !ok {
+		return nil, fmt.Errorf("encryption key %q is not configured", keyId)
+	}
+
+	k := &Keyring { KeyId: keyId, keys: make(map[string]cipher.AEAD) }
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %v", id, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		k.keys[id] = aead
+	}
+
+	return k, nil
+}
+
+// Encrypt seals the plaintext with the active key and returns it base64 encoded, along with the id
+// of the key that was used, which has to be stored with the value to decrypt it later. The context
+// is authenticated but not encrypted, so the value can only be decrypted with the same context
+// (e.g. the id of the row it belongs to) and can't be moved to another row.
+func (k *Keyring) Encrypt(plaintext, context string) (string, string, error) {
+	aead := k.keys[k.KeyId]
+
+	// every value gets a random nonce, which is stored in front of the sealed value
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(context))
+	return base64.StdEncoding.EncodeToString(sealed), k.KeyId, nil
+}
+
+// Decrypt opens a value returned by Encrypt with the key of the given id. If the key is not in the
+// keyring ErrUnknownKey is returned, and if the value or its context were modified the returned
+// error will describe the authentication failure.
+func (k *Keyring) Decrypt(ciphertext, keyId, context string) (string, error) {
+	aead, ok := k.keys[keyId]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, []byte(context))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
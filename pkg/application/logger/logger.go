@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Level is how important a log entry is. Entries below the level of the logger are dropped.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+// levels maps every level to the name it is configured and written with
+var levels = map[Level]string {
+	Debug:	"debug",
+	Info:	"info",
+	Warn:	"warn",
+	Error:	"error",
+}
+
+// String returns the name of the level
+func (l Level) String() string {
+	return levels[l]
+}
+
+// ParseLevel returns the level with the given name, which is debug, info, warn, or error
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levels {
+		if levelName == name {
+			return level, nil
+		}
+	}
+
+	return Info, fmt.Errorf("unknown log level %q", name)
+}
+
+// Logger writes every entry as a single line of JSON with the time, level, message, and fields
+// of the entry. Loggers created with With share the output of the logger they were created from.
+type Logger struct {
+	out		io.Writer
+	mutex	*sync.Mutex
+	level	Level
+
+	// fields are written with every entry of the logger
+	fields	[]interface{}
+}
+
+// Default is the logger used when no other logger is available, such as for requests that did
+// not go through the logging middleware
+var Default = New(os.Stderr, Info)
+
+// New creates a logger that writes the entries of the given level and above to out
+func New(out io.Writer, level Level) *Logger {
+	return &Logger { out: out, mutex: &sync.Mutex{}, level: level }
+}
+
+// With returns a logger that writes the given fields with every entry, on top of the fields of
+// this logger. Fields are given as alternating keys and values.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields) + len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+
+	return &Logger { out: l.out, mutex: l.mutex, level: l.level, fields: fields }
+}
+
+// Debug writes an entry useful to debug the application, with the given keys and values
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(Debug, msg, keyvals)
+}
+
+// Info writes an entry about the normal operation of the application
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(Info, msg, keyvals)
+}
+
+// Warn writes an entry about a problem the application recovered from
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(Warn, msg, keyvals)
+}
+
+// Error writes an entry about a failure
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(Error, msg, keyvals)
+}
+
+// log writes the entry if its level is enabled. Errors are written as their message, and a key
+// without a value is written with a null value.
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	entry := map[string]interface{} {
+		"time":		time.Now().UTC().Format(time.RFC3339Nano),
+		"level":	level.String(),
+		"msg":		msg,
+	}
+
+	fields := append(append([]interface{}{}, l.fields...), keyvals...)
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+
+		var value interface{}
+		if i + 1 < len(fields) {
+			value = fields[i + 1]
+		}
+
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		entry[key] = value
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{} {
+			"time":		entry["time"],
+			"level":	level.String(),
+			"msg":		msg,
+			"logError":	err.Error(),
+		})
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+// contextKey is the key the logger of a request is stored with in its context
+type contextKey struct{}
+
+// NewContext returns a copy of the context that carries the logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by the context, or the fallback if there is none
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+
+	return fallback
+}
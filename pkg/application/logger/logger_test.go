@@ -0,0 +1,56 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	log := logger.New(&out, logger.Info).With("requestId", "abc")
+
+	log.Debug("Dropped")
+	log.Error("Failed to sync", "itemId", "item", "error", errors.New("timeout"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatal("Expected the debug entry to be dropped, got", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal("The entry is not JSON:", err)
+	}
+
+	expected := map[string]interface{}{
+		"level":     "error",
+		"msg":       "Failed to sync",
+		"requestId": "abc",
+		"itemId":    "item",
+		"error":     "timeout",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %v to be %v, got %v", key, value, entry[key])
+		}
+	}
+
+	if _, ok := entry["time"]; !ok {
+		t.Error("The entry has no time")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := logger.ParseLevel("warn"); err != nil || level != logger.Warn {
+		t.Error("Failed to parse warn:", level, err)
+	}
+
+	if _, err := logger.ParseLevel("verbose"); err == nil {
+		t.Error("Unknown levels should not be parsed")
+	}
+}
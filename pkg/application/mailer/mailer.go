@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+)
+
+// Message is a plain text email
+type Message struct {
+	To		string
+	Subject	string
+	Body	string
+}
+
+// Mailer sends emails to users, such as the links they reset their password with
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Get will return the mailer described by the application config, which sends emails over SMTP,
+// writes them to files, or only logs them
+func Get(config config.Config, log *logger.Logger) (Mailer, error) {
+	mailConfig := config.Mail
+
+	switch mailConfig.Driver {
+	case "smtp":
+		return &SMTP {
+			Addr:		net.JoinHostPort(mailConfig.SMTPHost, strconv.Itoa(mailConfig.SMTPPort)),
+			Host:		mailConfig.SMTPHost,
+			Username:	mailConfig.SMTPUsername,
+			Password:	mailConfig.SMTPPassword,
+			From:		mailConfig.From,
+		}, nil
+	case "file":
+		return &File { Dir: mailConfig.Dir, From: mailConfig.From }, nil
+	case "log":
+		return &Log { Log: log }, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", mailConfig.Driver)
+	}
+}
+
+// SMTP sends emails through an SMTP server, using STARTTLS when the server supports it
+type SMTP struct {
+	Addr		string	// host:port of the server
+	Host		string	// host the server's certificate is checked against
+	Username	string	// no authentication is used if empty
+	Password	string
+	From		string	// sender of every email, e.g. Scale <no-reply@example.com>
+}
+
+// Send sends the message to its recipient
+func (s *SMTP) Send(message Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	data, err := format(s.From, message)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if len(s.Username) > 0 {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, data)
+}
+
+// File writes every email to its own .eml file in a directory, for local development
+type File struct {
+	Dir		string
+	From	string
+}
+
+// Send writes the message to a new file named after the time it was sent
+func (f *File) Send(message Message) error {
+	data, err := format(f.From, message)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+	return ioutil.WriteFile(filepath.Join(f.Dir, name), data, 0600)
+}
+
+// Log only logs the emails, for local development. The body is logged at the debug level since
+// it can contain secrets such as reset tokens.
+type Log struct {
+	Log	*logger.Logger
+}
+
+// Send logs the message
+func (l *Log) Send(message Message) error {
+	l.Log.Info("Sending email", "to", message.To, "subject", message.Subject)
+	l.Log.Debug("Email body", "to", message.To, "body", message.Body)
+	return nil
+}
+
+// format formats the message as an email sent from the given address. Headers can't contain
+// line breaks, so that no other header can be added through them.
+func format(from string, message Message) ([]byte, error) {
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errors.New("email headers can't contain line breaks")
+		}
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "From: %s\r\n", from)
+	fmt.Fprintf(&builder, "To: %s\r\n", message.To)
+	fmt.Fprintf(&builder, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&builder, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return []byte(builder.String()), nil
+}
@@ -0,0 +1,41 @@
+package mailer_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elopez00/scale-backend/pkg/application/mailer"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := &mailer.File{Dir: dir, From: "Scale <no-reply@example.com>"}
+	message := mailer.Message{To: "smarsh@southpark.com", Subject: "Reset your password", Body: "first line\nsecond line"}
+	if err := files.Send(message); err != nil {
+		t.Fatal("Failed to write the email:", err)
+	}
+
+	written, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(written) != 1 {
+		t.Fatal("Expected one email file, got", written)
+	}
+
+	data, _ := ioutil.ReadFile(written[0])
+	for _, expected := range []string{"From: Scale <no-reply@example.com>\r\n", "To: smarsh@southpark.com\r\n", "Subject: Reset your password\r\n", "first line\r\nsecond line"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("The email does not contain %q:\n%s", expected, data)
+		}
+	}
+
+	// headers can't be injected through the recipient or subject
+	message.Subject = "Hello\r\nBcc: someone@example.com"
+	if err := files.Send(message); err == nil {
+		t.Error("Expected headers with line breaks to be rejected")
+	}
+}
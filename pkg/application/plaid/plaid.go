@@ -1,36 +1,85 @@
 package plaid
 
 import (
-	"github.com/elopez00/scale-backend/pkg/application/config"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
 
 	"github.com/plaid/plaid-go/plaid"
 )
 
+// Client is every operation of the plaid api used by the application. It is implemented by the
+// plaid-go client, and can be pointed at a fake plaid server for testing.
+type Client interface {
+	CreateLinkToken(configs plaid.LinkTokenConfigs) (plaid.CreateLinkTokenResponse, error)
+	ExchangePublicToken(publicToken string) (plaid.ExchangePublicTokenResponse, error)
+	GetItem(accessToken string) (plaid.GetItemResponse, error)
+	RemoveItem(accessToken string) (plaid.RemoveItemResponse, error)
+	GetInstitutionByID(id string, countryCodes []string) (plaid.GetInstitutionByIDResponse, error)
+	GetInstitutionByIDWithOptions(id string, countryCodes []string, options plaid.GetInstitutionByIDOptions) (plaid.GetInstitutionByIDResponse, error)
+	GetTransactionsWithOptions(accessToken string, options plaid.GetTransactionsOptions) (plaid.GetTransactionsResponse, error)
+	GetLiabilities(accessToken string) (plaid.GetLiabilitiesResponse, error)
+	GetAccounts(accessToken string) (plaid.GetAccountsResponse, error)
+	GetWebhookVerificationKey(keyID string) (plaid.GetWebhookVerificationKeyResponse, error)
+}
+
+// the plaid-go client must always implement every operation the application uses
+var _ Client = (*plaid.Client)(nil)
+
 type Plaid struct {
-	// Client is the object that contains all database functionalities
-	Client			*plaid.Client
+	// Client is the object that contains all plaid functionalities
+	Client			Client
 
-	// RedirectURL is necessary for something, I'll figure it out
-	RedirectURL		string
+	// WebhookKey returns the public key used to verify webhooks signed with the given key id.
+	// By default the key is retrieved from plaid, but it can be replaced for testing.
+	WebhookKey		func(kid string) (*ecdsa.PublicKey, error)
+
+	// Ping checks that plaid can be reached. By default it sends a request to the host of the
+	// configured plaid environment, but it can be replaced for testing.
+	Ping			func(ctx context.Context) error
+
+	// keys caches the webhook verification keys retrieved from plaid
+	keys			map[string]*ecdsa.PublicKey
+	mutex			sync.Mutex
+}
+
+// environments maps the configured plaid environment to the host of the plaid api
+var environments = map[string]plaid.Environment {
+	"sandbox":		plaid.Sandbox,
+	"development":	plaid.Development,
+	"production":	plaid.Production,
 }
 
 // Get will return a Plaid client given application config
 func Get(config config.Config) (*Plaid, error) {
-	plaidConfig := config.GetPlaid()
+	plaidConfig := config.Plaid
+
+	// if the client id is test, we return a nil Plaid client for test purposes
+	if plaidConfig.ClientId == "test" {
+		p := newPlaid(nil)
+		p.Ping = func(ctx context.Context) error {
+			return errors.New("plaid client is not configured")
+		}
+		return p, nil
+	}
 
-	// if the client id is test, we return a nil Plaid client with a valid redirect uri
-	// for test purposes
-	if plaidConfig["client"] == "test" {
-		return &Plaid { Client: nil, RedirectURL: plaidConfig["redirectUri"] }, nil
+	environment, ok := environments[plaidConfig.Environment]
+	if !ok {
+		return nil, fmt.Errorf("unknown plaid environment %q", plaidConfig.Environment)
 	}
 
 	// else we establish plaid options
+	httpClient := &http.Client{}
 	clientOptions := plaid.ClientOptions {
-		ClientID: 		plaidConfig["client"],
-		Secret: 		plaidConfig["secret"],
-		Environment:	plaid.Sandbox,
-		HTTPClient:		&http.Client{},
+		ClientID: 		plaidConfig.ClientId,
+		Secret: 		plaidConfig.Secret,
+		Environment:	environment,
+		HTTPClient:		httpClient,
 	}
 
 	// and instantiate a new client
@@ -39,5 +88,31 @@ func Get(config config.Config) (*Plaid, error) {
 		return nil, err
 	}
 
-	return &Plaid { Client: client, RedirectURL: plaidConfig["redirectURL"] }, nil
-}
\ No newline at end of file
+	p := newPlaid(client)
+	p.Ping = func(ctx context.Context) error {
+		return ping(ctx, httpClient, string(environment))
+	}
+	return p, nil
+}
+
+// newPlaid creates the Plaid object with webhook keys retrieved from plaid
+func newPlaid(client Client) *Plaid {
+	p := &Plaid { Client: client, keys: make(map[string]*ecdsa.PublicKey) }
+	p.WebhookKey = p.getWebhookKey
+	return p
+}
+// ping sends a request to the plaid host. Any response means plaid can be reached, since only
+// the connection is checked and not the credentials.
+func ping(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
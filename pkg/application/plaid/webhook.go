@@ -0,0 +1,108 @@
+package plaid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// webhookMaxAge is how old a webhook can be before it is rejected, which limits replays
+const webhookMaxAge = 5 * time.Minute
+
+// VerifyWebhook verifies the Plaid-Verification header sent along with a webhook. The header is
+// a JWT signed by plaid with ES256 that contains the SHA-256 hash of the body it was sent with.
+// If the signature is invalid, the token is too old, or the hash does not match the body, an
+// error describing the problem is returned.
+func (p *Plaid) VerifyWebhook(header string, body []byte) error {
+	if len(header) == 0 {
+		return errors.New("missing webhook verification header")
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(header, claims, func(token *jwt.Token) (interface{}, error) {
+		// plaid only signs webhooks with ES256, anything else is forged
+		if token.Method != jwt.SigningMethodES256 {
+			return nil, errors.New("unexpected webhook signing method")
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.WebhookKey(kid)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !token.Valid {
+		return errors.New("webhook token invalid")
+	}
+
+	// reject webhooks that were signed too long ago
+	issued, ok := claims["iat"].(float64)
+	if !ok || time.Since(time.Unix(int64(issued), 0)) > webhookMaxAge {
+		return errors.New("webhook token expired")
+	}
+
+	// compare the hash of the body with the one that was signed
+	expected, _ := claims["request_body_sha256"].(string)
+	hash := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hash[:])), []byte(expected)) != 1 {
+		return errors.New("webhook body does not match signature")
+	}
+
+	return nil
+}
+
+// getWebhookKey retrieves the public key plaid signed webhooks with given the key id. Keys
+// are cached since they rarely change, and expired keys will not be used.
+func (p *Plaid) getWebhookKey(kid string) (*ecdsa.PublicKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	if p.Client == nil {
+		return nil, errors.New("plaid client unavailable")
+	}
+
+	res, err := p.Client.GetWebhookVerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Key.ExpiredAt != 0 && res.Key.ExpiredAt <= time.Now().Unix() {
+		return nil, errors.New("webhook verification key expired")
+	}
+
+	if res.Key.Kty != "EC" || res.Key.Crv != "P-256" {
+		return nil, errors.New("unsupported webhook verification key")
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(res.Key.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(res.Key.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	p.keys[kid] = key
+	return key, nil
+}
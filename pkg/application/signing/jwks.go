@@ -0,0 +1,62 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JWKS is a JSON Web Key Set, which lets other services verify access tokens on their own
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is the public key of an asymmetric signing key
+type JWK struct {
+	Kty string `json:"kty"`           // RSA or OKP
+	Kid string `json:"kid"`           // id of the key, the kid header of the tokens it signed
+	Use string `json:"use"`           // always sig
+	Alg string `json:"alg"`           // RS256 or EdDSA
+	N   string `json:"n,omitempty"`   // modulus of RSA keys
+	E   string `json:"e,omitempty"`   // exponent of RSA keys
+	Crv string `json:"crv,omitempty"` // curve of OKP keys, always Ed25519
+	X   string `json:"x,omitempty"`   // public key of OKP keys
+}
+
+// JWKS returns the public keys of every asymmetric key in the keyring. HMAC keys are secret, so
+// they are never published.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0)}
+	for id, key := range k.keys {
+		jwk := JWK{Kid: id, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encode(public.N.Bytes())
+			jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encode(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	// keys are listed in the same order every time
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+// encode encodes the bytes as unpadded base64url, as JSON Web Keys are
+func encode(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
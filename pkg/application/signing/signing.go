@@ -0,0 +1,188 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// defaultKeyId is the id of the KEY secret
+const defaultKeyId = config.DefaultJWTKeyId
+
+// ErrUnknownKey is returned when a token was signed with a key that is not configured
+var ErrUnknownKey = errors.New("unknown signing key id")
+
+// validMethods are the only algorithms tokens can be signed with. Tokens signed with any other
+// algorithm, such as none, are rejected before their key is looked up.
+var validMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	SigningMethodEdDSA.Alg(),
+}
+
+// Key is a key access tokens are signed and verified with
+type Key struct {
+	// Method is the algorithm of the key, tokens that claim another algorithm are rejected
+	Method	jwt.SigningMethod
+
+	// Private signs tokens and Public verifies them, they are the same secret for HMAC keys
+	Private	interface{}
+	Public	interface{}
+}
+
+// HMACKey returns an HS256 key with the given secret
+func HMACKey(secret []byte) Key {
+	return Key { Method: jwt.SigningMethodHS256, Private: secret, Public: secret }
+}
+
+// PrivateKey returns the key of the given PEM encoded RSA or Ed25519 private key. RSA keys sign
+// tokens with RS256 and Ed25519 keys with EdDSA.
+func PrivateKey(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM encoded key found")
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return Key{}, err
+		}
+	}
+
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		return Key { Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey }, nil
+	case ed25519.PrivateKey:
+		return Key { Method: SigningMethodEdDSA, Private: private, Public: private.Public() }, nil
+	default:
+		return Key{}, fmt.Errorf("unsupported private key type %T", private)
+	}
+}
+
+type Keyring struct {
+	// KeyId is the id of the key that new tokens are signed with. Every other key in the keyring
+	// is only used to verify tokens that were signed before the key was rotated.
+	KeyId		string
+
+	// Issuer and Audience are the iss and aud claims of new tokens, tokens with other claims
+	// are rejected
+	Issuer		string
+	Audience	string
+
+	// keys are every configured key, by key id
+	keys		map[string]Key
+}
+
+// Get will return the keyring described by the application config. The KEY secret is the key
+// with the default id, and private keys are read from their files. If the active key is missing,
+// an error is returned since tokens can't be signed without it.
+func Get(config config.Config) (*Keyring, error) {
+	jwtConfig := config.JWT
+
+	keys := make(map[string]Key)
+	if secret, err := config.SigningKey(); err == nil {
+		keys[defaultKeyId] = HMACKey(secret)
+	}
+
+	for id, secret := range jwtConfig.Keys {
+		keys[id] = HMACKey([]byte(secret))
+	}
+
+	for id, file := range jwtConfig.PrivateKeyFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %v", id, err)
+		}
+
+		key, err := PrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %v", id, err)
+		}
+		keys[id] = key
+	}
+
+	return New(jwtConfig.KeyId, keys, jwtConfig.Issuer, jwtConfig.Audience)
+}
+
+// New creates a keyring with the given keys that signs tokens with the key of the given id
+func New(keyId string, keys map[string]Key, issuer, audience string) (*Keyring, error) {
+	if _, ok := keys[keyId]; !ok {
+		return nil, fmt.Errorf("signing key %q is not configured", keyId)
+	}
+
+	return &Keyring { KeyId: keyId, Issuer: issuer, Audience: audience, keys: keys }, nil
+}
+
+// Sign creates an access token for the session of the user that expires after the given
+// duration. The user is the sub claim and the session the jti claim, and the id of the key the
+// token was signed with is the kid header.
+func (k *Keyring) Sign(userId, sessionId string, duration time.Duration) (string, error) {
+	key := k.keys[k.KeyId]
+	now := time.Now()
+
+	token := jwt.NewWithClaims(key.Method, jwt.StandardClaims{
+		Subject:   userId,
+		Id:        sessionId,
+		Issuer:    k.Issuer,
+		Audience:  k.Audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(duration).Unix(),
+	})
+	token.Header["kid"] = k.KeyId
+
+	return token.SignedString(key.Private)
+}
+
+// Verify checks the signature of the access token with the key of its kid header, using the
+// algorithm of that key only, and that the token is in its validity period and was issued by
+// and for this api. The claims of the token are returned if it is valid.
+func (k *Keyring) Verify(value string) (*jwt.StandardClaims, error) {
+	parser := jwt.Parser{ValidMethods: validMethods}
+	claims := &jwt.StandardClaims{}
+
+	token, err := parser.ParseWithClaims(value, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("signing key %q does not use %v", kid, token.Method.Alg())
+		}
+
+		return key.Public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("token invalid")
+	}
+
+	if claims.Issuer != k.Issuer || !claims.VerifyAudience(k.Audience, true) {
+		return nil, errors.New("token was not issued by or for this api")
+	}
+
+	if claims.IssuedAt == 0 || claims.ExpiresAt == 0 {
+		return nil, errors.New("token missing issue or expiration time")
+	}
+
+	if len(claims.Subject) == 0 || len(claims.Id) == 0 {
+		return nil, errors.New("token missing user or session")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,160 @@
+package signing_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/signing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// secret is an HMAC secret long enough to sign tokens with
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// newKeyring creates a keyring that signs tokens with the key of the given id
+func newKeyring(t *testing.T, keyId string, keys map[string]signing.Key) *signing.Keyring {
+	keyring, err := signing.New(keyId, keys, "scale", "scale-api")
+	if err != nil {
+		t.Fatal("Failed to create the keyring:", err)
+	}
+
+	return keyring
+}
+
+// pemKey encodes the private key the way it is stored in key files
+func pemKey(t *testing.T, private interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal("Failed to encode the key:", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	keyring := newKeyring(t, "current", map[string]signing.Key{"current": signing.HMACKey(secret)})
+
+	token, err := keyring.Sign("user", "session", time.Minute)
+	if err != nil {
+		t.Fatal("Failed to sign:", err)
+	}
+
+	claims, err := keyring.Verify(token)
+	if err != nil {
+		t.Fatal("Failed to verify:", err)
+	}
+
+	if claims.Subject != "user" || claims.Id != "session" || claims.Issuer != "scale" || claims.Audience != "scale-api" {
+		t.Error("Unexpected claims:", claims)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := newKeyring(t, "old", map[string]signing.Key{"old": signing.HMACKey(secret)})
+	token, _ := old.Sign("user", "session", time.Minute)
+
+	// tokens signed with the old key stay valid while it is still configured
+	rotated := newKeyring(t, "new", map[string]signing.Key{
+		"old": signing.HMACKey(secret),
+		"new": signing.HMACKey([]byte("fedcba9876543210fedcba9876543210")),
+	})
+	if _, err := rotated.Verify(token); err != nil {
+		t.Error("A token signed with the previous key was rejected:", err)
+	}
+
+	removed := newKeyring(t, "new", map[string]signing.Key{"new": signing.HMACKey(secret)})
+	if _, err := removed.Verify(token); err == nil {
+		t.Error("A token signed with a removed key was accepted")
+	}
+}
+
+func TestVerifyRejectsForgedTokens(t *testing.T) {
+	private, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := signing.PrivateKey(pemKey(t, private))
+	keyring := newKeyring(t, "rsa", map[string]signing.Key{"rsa": key})
+
+	now := time.Now()
+	valid := jwt.StandardClaims{
+		Subject:   "user",
+		Id:        "session",
+		Issuer:    "scale",
+		Audience:  "scale-api",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+
+	sign := func(method jwt.SigningMethod, claims jwt.StandardClaims, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = "rsa"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal("Failed to sign:", err)
+		}
+		return signed
+	}
+
+	publicKey, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	otherAudience, noSubject := valid, valid
+	otherAudience.Audience = "another-service"
+	noSubject.Subject = ""
+
+	forged := map[string]string{
+		"an HMAC signed with the public key": sign(jwt.SigningMethodHS256, valid, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		"an unsigned token":                  sign(jwt.SigningMethodNone, valid, jwt.UnsafeAllowNoneSignatureType),
+		"another audience":                   sign(jwt.SigningMethodRS256, otherAudience, private),
+		"a token without a user":             sign(jwt.SigningMethodRS256, noSubject, private),
+	}
+
+	for name, token := range forged {
+		if _, err := keyring.Verify(token); err == nil {
+			t.Errorf("Expected %v to be rejected", name)
+		}
+	}
+
+	if _, err := keyring.Verify(sign(jwt.SigningMethodRS256, valid, private)); err != nil {
+		t.Error("The valid token was rejected:", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	rsaKey, err := signing.PrivateKey(pemKey(t, rsaPrivate))
+	if err != nil {
+		t.Fatal("Failed to read the RSA key:", err)
+	}
+
+	edKey, err := signing.PrivateKey(pemKey(t, edPrivate))
+	if err != nil {
+		t.Fatal("Failed to read the Ed25519 key:", err)
+	}
+
+	keyring := newKeyring(t, "ed", map[string]signing.Key{
+		"ed":     edKey,
+		"rsa":    rsaKey,
+		"secret": signing.HMACKey(secret),
+	})
+
+	// tokens signed with EdDSA are verified too
+	token, _ := keyring.Sign("user", "session", time.Minute)
+	if _, err := keyring.Verify(token); err != nil {
+		t.Error("The EdDSA token was rejected:", err)
+	}
+
+	// only the public keys are published
+	keys := keyring.JWKS().Keys
+	if len(keys) != 2 || keys[0].Kid != "ed" || keys[0].Alg != "EdDSA" || keys[1].Kid != "rsa" || keys[1].Alg != "RS256" {
+		t.Fatal("Unexpected keys:", keys)
+	}
+
+	if len(keys[0].X) == 0 || len(keys[1].N) == 0 || keys[1].E != "AQAB" {
+		t.Error("The public keys are incomplete:", keys)
+	}
+}
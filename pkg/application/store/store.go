@@ -0,0 +1,204 @@
+package store
+
+import (
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// UserStore is in charge of storing the users that onboard to the app
+type UserStore interface {
+	// Create stores the user, whose password has to be hashed already
+	Create(user *User) error
+
+	// Exists checks whether a user with the email is already stored. Errors yield false.
+	Exists(email string) bool
+
+	// GetCredentials returns the email, password hash, and id of the user with the email
+	GetCredentials(email string) (User, error)
+
+	// SetPassword replaces the password hash of the user. If the user does not exist the error
+	// will be sql.ErrNoRows.
+	SetPassword(userId, password string) error
+
+	// Get returns the user with the id, without their password. If the user does not exist the
+	// error will be sql.ErrNoRows.
+	Get(userId string) (User, error)
+
+	// SetVerified marks the email of the user as verified. If the user does not exist the error
+	// will be sql.ErrNoRows.
+	SetVerified(userId string) error
+}
+
+// TokenStore is in charge of storing the plaid items linked by each user. Implementations are
+// responsible for protecting the access tokens, which give full read access to bank data.
+type TokenStore interface {
+	// Add stores a newly linked item of the user
+	Add(userId string, token *Token) error
+
+	// Update replaces the access token of an item of the user
+	Update(userId string, token *Token) error
+
+	// List returns every item linked by the user
+	List(userId string) ([]*Token, error)
+
+	// Get fills the token with the stored item of the user that has the same id as the token.
+	// If the item does not exist the error will be sql.ErrNoRows.
+	Get(userId string, token *Token) error
+
+	// GetByItem fills the token with the stored item that has the same id as the token, and
+	// returns the id of the user that owns it
+	GetByItem(token *Token) (string, error)
+
+	// Delete removes the item of the user along with every transaction stored for it
+	Delete(userId string, token *Token) error
+
+	// SetStatus records the state of the item, an empty status means the item works correctly
+	SetStatus(itemId, status string) error
+
+	// SetCursor records the date up to which the transactions of the item were synced
+	SetCursor(itemId, cursor string) error
+}
+
+// BudgetStore is in charge of storing the categories and whitelists that make up each budget
+type BudgetStore interface {
+	// Get returns the budget of the user
+	Get(userId string) (Budget, error)
+
+	// Update applies the changes and removals of the budget's request
+	Update(userId string, budget *Budget) error
+}
+
+// SessionStore is in charge of storing the sessions of every user
+type SessionStore interface {
+	// Create stores a new session
+	Create(session *Session) error
+
+	// Get fills the session with the stored session that has the same id. If the session does
+	// not exist the error will be sql.ErrNoRows.
+	Get(session *Session) error
+
+	// Rotate replaces the refresh token hash of the session only if the stored hash is still the
+	// one the session was read with, otherwise ErrSessionRotated is returned
+	Rotate(session *Session, refresh string, expires int64) error
+
+	// Revoke marks the session as logged out
+	Revoke(session *Session) error
+
+	// RevokeAll revokes every session of the user
+	RevokeAll(userId string) error
+
+	// IsActive checks that the session of the user exists and was not revoked or expired
+	IsActive(id, userId string) (bool, error)
+}
+
+// PasswordResetStore is in charge of storing the reset tokens users choose new passwords with
+type PasswordResetStore interface {
+	// Create stores a new password reset
+	Create(reset *PasswordReset) error
+
+	// Consume uses the unused and unexpired reset token with the hash, along with every other
+	// token of its user, and returns the id of the user. Otherwise ErrInvalidResetToken is returned.
+	Consume(tokenHash string) (string, error)
+
+	// CreateLimited stores a new password reset unless the user requested as many resets as one
+	// of the limits allows within its window before the reset was created, in which case
+	// ErrTooManyResets is returned. Concurrent requests of the same user can't both pass a limit.
+	CreateLimited(reset *PasswordReset, limits ...ResetLimit) error
+}
+
+// EmailVerificationStore is in charge of storing the tokens users verify their email with
+type EmailVerificationStore interface {
+	// Create stores a new email verification
+	Create(verification *EmailVerification) error
+
+	// Consume uses the unused and unexpired verification token with the hash, along with every
+	// other token of its user, and returns the id of the user. Otherwise
+	// ErrInvalidVerificationToken is returned.
+	Consume(tokenHash string) (string, error)
+
+	// CountSince returns how many verifications were sent to the user since the unix time
+	CountSince(userId string, since int64) (int, error)
+}
+
+// TwoFactorStore is in charge of storing the TOTP secrets and recovery codes of users. Secrets are
+// encrypted at rest by the SQL implementation.
+type TwoFactorStore interface {
+	// Get returns the TOTP secret of the user. If the user has none the error will be
+	// sql.ErrNoRows.
+	Get(userId string) (TwoFactor, error)
+
+	// Enroll stores a new secret that is not enabled yet, replacing any other secret of the user
+	// that was not enabled
+	Enroll(twoFactor *TwoFactor) error
+
+	// Enable enables the enrolled secret with the code of the time step and replaces the recovery
+	// codes of the user. If there is no enrolled secret the error will be sql.ErrNoRows.
+	Enable(userId string, step int64, codeHashes []string) error
+
+	// UseStep records the time step of a code that was used, or returns ErrCodeUsed if a code of
+	// the same or a later step was already used
+	UseStep(userId string, step int64) error
+
+	// UseRecoveryCode uses the unused recovery code with the hash, or returns
+	// ErrInvalidRecoveryCode
+	UseRecoveryCode(userId, codeHash string) error
+
+	// ReplaceRecoveryCodes replaces every recovery code of the user
+	ReplaceRecoveryCodes(userId string, codeHashes []string) error
+
+	// Disable removes the secret and recovery codes of the user
+	Disable(userId string) error
+
+	// AddAttempt records that the user tried a code at the unix time
+	AddAttempt(userId string, at int64) error
+
+	// CountAttempts returns how many codes the user tried since the given unix time
+	CountAttempts(userId string, since int64) (int, error)
+
+	// ClearAttempts removes the attempts of the user once they logged in
+	ClearAttempts(userId string) error
+}
+
+// LoginChallengeStore is in charge of storing the challenges of logins that need a TOTP code
+type LoginChallengeStore interface {
+	// Create stores a new login challenge
+	Create(challenge *LoginChallenge) error
+
+	// Attempt counts an attempt of the unexpired challenge with the hash and returns the id of its
+	// user, or returns ErrInvalidChallenge once it was attempted maxAttempts times
+	Attempt(tokenHash string, maxAttempts int) (string, error)
+
+	// Complete removes the challenge, or returns ErrInvalidChallenge if it was already completed
+	Complete(tokenHash string) error
+}
+
+// TransactionStore is in charge of storing the transactions synced from plaid
+type TransactionStore interface {
+	// Save stores the transactions of the item, replacing the ones that were already stored
+	Save(userId, itemId string, transactions []plaid.Transaction) error
+
+	// Remove deletes the transactions of the item with the given ids
+	Remove(itemId string, ids []string) error
+
+	// Ids returns the ids of the transactions of the item between the dates (inclusive)
+	Ids(itemId, startDate, endDate string) ([]string, error)
+
+	// List returns every transaction of the user between the dates (inclusive), most recent first
+	List(userId, startDate, endDate string) ([]plaid.Transaction, error)
+
+	// Find returns a page of the transactions of the user that match the filter
+	Find(userId string, filter TransactionFilter) (TransactionPage, error)
+}
+
+// Stores groups every store the api depends on, so that handlers don't depend on how or where
+// the data is stored
+type Stores struct {
+	Users         UserStore
+	Tokens        TokenStore
+	Budgets       BudgetStore
+	Sessions      SessionStore
+	Transactions  TransactionStore
+	Resets        PasswordResetStore
+	Verifications EmailVerificationStore
+	TwoFactor     TwoFactorStore
+	Challenges    LoginChallengeStore
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// User struct will be used to get any information regarding the user information.
+// The id in this case scenario is a primary key and will be used to retrieve other tables
+// linked to the User.
+type User struct {
+	Id        string `json:"id,omitempty"`
+	FirstName string `json:"firstname,omitempty"`
+	LastName  string `json:"lastname,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Password  string `json:"password,omitempty"`
+	Verified  bool   `json:"verified"` // whether the user proved they own the email, never set by clients
+}
+
+// Token for use of plaid public token retrieval
+type Token struct {
+	Value         string `json:"value"`
+	Id            string `json:"id"`
+	Institution   string `json:"name"`
+	InstitutionId string `json:"-"` // plaid id of the institution
+	Status        string `json:"-"` // plaid error or webhook code when the item needs attention
+	Cursor        string `json:"-"` // date up to which transactions were synced
+	LastSync      int64  `json:"-"` // unix time of the last successful transaction sync
+}
+
+// Session describes a single login of a user on a device. Access tokens handed to the user
+// reference the session they were issued for, so revoking the session invalidates every
+// access token that belongs to it. The refresh token is only stored as a hash.
+type Session struct {
+	Id      string // session id, also used as the jti of access tokens
+	UserId  string // id of the user that owns the session
+	Refresh string // hash of the current refresh token
+	Expires int64  // unix time at which the refresh token expires
+	Revoked bool   // whether the session was logged out
+}
+
+// ErrSessionRotated is returned when a refresh token is rotated by another request before
+// the current one could do it
+var ErrSessionRotated = errors.New("session refresh token was already rotated")
+
+// WhiteListItem item for white listed companies of a specific category
+type WhiteListItem struct {
+	Category string `json:"category"` // id of category
+	Name     string `json:"name"`     // name of company being listed under this category
+	Id       string `json:"id"`       // item id
+}
+
+// Category within budget
+type Category struct {
+	Name      string          `json:"name"`                // name of category
+	Budget    float64         `json:"budget"`              // amount of money budgeted towards this category
+	Id        string          `json:"id"`                  // category id
+	WhiteList []WhiteListItem `json:"whitelist,omitempty"` // whitelist corresponding to category
+	Color     string          `json:"color"`
+	Spent     float64         `json:"spent"`     // amount of money spent in this category this period
+	Remaining float64         `json:"remaining"` // amount of money left in this category this period
+}
+
+// UpdateObject contains both category updates and whitelist updates. Neither one nor the
+// other are required.
+type UpdateObject struct {
+	Categories []Category      `json:"categories,omitempty"`
+	WhiteList  []WhiteListItem `json:"whitelist,omitempty"`
+}
+
+// UpdateRequest a struct that describes what will be updated in a budget
+type UpdateRequest struct {
+	Update UpdateObject `json:"change,omitempty"`
+	Remove UpdateObject `json:"remove,omitempty"`
+}
+
+// Budget is a combination of categories
+type Budget struct {
+	Categories []Category    `json:"categories,omitempty"`
+	Request    UpdateRequest `json:"request,omitempty"`
+}
+
+// PasswordReset is a request of the user to choose a new password. The reset token given to the
+// user is only stored as a hash, and can be used once before it expires.
+type PasswordReset struct {
+	TokenHash string // hash of the reset token
+	UserId    string // id of the user whose password is reset
+	Created   int64  // unix time at which the reset was requested
+	Expires   int64  // unix time at which the token expires
+	Used      bool   // whether the token was used, or another token of the user was
+}
+
+// ErrInvalidResetToken is returned when a reset token does not exist, expired, or was used
+var ErrInvalidResetToken = errors.New("the reset token is invalid, expired, or was already used")
+
+// ResetLimit is how many password resets a user can request within a window of time
+type ResetLimit struct {
+	Window time.Duration
+	Count  int
+}
+
+// ErrTooManyResets is returned when a password reset would go over one of the limits of its user
+var ErrTooManyResets = errors.New("too many password resets were requested")
+
+// EmailVerification is a token sent to the email of a user, which proves that the user owns the
+// email once they send it back. The token is only stored as a hash, and can be used once before
+// it expires.
+type EmailVerification struct {
+	TokenHash string // hash of the verification token
+	UserId    string // id of the user whose email is verified
+	Created   int64  // unix time at which the token was sent
+	Expires   int64  // unix time at which the token expires
+	Used      bool   // whether the token was used, or another token of the user was
+}
+
+// ErrInvalidVerificationToken is returned when a verification token does not exist, expired, or
+// was used
+var ErrInvalidVerificationToken = errors.New("the verification token is invalid, expired, or was already used")
+
+// TwoFactor is the TOTP secret of a user. The secret is enrolled first, and only protects logins
+// once the user proved their authenticator app has it by enabling it with a code.
+type TwoFactor struct {
+	UserId   string // id of the user the secret belongs to
+	Secret   string // base32 TOTP secret, encrypted at rest
+	Enabled  bool   // whether logins need a code
+	LastStep int64  // time step of the last accepted code, older and equal steps are rejected
+}
+
+// LoginChallenge is the second step of the login of a user with two factor authentication. The
+// challenge token is only stored as a hash, and can only be attempted a few times before it
+// expires.
+type LoginChallenge struct {
+	TokenHash string // hash of the challenge token
+	UserId    string // id of the user logging in
+	Expires   int64  // unix time at which the challenge expires
+	Attempts  int    // how many codes were tried with the challenge
+}
+
+var (
+	// ErrCodeUsed is returned when a TOTP code of a time step that was already used is used again
+	ErrCodeUsed = errors.New("the code was already used")
+
+	// ErrInvalidRecoveryCode is returned when a recovery code does not exist or was used
+	ErrInvalidRecoveryCode = errors.New("the recovery code is invalid or was already used")
+
+	// ErrInvalidChallenge is returned when a login challenge does not exist, expired, or was
+	// attempted too many times
+	ErrInvalidChallenge = errors.New("the login challenge is invalid, expired, or was attempted too many times")
+)
+
+// TransactionFilter describes which of the user's stored transactions should be returned. The
+// dates are required, every other field is optional and is ignored when left empty.
+type TransactionFilter struct {
+	StartDate  string   // earliest date of the transactions (inclusive)
+	EndDate    string   // latest date of the transactions (inclusive)
+	AccountIds []string // accounts the transactions must belong to
+	Category   string   // category the transactions must have at any level of their hierarchy
+	MinAmount  *float64 // smallest amount of the transactions
+	MaxAmount  *float64 // largest amount of the transactions
+	Limit      int      // most transactions that will be returned
+	Cursor     string   // cursor returned by the previous page
+}
+
+// TransactionPage is a single page of transactions. If there are more transactions after the
+// ones in the page, Next contains the cursor used to get them.
+type TransactionPage struct {
+	Transactions []plaid.Transaction `json:"transactions"`
+	Next         string              `json:"next,omitempty"`
+}
+
+// ErrInvalidCursor is returned when a transaction cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid transaction cursor")
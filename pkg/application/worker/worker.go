@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+)
+
+// ErrStopped is returned when a job is added after the worker was stopped
+var ErrStopped = errors.New("worker: stopped")
+
+// ErrQueueFull is returned when a job is added while the queue is full
+var ErrQueueFull = errors.New("worker: queue full")
+
+// Worker runs jobs in the background one at a time, so that slow work such as syncing an item
+// with plaid doesn't hold up the request that asked for it. Jobs are identified by a key, and a
+// job is not queued again while one with the same key is still waiting to run.
+type Worker struct {
+	log     *logger.Logger
+	jobs    chan job
+	done    chan struct{}
+	mutex   sync.Mutex
+	queued  map[string]bool
+	stopped bool
+}
+
+// job is a function queued under its key
+type job struct {
+	key string
+	run func() error
+}
+
+// New starts a worker that queues up to size jobs, and logs the jobs that fail to the logger
+func New(size int, log *logger.Logger) *Worker {
+	w := &Worker{
+		log:    log,
+		jobs:   make(chan job, size),
+		done:   make(chan struct{}),
+		queued: make(map[string]bool),
+	}
+
+	go w.work()
+	return w
+}
+
+// Add queues the function to run under the key. If a job with the same key is already waiting,
+// the function is not queued since the waiting job will do the same work, and nil is returned.
+// Once the job starts, another one with its key can be queued.
+func (w *Worker) Add(key string, run func() error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.stopped {
+		return ErrStopped
+	}
+
+	if w.queued[key] {
+		return nil
+	}
+
+	select {
+	case w.jobs <- job{key: key, run: run}:
+		w.queued[key] = true
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stop stops the worker from taking new jobs and waits for the jobs that were already queued to
+// finish, or until the context is done
+func (w *Worker) Stop(ctx context.Context) error {
+	w.mutex.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.jobs)
+	}
+	w.mutex.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work runs the queued jobs in order until the worker is stopped
+func (w *Worker) work() {
+	defer close(w.done)
+
+	for job := range w.jobs {
+		w.mutex.Lock()
+		delete(w.queued, job.key)
+		w.mutex.Unlock()
+
+		if err := job.run(); err != nil {
+			w.log.Error("Background job failed", "job", job.key, "error", err)
+		}
+	}
+}
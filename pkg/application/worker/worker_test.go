@@ -0,0 +1,86 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
+	"github.com/elopez00/scale-backend/pkg/application/worker"
+)
+
+func TestWorker(t *testing.T) {
+	w := worker.New(10, logger.New(ioutil.Discard, logger.Error))
+
+	// the first job blocks the worker so that the others wait in the queue
+	started := make(chan bool)
+	release := make(chan bool)
+	w.Add("block", func() error {
+		started <- true
+		<-release
+		return nil
+	})
+	<-started
+
+	runs := 0
+	for i := 0; i < 3; i++ {
+		if err := w.Add("item", func() error { runs++; return nil }); err != nil {
+			t.Fatal("Failed to add the job:", err)
+		}
+	}
+
+	failed := make(chan bool, 1)
+	w.Add("failing", func() error { failed <- true; return errors.New("timeout") })
+
+	close(release)
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("The queued jobs did not run")
+	}
+
+	// a job is only queued once while it waits
+	if runs != 1 {
+		t.Fatal("Expected the job to run once, ran", runs)
+	}
+
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal("Failed to stop the worker:", err)
+	}
+
+	if err := w.Add("item", func() error { return nil }); err != worker.ErrStopped {
+		t.Fatal("Jobs should not be added once the worker stopped, got", err)
+	}
+}
+
+func TestWorkerQueueFull(t *testing.T) {
+	w := worker.New(1, logger.New(ioutil.Discard, logger.Error))
+
+	started := make(chan bool)
+	release := make(chan bool)
+	w.Add("block", func() error {
+		started <- true
+		<-release
+		return nil
+	})
+	<-started
+
+	w.Add("first", func() error { return nil })
+	if err := w.Add("second", func() error { return nil }); err != worker.ErrQueueFull {
+		t.Fatal("Expected the queue to be full, got", err)
+	}
+
+	// the running job doesn't finish before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatal("Expected the stop to time out, got", err)
+	}
+
+	close(release)
+	if err := w.Stop(context.Background()); err != nil {
+		t.Fatal("Failed to stop the worker:", err)
+	}
+}
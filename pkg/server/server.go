@@ -1,22 +1,51 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application/logger"
 
-	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
 )
 
+// defaultShutdownTimeout is how long in-flight requests are given to finish when the server is
+// shut down, unless another deadline is given with WithShutdownTimeout
+const defaultShutdownTimeout = 30 * time.Second
+
 type Server struct {
 	srv	*http.Server
+
+	// handler serves the requests once they passed the CORS policy
+	handler	http.Handler
+
+	// cors is the CORS policy of the server
+	cors	cors.Options
+
+	// certificates serves the TLS certificate, if the server uses TLS
+	certificates	*certificates
+
+	// shutdownTimeout is how long in-flight requests are given to finish once shutdown starts
+	shutdownTimeout	time.Duration
+
+	// hooks are run in order once the server stopped serving requests
+	hooks	[]func(ctx context.Context) error
+
+	// log writes what happens while the server shuts down
+	log		*logger.Logger
 }
 
 // Get returns a server object
 func Get() *Server {
 	return &Server {
 		srv: &http.Server{},
+		shutdownTimeout: defaultShutdownTimeout,
+		log: logger.Default,
 	}
 }
 
@@ -26,23 +55,141 @@ func (s *Server) WithAddr(addr string) *Server {
 	return s
 }
 
-// WithHandler appends cors handler to server
-func (s *Server) WithHandler(router *httprouter.Router) *Server {
-	handler := cors.Default().Handler(router)
-	s.srv.Handler = handler
+// WithHandler appends the handler that serves the requests to server
+func (s *Server) WithHandler(handler http.Handler) *Server {
+	s.handler = handler
+	return s
+}
+
+// WithCORS sets which origins browsers can call the server from and how. By default no other
+// origin is allowed.
+func (s *Server) WithCORS(options cors.Options) *Server {
+	s.cors = options
+	return s
+}
+
+// WithTimeouts sets how long the server waits to read a request, to write its response, and for
+// the next request of an idle keep-alive connection. The headers of a request must be read within
+// the read timeout as well. A zero timeout means no timeout.
+func (s *Server) WithTimeouts(read, write, idle time.Duration) *Server {
+	s.srv.ReadTimeout = read
+	s.srv.ReadHeaderTimeout = read
+	s.srv.WriteTimeout = write
+	s.srv.IdleTimeout = idle
+	return s
+}
+
+// WithShutdownTimeout sets how long in-flight requests are given to finish once shutdown starts.
+// Connections that are still open after the deadline are closed.
+func (s *Server) WithShutdownTimeout(timeout time.Duration) *Server {
+	s.shutdownTimeout = timeout
+	return s
+}
+
+// WithTLS makes the server serve HTTPS with the certificate and key found in the given PEM files.
+// The files are read again whenever they change, so renewed certificates are used without a
+// restart. If either file can't be loaded, Start and Run will return the error.
+func (s *Server) WithTLS(certFile, keyFile string) *Server {
+	s.certificates = &certificates{certFile: certFile, keyFile: keyFile}
+	return s
+}
+
+// WithLogger sets the logger the server writes to while it shuts down
+func (s *Server) WithLogger(log *logger.Logger) *Server {
+	s.log = log
+	return s
+}
+
+// OnShutdown adds a hook that is run once the server stopped serving requests, such as closing
+// the database or stopping background workers. Hooks are run in the order they were added, and
+// are given whatever is left of the shutdown deadline.
+func (s *Server) OnShutdown(hook func(ctx context.Context) error) *Server {
+	s.hooks = append(s.hooks, hook)
 	return s
 }
 
 // Start starts the server on specified port and using specified handlers.
 // If the starting the server encounters errors it will return it.
 func (s *Server) Start() error {
+	return s.Run(context.Background())
+}
+
+// Run starts the server and serves requests until the context is done, at which point it shuts
+// down gracefully: it stops accepting connections, waits for in-flight requests to finish within
+// the shutdown timeout, and then runs the shutdown hooks. If the server fails to start or stops
+// for any other reason, the error is returned after the hooks were run.
+func (s *Server) Run(ctx context.Context) error {
 	if len(s.srv.Addr) == 0 {
 		return errors.New("Server missing address")
 	}
 
-	if s.srv.Handler == nil {
+	listener, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve is the same as Run, but serves the requests accepted by the given listener instead of
+// listening on the address of the server
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if s.handler == nil {
+		listener.Close()
 		return errors.New("Server missing handler")
 	}
 
-	return s.srv.ListenAndServe()
-}
\ No newline at end of file
+	// the cors package allows every origin when none are given, but the server allows none
+	options := s.cors
+	if len(options.AllowedOrigins) == 0 && options.AllowOriginFunc == nil && options.AllowOriginRequestFunc == nil {
+		options.AllowOriginFunc = func(origin string) bool { return false }
+	}
+	s.srv.Handler = cors.New(options).Handler(s.handler)
+
+	if s.certificates != nil {
+		if _, err := s.certificates.get(nil); err != nil {
+			listener.Close()
+			return err
+		}
+
+		s.srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certificates.get,
+		}
+		listener = tls.NewListener(listener, s.srv.TLSConfig)
+	}
+
+	// serve until the server fails or the context is done
+	failed := make(chan error, 1)
+	go func() {
+		failed <- s.srv.Serve(listener)
+	}()
+
+	var serveErr error
+	select {
+	case serveErr = <-failed:
+	case <-ctx.Done():
+		s.log.Info("Shutting down server")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	// wait for in-flight requests, and drop the connections that don't finish in time
+	if err := s.srv.Shutdown(shutdownCtx); err != nil {
+		s.log.Warn("Failed to drain connections", "error", err)
+		s.srv.Close()
+	}
+
+	for _, hook := range s.hooks {
+		if err := hook(shutdownCtx); err != nil {
+			s.log.Error("Failed to run shutdown hook", "error", err)
+		}
+	}
+
+	if serveErr == http.ErrServerClosed {
+		return nil
+	}
+
+	return serveErr
+}
@@ -0,0 +1,228 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/server"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/cors"
+)
+
+// slowRouter responds to /slow once the started channel was closed and the delay passed
+func slowRouter(started chan struct{}, delay time.Duration) *httprouter.Router {
+	router := httprouter.New()
+	router.GET("/slow", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		close(started)
+		time.Sleep(delay)
+		w.Write([]byte("done"))
+	})
+
+	return router
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	started := make(chan struct{})
+
+	var hookRan bool
+	srv := server.Get().
+		WithHandler(slowRouter(started, 200*time.Millisecond)).
+		WithShutdownTimeout(5 * time.Second).
+		OnShutdown(func(ctx context.Context) error {
+			hookRan = true
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Serve(ctx, listener)
+	}()
+
+	// shut down while the request is in flight
+	responded := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			responded <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+
+		body, _ := ioutil.ReadAll(res.Body)
+		responded <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if body := <-responded; body != "done" {
+		t.Fatal("The in-flight request was not finished:", body)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatal("The server did not stop cleanly:", err)
+	}
+
+	if !hookRan {
+		t.Error("The shutdown hook was not run")
+	}
+
+	// new connections are refused once the server stopped
+	if _, err := http.Get("http://" + listener.Addr().String() + "/slow"); err == nil {
+		t.Error("The server still accepts requests")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	started := make(chan struct{})
+
+	srv := server.Get().
+		WithHandler(slowRouter(started, time.Second)).
+		WithShutdownTimeout(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Serve(ctx, listener)
+	}()
+
+	go http.Get("http://" + listener.Addr().String() + "/slow")
+	<-started
+	cancel()
+
+	// the server stops at the deadline instead of waiting for the request
+	select {
+	case <-stopped:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("The server did not stop at the shutdown deadline")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	// serve the same router with the default policy and one that allows the dashboard
+	servers := map[string]*server.Server{
+		"default":   server.Get(),
+		"dashboard": server.Get().WithCORS(cors.Options{
+			AllowedOrigins:   []string{"https://dashboard.example.com"},
+			AllowCredentials: true,
+		}),
+	}
+
+	addresses := make(map[string]string)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for name, srv := range servers {
+		listener, _ := net.Listen("tcp", "127.0.0.1:0")
+		addresses[name] = "http://" + listener.Addr().String() + "/"
+
+		router := httprouter.New()
+		router.GET("/", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {})
+		go srv.WithHandler(router).Serve(ctx, listener)
+	}
+
+	request := func(address, origin string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, address, nil)
+		req.Header.Set("Origin", origin)
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Failed to request:", err)
+		}
+		res.Body.Close()
+
+		return res
+	}
+
+	res := request(addresses["dashboard"], "https://dashboard.example.com")
+	if res.Header.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" ||
+		res.Header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("The dashboard should be allowed with credentials:", res.Header)
+	}
+
+	// origins that were not allowed, or every origin by default, don't get CORS headers
+	if res := request(addresses["dashboard"], "https://evil.example.com"); len(res.Header.Get("Access-Control-Allow-Origin")) > 0 {
+		t.Error("An unknown origin was allowed:", res.Header)
+	}
+
+	if res := request(addresses["default"], "https://dashboard.example.com"); len(res.Header.Get("Access-Control-Allow-Origin")) > 0 {
+		t.Error("The default policy should not allow any origin:", res.Header)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "server")
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile)
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	started := make(chan struct{})
+	srv := server.Get().
+		WithHandler(slowRouter(started, 0)).
+		WithTLS(certFile, keyFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, listener)
+
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	res, err := client.Get("https://" + listener.Addr().String() + "/slow")
+	if err != nil {
+		t.Fatal("Failed to request over TLS:", err)
+	}
+	res.Body.Close()
+
+	if res.TLS == nil {
+		t.Error("The response was not served over TLS")
+	}
+}
+
+func TestTLSMissingFiles(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	srv := server.Get().
+		WithHandler(httprouter.New()).
+		WithTLS("missing.pem", "missing.pem")
+
+	if err := srv.Serve(context.Background(), listener); err == nil {
+		t.Error("The server should not start without its certificate")
+	}
+}
+
+// writeCertificate writes a self signed certificate for 127.0.0.1 and its key as PEM files
+func writeCertificate(t *testing.T, certFile, keyFile string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Failed to create the certificate:", err)
+	}
+
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
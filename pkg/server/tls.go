@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificates loads the TLS certificate of the server from PEM files, and loads it again when
+// either file is modified so that renewed certificates are picked up without a restart
+type certificates struct {
+	certFile	string
+	keyFile		string
+
+	mutex		sync.Mutex
+	certificate	*tls.Certificate
+	modified	time.Time
+}
+
+// get returns the current certificate, loading it first if the files changed since it was last
+// loaded. If the files can't be loaded anymore, the last certificate is kept.
+func (c *certificates) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	modified, err := c.lastModified()
+	if err != nil && c.certificate == nil {
+		return nil, err
+	}
+
+	if c.certificate != nil && (err != nil || !modified.After(c.modified)) {
+		return c.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.certificate != nil {
+			return c.certificate, nil
+		}
+		return nil, err
+	}
+
+	c.certificate = &certificate
+	c.modified = modified
+	return c.certificate, nil
+}
+
+// lastModified returns when the certificate or key file was last modified
+func (c *certificates) lastModified() (time.Time, error) {
+	var modified time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modified, err
+		}
+
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+
+	return modified, nil
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/mailer"
+)
+
+// Mailbox is a mailer that keeps the emails it was given instead of sending them, so that tests
+// can read them. Every mock application sends its emails to a mailbox.
+type Mailbox struct {
+	messages chan mailer.Message
+}
+
+// NewMailbox creates an empty mailbox
+func NewMailbox() *Mailbox {
+	return &Mailbox{messages: make(chan mailer.Message, 16)}
+}
+
+// Send keeps the message in the mailbox
+func (m *Mailbox) Send(message mailer.Message) error {
+	m.messages <- message
+	return nil
+}
+
+// Receive waits for the next email of the mailbox, since emails can be sent after responding,
+// and fails the test if none is sent within a second
+func (m *Mailbox) Receive(t *testing.T) mailer.Message {
+	t.Helper()
+	select {
+	case message := <-m.messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("Expected an email to be sent")
+		return mailer.Message{}
+	}
+}
+
+// Empty fails the test if an email is sent within the given duration
+func (m *Mailbox) Empty(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case message := <-m.messages:
+		t.Fatal("Expected no email to be sent, got", message)
+	case <-time.After(wait):
+	}
+}
+
+// GetMailbox returns the mailbox the mock application sends its emails to
+func GetMailbox(app *application.App) *Mailbox {
+	return app.Mailer.(*Mailbox)
+}
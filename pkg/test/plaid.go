@@ -0,0 +1,247 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/elopez00/scale-backend/pkg/application"
+
+	"github.com/plaid/plaid-go/plaid"
+)
+
+// FakePlaid is an in-process plaid server with scripted items, so that handlers can be tested
+// against plaid responses and errors without the network. It serves every endpoint the
+// application uses, and can be attached to an application with WithPlaidServer.
+type FakePlaid struct {
+	// Items are the items plaid knows about by their access token
+	Items map[string]*FakeItem
+
+	// PublicTokens maps the public tokens that can be exchanged to the access token of their item
+	PublicTokens map[string]string
+
+	// Institutions are the institutions plaid knows about by their id
+	Institutions map[string]plaid.Institution
+
+	// Errors are returned for every request to the endpoint they are keyed by (e.g.
+	// "/link/token/create") before anything else is done
+	Errors map[string]plaid.Error
+
+	// LinkTokens are the configurations of every link token that was created
+	LinkTokens []plaid.LinkTokenConfigs
+
+	mutex sync.Mutex
+}
+
+// FakeItem is an item served by the fake plaid server
+type FakeItem struct {
+	Item         plaid.Item
+	Accounts     []plaid.Account
+	Transactions []plaid.Transaction
+	Credit       []plaid.CreditLiability
+	Student      []plaid.StudentLoanLiability
+	Mortgage     []plaid.MortgageLiability
+
+	// Errors are returned for the requests of this item to the endpoint they are keyed by, which
+	// is how item errors like ITEM_LOGIN_REQUIRED or PRODUCTS_NOT_SUPPORTED are scripted
+	Errors map[string]plaid.Error
+}
+
+// NewFakePlaid creates a fake plaid server that doesn't know about any item
+func NewFakePlaid() *FakePlaid {
+	return &FakePlaid{
+		Items:        make(map[string]*FakeItem),
+		PublicTokens: make(map[string]string),
+		Institutions: make(map[string]plaid.Institution),
+		Errors:       make(map[string]plaid.Error),
+	}
+}
+
+// AddItem makes the fake plaid server serve the item with the given access token, and lets the
+// public token be exchanged for it. The institution of the item is added as well.
+func (f *FakePlaid) AddItem(publicToken, accessToken string, institution plaid.Institution, item *FakeItem) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	item.Item.InstitutionID = institution.ID
+	f.Items[accessToken] = item
+	f.PublicTokens[publicToken] = accessToken
+	f.Institutions[institution.ID] = institution
+}
+
+// PlaidError creates the plaid error with the given type and code, along with the status code
+// plaid responds with for it
+func PlaidError(errorType, errorCode string) plaid.Error {
+	return plaid.Error{
+		ErrorType:    errorType,
+		ErrorCode:    errorCode,
+		ErrorMessage: errorCode,
+		StatusCode:   http.StatusBadRequest,
+	}
+}
+
+// GetPlaidMockApp will get a mock application whose plaid client sends every request to a new
+// fake plaid server. Everything else will be returned just as if GetMockApp() were called. The
+// returned function shuts down the fake server and should be deferred.
+func GetPlaidMockApp() (*application.App, *FakePlaid, func()) {
+	app := GetMockApp()
+	fake := NewFakePlaid()
+
+	return app, fake, WithPlaidServer(app, fake)
+}
+
+// fakeRequest contains every field of the plaid requests the fake plaid server reads
+type fakeRequest struct {
+	AccessToken   string `json:"access_token"`
+	PublicToken   string `json:"public_token"`
+	InstitutionId string `json:"institution_id"`
+	StartDate     string `json:"start_date"`
+	EndDate       string `json:"end_date"`
+	Options       struct {
+		AccountIds []string `json:"account_ids"`
+		Count      int      `json:"count"`
+		Offset     int      `json:"offset"`
+	} `json:"options"`
+}
+
+// ServeHTTP responds to the plaid request like plaid would for the scripted items
+func (f *FakePlaid) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if err, ok := f.Errors[r.URL.Path]; ok {
+		writePlaidError(w, err)
+		return
+	}
+
+	// the link token configuration is the whole body, so it is decoded separately
+	if r.URL.Path == "/link/token/create" {
+		var configs plaid.LinkTokenConfigs
+		json.NewDecoder(r.Body).Decode(&configs)
+		f.LinkTokens = append(f.LinkTokens, configs)
+
+		json.NewEncoder(w).Encode(plaid.CreateLinkTokenResponse{
+			LinkToken: "link-sandbox-" + strconv.Itoa(len(f.LinkTokens)),
+		})
+		return
+	}
+
+	var req fakeRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch r.URL.Path {
+	case "/item/public_token/exchange":
+		accessToken, ok := f.PublicTokens[req.PublicToken]
+		if !ok {
+			writePlaidError(w, PlaidError("INVALID_INPUT", "INVALID_PUBLIC_TOKEN"))
+			return
+		}
+
+		// public tokens can only be exchanged once
+		delete(f.PublicTokens, req.PublicToken)
+		json.NewEncoder(w).Encode(plaid.ExchangePublicTokenResponse{
+			AccessToken: accessToken,
+			ItemID:      f.Items[accessToken].Item.ItemID,
+		})
+		return
+	case "/institutions/get_by_id":
+		institution, ok := f.Institutions[req.InstitutionId]
+		if !ok {
+			writePlaidError(w, PlaidError("INVALID_INPUT", "INVALID_INSTITUTION"))
+			return
+		}
+
+		json.NewEncoder(w).Encode(plaid.GetInstitutionByIDResponse{Institution: institution})
+		return
+	}
+
+	// every other endpoint is for an item
+	item, ok := f.Items[req.AccessToken]
+	if !ok {
+		writePlaidError(w, PlaidError("INVALID_INPUT", "INVALID_ACCESS_TOKEN"))
+		return
+	}
+
+	if err, ok := item.Errors[r.URL.Path]; ok {
+		writePlaidError(w, err)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/item/get":
+		json.NewEncoder(w).Encode(plaid.GetItemResponse{Item: item.Item})
+	case "/item/remove":
+		delete(f.Items, req.AccessToken)
+		json.NewEncoder(w).Encode(plaid.RemoveItemResponse{})
+	case "/accounts/get":
+		json.NewEncoder(w).Encode(plaid.GetAccountsResponse{Accounts: item.Accounts, Item: item.Item})
+	case "/liabilities/get":
+		var res plaid.GetLiabilitiesResponse
+		res.Accounts = item.Accounts
+		res.Item = item.Item
+		res.Liabilities.Credit = item.Credit
+		res.Liabilities.Student = item.Student
+		res.Liabilities.Mortgage = item.Mortgage
+		json.NewEncoder(w).Encode(res)
+	case "/transactions/get":
+		json.NewEncoder(w).Encode(item.transactions(req))
+	default:
+		writePlaidError(w, plaid.Error{
+			ErrorType:  "INVALID_REQUEST",
+			ErrorCode:  "NOT_FOUND",
+			StatusCode: http.StatusNotFound,
+		})
+	}
+}
+
+// transactions returns the page of the item's transactions that was requested
+func (item *FakeItem) transactions(req fakeRequest) plaid.GetTransactionsResponse {
+	accounts := make(map[string]bool)
+	for _, id := range req.Options.AccountIds {
+		accounts[id] = true
+	}
+
+	// iso 8601 dates can be compared as strings
+	transactions := make([]plaid.Transaction, 0)
+	for _, transaction := range item.Transactions {
+		if transaction.Date < req.StartDate || transaction.Date > req.EndDate {
+			continue
+		}
+
+		if len(accounts) > 0 && !accounts[transaction.AccountID] {
+			continue
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	total := len(transactions)
+	start := req.Options.Offset
+	if start > total {
+		start = total
+	}
+
+	end := total
+	if req.Options.Count > 0 && start+req.Options.Count < total {
+		end = start + req.Options.Count
+	}
+
+	return plaid.GetTransactionsResponse{
+		Accounts:          item.Accounts,
+		Item:              item.Item,
+		Transactions:      transactions[start:end],
+		TotalTransactions: total,
+	}
+}
+
+// writePlaidError responds with the plaid error the same way plaid does
+func writePlaidError(w http.ResponseWriter, err plaid.Error) {
+	status := err.StatusCode
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
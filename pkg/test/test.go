@@ -1,50 +1,187 @@
 package test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/elopez00/scale-backend/cmd/api/models"
 	"github.com/elopez00/scale-backend/cmd/api/sdk"
 	"github.com/elopez00/scale-backend/pkg/application"
+	"github.com/elopez00/scale-backend/pkg/application/config"
 
-	"github.com/joho/godotenv"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/julienschmidt/httprouter"
+	"github.com/plaid/plaid-go/plaid"
 )
 
+// testKey is the base64 encoded key used to encrypt tokens in a testing environment
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
 // GetMockApp will get a mock application with no live secrets or codes so that the database,
 // and general API functions can be tested. It will return a test application and a mock
 // database to test queries.
 func GetMockApp() *application.App {
-	environment := map[string]string {
-		"DB_ACCESSPT": "test",
-		"PLAID_CLIENT": "test",
-	}
+	app, _ := application.Get(mockConfig())
+	app.Stores = models.NewSQLStores(app.DB, app.Keyring)
+	app.Mailer = NewMailbox()
+
+	return app
+}
 
-	app, _ := application.Get(environment)
+// GetMemoryApp will get a mock application whose data is stored in memory instead of the mocked
+// database, so that handlers can be tested by their results without any query expectations. The
+// session used by GetWithCookie and PostWithCookie is already active.
+func GetMemoryApp() *application.App {
+	app := GetMockApp()
+	app.Stores = models.NewMemoryStores()
+	app.Sessions.Create(&models.Session{
+		Id:      "testsession",
+		UserId:  "testvalue",
+		Expires: time.Now().Add(time.Hour).Unix(),
+	})
 
 	return app
 }
 
-// GetPlaidMockApp will get a mock application that gets the sandbox keys for plaid. Everything else
-// will be returned just as if GetMockApp() were called.
-func GetPlaidMockApp() *application.App {
-	environment, err := godotenv.Read("../../../.env")
-	environment["DB_ACCESSPT"] = "test"
+// GetSQLiteApp will get a mock application whose data is stored in a new SQLite database with
+// every migration applied, so that the SQL stores can be tested against a real database. The
+// session used by GetWithCookie and PostWithCookie is already active. The returned function
+// closes and deletes the database and should be deferred.
+func GetSQLiteApp() (*application.App, func()) {
+	dir, err := ioutil.TempDir("", "scale")
 	if err != nil {
 		panic(err)
 	}
 
-	app, _  := application.Get(environment)
-	return app
+	config := mockConfig()
+	config.Database.Driver = "sqlite"
+	config.Database.Host = ""
+	config.Database.Name = filepath.Join(dir, "scale.db")
+
+	app, err := application.Get(config)
+	if err != nil {
+		panic(err)
+	}
+	app.Stores = models.NewSQLStores(app.DB, app.Keyring)
+	app.Mailer = NewMailbox()
+
+	if _, err := app.DB.Migrate(context.Background()); err != nil {
+		panic(err)
+	}
+
+	app.Sessions.Create(&models.Session{
+		Id:      "testsession",
+		UserId:  "testvalue",
+		Expires: time.Now().Add(time.Hour).Unix(),
+	})
+
+	return app, func() {
+		app.Worker.Stop(context.Background())
+		app.DB.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// mockConfig returns the configuration of an application with a mocked database and a plaid
+// client with invalid credentials, which plaid will reject unless WithPlaidServer is used
+func mockConfig() *config.Config {
+	mock := config.Default()
+	mock.Server.Key = "testkey-0123456789abcdef0123456789"
+	mock.Database.Host = "test"
+	mock.Plaid.ClientId = "invalid"
+	mock.Plaid.Secret = "invalid"
+	mock.Encryption = config.Encryption {
+		KeyId: "test",
+		Keys:  map[string]string{"test": testKey},
+	}
+
+	return mock
+}
+
+// WithPlaidServer will make the plaid client of the application send all of its requests to the
+// given handler instead of plaid, so that plaid responses can be faked. The returned function
+// shuts down the fake server and should be deferred.
+func WithPlaidServer(app *application.App, handler http.Handler) func() {
+	server := httptest.NewServer(handler)
+	target, _ := url.Parse(server.URL)
+
+	client, _ := plaid.NewClient(plaid.ClientOptions{
+		ClientID:    "test",
+		Secret:      "test",
+		Environment: plaid.Sandbox,
+		HTTPClient:  &http.Client{Transport: redirectTransport{target}},
+	})
+	app.Plaid.Client = client
+
+	return server.Close
+}
+
+// redirectTransport sends every request to the target host
+type redirectTransport struct {
+	target *url.URL
+}
+
+// RoundTrip changes the request to use the target host and sends it
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// EncryptToken will encrypt the access token of the item the same way it is stored in the
+// database, so that it can be returned by mocked queries. The key id of the value is "test".
+func EncryptToken(app *application.App, itemId, value string) string {
+	encrypted, _, _ := app.Keyring.Encrypt(value, itemId)
+	return encrypted
+}
+
+// EncryptedToken will match query arguments that are the given access token encrypted for the
+// item. Since every encryption uses a random nonce, the argument is matched by decrypting it.
+func EncryptedToken(app *application.App, itemId, value string) sqlmock.Argument {
+	return encryptedToken{app, itemId, value}
+}
+
+// encryptedToken is the argument matcher returned by EncryptedToken
+type encryptedToken struct {
+	app    *application.App
+	itemId string
+	value  string
+}
+
+// Match decrypts the argument and compares it with the expected access token
+func (e encryptedToken) Match(arg driver.Value) bool {
+	encrypted, ok := arg.(string)
+	if !ok {
+		return false
+	}
+
+	value, err := e.app.Keyring.Decrypt(encrypted, e.app.Keyring.KeyId, e.itemId)
+	return err == nil && value == e.value
 }
 
-// CloseDB will close the database instance in a testing environment
+// CloseDB will close the database instance in a testing environment. The worker is stopped first,
+// like the server does when it shuts down, so that no background job uses the database after it.
 func CloseDB (t *testing.T, app *application.App) {
+	app.Worker.Stop(context.Background())
+
 	app.DB.Mock.ExpectClose()
 	notSupposedToHappen := "all expectations were already fulfilled, call to database Close was not expected"
 	err := app.DB.Client.Close()
@@ -55,6 +192,8 @@ func CloseDB (t *testing.T, app *application.App) {
 
 // CloseDBWhenFail will close database when there are no expectations for success
 func CloseDBWhenFail(t *testing.T, app *application.App) {
+	app.Worker.Stop(context.Background())
+
 	err := app.DB.Client.Close()
 	if err != nil {
 		//t.Fatal("Error closing database")
@@ -87,11 +226,11 @@ func Get(endpoint string, handler httprouter.Handle) *httptest.ResponseRecorder
 
 // GetWithCookie is used to test any get request that requires a specific type of cookie. The name
 // parameter in this function will be used to specify what cookie the request will search for and
-// it will always return a cookie with "testvalue" as its value. Since it is a GET request, this
-// function does not take JSON bodies
+// it will always return a token for the "testvalue" user and "testsession" session. Since it is a
+// GET request, this function does not take JSON bodies, but the endpoint can have a query string
 func GetWithCookie(endpoint string, handler httprouter.Handle, app *application.App, name string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest("GET", endpoint, nil)
-	token, _ := sdk.GenerateJWT(app, "testvalue")
+	token, _ := sdk.GenerateJWT(app, "testvalue", "testsession")
 	req.AddCookie(&http.Cookie{
 		Name:    name,
 		Value:   token,
@@ -99,7 +238,7 @@ func GetWithCookie(endpoint string, handler httprouter.Handle, app *application.
 	})
 
 	mux := httprouter.New()
-	mux.GET(endpoint, handler)
+	mux.GET(strings.SplitN(endpoint, "?", 2)[0], handler)
 
 	res := executeRequest(req, mux)
 	return res
@@ -107,11 +246,11 @@ func GetWithCookie(endpoint string, handler httprouter.Handle, app *application.
 
 // PostWithCookie is used to test any post request that requires a specific type of cookie. The name
 // parameter in this function will be used to specify what cookie the request will search for and
-// it will always return a cookie with "testvalue" as its value. Since it is a POST request, this
-// function will take in a JSON body
+// it will always return a token for the "testvalue" user and "testsession" session. Since it is a
+// POST request, this function will take in a JSON body
 func PostWithCookie(endpoint string, handler httprouter.Handle, body io.Reader, app *application.App, name string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest("POST", endpoint, body)
-	token, _ := sdk.GenerateJWT(app, "testvalue")
+	token, _ := sdk.GenerateJWT(app, "testvalue", "testsession")
 	req.AddCookie(&http.Cookie{
 		Name:    name,
 		Value:   token,
@@ -125,6 +264,73 @@ func PostWithCookie(endpoint string, handler httprouter.Handle, body io.Reader,
 	return res
 }
 
+// DeleteWithCookie is used to test any delete request that requires a specific type of cookie.
+// The route is the pattern the handler is registered with, which can contain parameters, and
+// the endpoint is the path that is requested. Just like GetWithCookie, the cookie will always
+// contain a token for the "testvalue" user and "testsession" session.
+func DeleteWithCookie(route, endpoint string, handler httprouter.Handle, app *application.App, name string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("DELETE", endpoint, nil)
+	token, _ := sdk.GenerateJWT(app, "testvalue", "testsession")
+	req.AddCookie(&http.Cookie{
+		Name:    name,
+		Value:   token,
+		Expires: time.Now().Add(365 * 24 * time.Hour),
+	})
+
+	mux := httprouter.New()
+	mux.DELETE(route, handler)
+
+	res := executeRequest(req, mux)
+	return res
+}
+
+// PostWithHeader is used to test post calls with JSON bodies that require a specific header
+func PostWithHeader(endpoint string, handler httprouter.Handle, body io.Reader, name, value string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", endpoint, body)
+	req.Header.Set(name, value)
+
+	mux := httprouter.New()
+	mux.POST(endpoint, handler)
+
+	res := executeRequest(req, mux)
+	return res
+}
+
+// SignWebhook will sign the body the same way plaid signs its webhooks, but with a locally
+// generated key. The application is changed to verify webhooks with that key, so the returned
+// token can be used as the Plaid-Verification header of the webhook.
+func SignWebhook(app *application.App, body []byte) string {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	app.Plaid.WebhookKey = func(kid string) (*ecdsa.PublicKey, error) {
+		if kid != "testkey" {
+			return nil, errors.New("unknown key id")
+		}
+		return &key.PublicKey, nil
+	}
+
+	hash := sha256.Sum256(body)
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iat":                 time.Now().Unix(),
+		"request_body_sha256": hex.EncodeToString(hash[:]),
+	})
+	token.Header["kid"] = "testkey"
+
+	signed, _ := token.SignedString(key)
+	return signed
+}
+
+// ExpectSession will add the expectation of the session lookup done when authenticating a
+// request made by GetWithCookie or PostWithCookie. The session will be active unless revoked
+// is true. Since expectations are ordered, this has to be called before any other expectation
+// of the authenticated handler.
+func ExpectSession(app *application.App, revoked bool) {
+	rows := sqlmock.NewRows([]string{"revoked", "expires"}).
+		AddRow(revoked, time.Now().Add(time.Hour).Unix())
+
+	query := `SELECT revoked, expires FROM sessions WHERE id \= \? AND userId \= \?`
+	app.DB.Mock.ExpectQuery(query).WithArgs("testsession", "testvalue").WillReturnRows(rows)
+}
+
 // MockExpectations will take in the testing object and the mock
 // used for database testing and return a testing error if the
 // expectations were not met for the given mock.
@@ -160,6 +366,19 @@ func Response(t *testing.T, res *httptest.ResponseRecorder, expected int) {
 	}
 }
 
+// Error decodes the error of the response and makes sure it has the expected error code. The
+// body of the response is read, so the response can't be decoded again.
+func Error(t *testing.T, res *httptest.ResponseRecorder, code string) *models.APIError {
+	var response models.Response
+	json.NewDecoder(res.Body).Decode(&response)
+
+	if response.Error == nil || response.Error.Code != code {
+		t.Fatalf("Expected error %v, got %+v", code, response.Error)
+	}
+
+	return response.Error
+}
+
 // ModelMethod given a method, an error, and a testing object, this function
 // will determine if the error is not nil and then return a
 // testing error with a description that will correspond to the
@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is how long every code is valid for, and Digits how long codes are. These are the
+	// defaults of every authenticator app, so they are not written in provisioning URIs.
+	Period	= 30 * time.Second
+	Digits	= 6
+	modulus	= 1000000	// 10^Digits
+
+	// Skew is how many periods before and after the current one codes are still accepted in, to
+	// allow for clock drift and codes typed as they change
+	Skew	= 1
+)
+
+// encoding is how secrets are written for authenticator apps, which is base32 without padding
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random secret of 160 bits, the length recommended for HMAC-SHA1
+func GenerateSecret() string {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return encoding.EncodeToString(secret)
+}
+
+// URI returns the otpauth provisioning URI of the secret, which authenticator apps read from a QR
+// code. The issuer and account name the entry of the secret in the app.
+func URI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+
+	uri := url.URL {
+		Scheme:		"otpauth",
+		Host:		"totp",
+		Path:		"/" + issuer + ":" + account,
+		RawQuery:	query.Encode(),
+	}
+	return uri.String()
+}
+
+// Step returns the time step the time is in, which is the counter codes are generated from
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period / time.Second)
+}
+
+// Code returns the code of the secret for the time step
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, as described in RFC 4226
+	offset := sum[len(sum) - 1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset + 4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value % modulus), nil
+}
+
+// Validate checks the code against the codes of the secret around the time, and returns the time
+// step of the code that matched. Callers should reject steps that were already used, so that a
+// code can't be used twice.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current + Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,63 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/elopez00/scale-backend/pkg/totp"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the test vectors of RFC 6238, truncated to six digits
+	for unix, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1234567890:  "005924",
+		20000000000: "353130",
+	} {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(unix, 0)))
+		if err != nil || code != expected {
+			t.Errorf("Expected %s at %d, got %s %v", expected, unix, code, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := totp.GenerateSecret()
+	now := time.Now()
+
+	// codes of the previous period are still accepted, but not older ones
+	previous, _ := totp.Code(secret, totp.Step(now)-1)
+	if step, ok := totp.Validate(secret, previous, now); !ok || step != totp.Step(now)-1 {
+		t.Error("The code of the previous period was rejected")
+	}
+
+	old, _ := totp.Code(secret, totp.Step(now)-3)
+	if _, ok := totp.Validate(secret, old, now); ok {
+		t.Error("An expired code was accepted")
+	}
+
+	if _, ok := totp.Validate(secret, "12345", now); ok {
+		t.Error("A code with the wrong length was accepted")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(totp.URI("JBSWY3DPEHPK3PXP", "Scale", "smarsh@southpark.com"))
+	if err != nil {
+		t.Fatal("Failed to parse the uri:", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Scale:smarsh@southpark.com" {
+		t.Error("Unexpected uri:", uri)
+	}
+
+	if uri.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || uri.Query().Get("issuer") != "Scale" {
+		t.Error("Unexpected uri parameters:", uri.Query())
+	}
+}
@@ -0,0 +1,44 @@
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version, Commit, and BuildTime describe the build of the binary. They are set when building
+// with ldflags, for example:
+//
+//	go build -ldflags "-X github.com/elopez00/scale-backend/pkg/version.Version=v1.2.0" ./cmd/api
+var (
+	Version		string
+	Commit		string
+	BuildTime	string
+)
+
+// Info describes the build of the running binary
+type Info struct {
+	Version		string	`json:"version"`
+	Commit		string	`json:"commit,omitempty"`
+	BuildTime	string	`json:"buildTime,omitempty"`
+	GoVersion	string	`json:"goVersion"`
+}
+
+// Get returns the build info set with ldflags. If no version was set, the version of the main
+// module recorded by the go tool is used instead, which is "(devel)" for local builds.
+func Get() Info {
+	info := Info {
+		Version:	Version,
+		Commit:		Commit,
+		BuildTime:	BuildTime,
+		GoVersion:	runtime.Version(),
+	}
+
+	if len(info.Version) == 0 {
+		info.Version = "unknown"
+		if build, ok := debug.ReadBuildInfo(); ok && len(build.Main.Version) > 0 {
+			info.Version = build.Main.Version
+		}
+	}
+
+	return info
+}